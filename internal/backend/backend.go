@@ -0,0 +1,101 @@
+// Package backend keeps track of the available ExternalClient implementations
+// and routes every composition to the one configured for its kind.
+package backend
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/rs/zerolog"
+	"k8s.io/client-go/rest"
+)
+
+// Options holds what a Factory needs to build an ExternalClient.
+type Options struct {
+	// RESTConfig is the kubernetes client configuration.
+	RESTConfig *rest.Config
+	// Logger is the controller logger.
+	Logger *zerolog.Logger
+	// Params are backend specific settings (i.e. "chart" for HELM).
+	Params map[string]string
+	// References, when set, records the objects read by the backends
+	// (i.e. the credentials Secrets) to requeue their readers on change.
+	References *controller.References
+}
+
+// Param returns the value of the named backend parameter or the
+// provided default value if it is not set.
+func (o Options) Param(key, defaultValue string) string {
+	if val, ok := o.Params[key]; ok && len(val) > 0 {
+		return val
+	}
+	return defaultValue
+}
+
+// Factory creates an ExternalClient.
+type Factory func(opts Options) (controller.ExternalClient, error)
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = make(map[string]Factory)
+)
+
+// Register makes a backend available by the provided name.
+// It is meant to be called from the init function of the package
+// implementing the backend, so that out-of-tree ExternalClient can be
+// compiled in with a blank import.
+// If Register is called twice with the same name or if factory is nil,
+// it panics.
+func Register(name string, factory Factory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+
+	if factory == nil {
+		panic("backend: Register factory is nil")
+	}
+
+	key := strings.ToUpper(name)
+	if _, dup := factories[key]; dup {
+		panic("backend: Register called twice for backend " + name)
+	}
+	factories[key] = factory
+}
+
+// Names returns a sorted list of the names of the registered backends.
+func Names() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	all := make([]string, 0, len(factories))
+	for name := range factories {
+		all = append(all, name)
+	}
+	sort.Strings(all)
+	return all
+}
+
+// Exists returns true if a backend with the specified name is registered.
+func Exists(name string) bool {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+
+	_, ok := factories[strings.ToUpper(name)]
+	return ok
+}
+
+// New creates a new ExternalClient using the backend registered
+// with the specified name.
+func New(name string, opts Options) (controller.ExternalClient, error) {
+	factoriesMu.RLock()
+	factory, ok := factories[strings.ToUpper(name)]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown backend %q (registered: %s)",
+			name, strings.Join(Names(), ", "))
+	}
+
+	return factory(opts)
+}
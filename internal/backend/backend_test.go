@@ -0,0 +1,108 @@
+package backend
+
+import (
+	"context"
+	"testing"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+type namedClient struct {
+	name string
+}
+
+func (c *namedClient) Observe(_ context.Context, mg *unstructured.Unstructured) (bool, error) {
+	mg.SetAnnotations(map[string]string{"served-by": c.name})
+	return true, nil
+}
+
+func (c *namedClient) Create(_ context.Context, _ *unstructured.Unstructured) error { return nil }
+func (c *namedClient) Update(_ context.Context, _ *unstructured.Unstructured) error { return nil }
+func (c *namedClient) Delete(_ context.Context, _ *unstructured.Unstructured) error { return nil }
+
+func init() {
+	for _, name := range []string{"test-one", "test-two", "test-three"} {
+		name := name
+		Register(name, func(_ Options) (controller.ExternalClient, error) {
+			return &namedClient{name: name}, nil
+		})
+	}
+}
+
+func TestRegister(t *testing.T) {
+	assert.True(t, Exists("TEST-ONE"))
+	assert.True(t, Exists("test-two"))
+	assert.False(t, Exists("missing"))
+
+	assert.Panics(t, func() {
+		Register("Test-One", func(_ Options) (controller.ExternalClient, error) {
+			return nil, nil
+		})
+	})
+
+	_, err := New("missing", Options{})
+	assert.NotNil(t, err)
+}
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes("Repo.github.krateo.io=REST, Postgres.composition.krateo.io=HELM")
+	assert.Nil(t, err)
+	assert.Equal(t, map[schema.GroupKind]string{
+		{Group: "github.krateo.io", Kind: "Repo"}:          "REST",
+		{Group: "composition.krateo.io", Kind: "Postgres"}: "HELM",
+	}, routes)
+
+	_, err = ParseRoutes("Repo.github.krateo.io")
+	assert.NotNil(t, err)
+}
+
+func TestRouter(t *testing.T) {
+	crd := &unstructured.Unstructured{}
+	crd.SetAPIVersion("apiextensions.k8s.io/v1")
+	crd.SetKind("CustomResourceDefinition")
+	crd.SetName("gists.github.krateo.io")
+	crd.SetLabels(map[string]string{LabelKeyBackend: "test-three"})
+
+	dyn := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{
+			gvrForCRDs: "CustomResourceDefinitionList",
+		}, crd)
+
+	router, err := NewRouter(RouterOptions{
+		DynamicClient: dyn,
+		Routes: map[schema.GroupKind]string{
+			{Group: "github.krateo.io", Kind: "Repo"}: "test-two",
+		},
+		Default: "test-one",
+	})
+	assert.Nil(t, err)
+
+	tests := []struct {
+		apiVersion string
+		kind       string
+		want       string
+	}{
+		{apiVersion: "github.krateo.io/v1alpha1", kind: "Repo", want: "test-two"},
+		{apiVersion: "github.krateo.io/v1alpha1", kind: "Gist", want: "test-three"},
+		{apiVersion: "composition.krateo.io/v1", kind: "Postgres", want: "test-one"},
+	}
+
+	for _, tc := range tests {
+		mg := &unstructured.Unstructured{}
+		mg.SetAPIVersion(tc.apiVersion)
+		mg.SetKind(tc.kind)
+
+		ok, err := router.Observe(context.TODO(), mg)
+		assert.Nil(t, err)
+		assert.True(t, ok)
+		assert.Equal(t, tc.want, mg.GetAnnotations()["served-by"], tc.kind)
+	}
+
+	_, err = NewRouter(RouterOptions{Default: "missing"})
+	assert.NotNil(t, err)
+}
@@ -0,0 +1,210 @@
+package backend
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	unstructuredtools "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	// LabelKeyBackend is the key of the CRD label that selects the
+	// backend serving the custom resources of that CRD.
+	LabelKeyBackend = "krateo.io/composition-backend"
+)
+
+var gvrForCRDs = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+type RouterOptions struct {
+	// DynamicClient is used to look up the CRD labels.
+	// When nil, CRD labels are not considered.
+	DynamicClient dynamic.Interface
+	// Routes maps a kind to the name of the backend serving it.
+	Routes map[schema.GroupKind]string
+	// Default is the backend used when no route matches.
+	Default string
+	// Options are passed to the backend factories.
+	Options Options
+}
+
+var _ controller.ExternalClient = (*Router)(nil)
+
+// Router is an ExternalClient that dispatches every call to the backend
+// configured for the kind of the managed resource.
+// The backend is resolved, in order, from the explicit routes, from the
+// LabelKeyBackend label of the resource CRD and finally from the default.
+type Router struct {
+	dynamicClient dynamic.Interface
+	routes        map[schema.GroupKind]string
+	defaultName   string
+	opts          Options
+
+	mu       sync.Mutex
+	clients  map[string]controller.ExternalClient
+	resolved map[schema.GroupKind]string
+}
+
+// NewRouter creates a new Router.
+// All the referenced backends must be registered.
+func NewRouter(opts RouterOptions) (*Router, error) {
+	if len(opts.Default) > 0 && !Exists(opts.Default) {
+		return nil, fmt.Errorf("unknown default backend %q", opts.Default)
+	}
+	for gk, name := range opts.Routes {
+		if !Exists(name) {
+			return nil, fmt.Errorf("unknown backend %q for kind %q", name, gk.String())
+		}
+	}
+
+	return &Router{
+		dynamicClient: opts.DynamicClient,
+		routes:        opts.Routes,
+		defaultName:   opts.Default,
+		opts:          opts.Options,
+		clients:       map[string]controller.ExternalClient{},
+		resolved:      map[schema.GroupKind]string{},
+	}, nil
+}
+
+// ParseRoutes parses a comma separated list of 'Kind.group=BACKEND' pairs.
+func ParseRoutes(s string) (map[schema.GroupKind]string, error) {
+	res := map[schema.GroupKind]string{}
+	for _, el := range strings.Split(s, ",") {
+		el = strings.TrimSpace(el)
+		if len(el) == 0 {
+			continue
+		}
+
+		kv := strings.SplitN(el, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 || len(kv[1]) == 0 {
+			return nil, fmt.Errorf("invalid backend route %q (expected 'Kind.group=BACKEND')", el)
+		}
+
+		res[schema.ParseGroupKind(strings.TrimSpace(kv[0]))] = strings.TrimSpace(kv[1])
+	}
+	return res, nil
+}
+
+func (r *Router) Observe(ctx context.Context, mg *unstructured.Unstructured) (bool, error) {
+	cli, err := r.For(ctx, mg)
+	if err != nil {
+		return false, err
+	}
+	return cli.Observe(ctx, mg)
+}
+
+func (r *Router) Create(ctx context.Context, mg *unstructured.Unstructured) error {
+	cli, err := r.For(ctx, mg)
+	if err != nil {
+		return err
+	}
+	return cli.Create(ctx, mg)
+}
+
+func (r *Router) Update(ctx context.Context, mg *unstructured.Unstructured) error {
+	cli, err := r.For(ctx, mg)
+	if err != nil {
+		return err
+	}
+	return cli.Update(ctx, mg)
+}
+
+func (r *Router) Delete(ctx context.Context, mg *unstructured.Unstructured) error {
+	cli, err := r.For(ctx, mg)
+	if err != nil {
+		return err
+	}
+	return cli.Delete(ctx, mg)
+}
+
+// For returns the ExternalClient serving the specified resource.
+func (r *Router) For(ctx context.Context, mg *unstructured.Unstructured) (controller.ExternalClient, error) {
+	name, err := r.resolve(ctx, mg)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if cli, ok := r.clients[name]; ok {
+		return cli, nil
+	}
+
+	cli, err := New(name, r.opts)
+	if err != nil {
+		return nil, err
+	}
+	r.clients[name] = cli
+
+	return cli, nil
+}
+
+func (r *Router) resolve(ctx context.Context, mg *unstructured.Unstructured) (string, error) {
+	gk := mg.GroupVersionKind().GroupKind()
+
+	if name, ok := r.routes[gk]; ok {
+		return name, nil
+	}
+
+	r.mu.Lock()
+	name, ok := r.resolved[gk]
+	r.mu.Unlock()
+	if ok {
+		return name, nil
+	}
+
+	name, err := r.fromCRDLabel(ctx, mg)
+	if err != nil {
+		return "", err
+	}
+	if len(name) == 0 {
+		name = r.defaultName
+	}
+	if len(name) == 0 {
+		return "", fmt.Errorf("no backend configured for kind %q", gk.String())
+	}
+	if !Exists(name) {
+		return "", fmt.Errorf("unknown backend %q for kind %q", name, gk.String())
+	}
+
+	r.mu.Lock()
+	r.resolved[gk] = name
+	r.mu.Unlock()
+
+	return name, nil
+}
+
+func (r *Router) fromCRDLabel(ctx context.Context, mg *unstructured.Unstructured) (string, error) {
+	if r.dynamicClient == nil {
+		return "", nil
+	}
+
+	gvr, err := unstructuredtools.GVR(mg)
+	if err != nil {
+		return "", err
+	}
+
+	crd, err := r.dynamicClient.Resource(gvrForCRDs).
+		Get(ctx, gvr.GroupResource().String(), metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return crd.GetLabels()[LabelKeyBackend], nil
+}
@@ -0,0 +1,102 @@
+package restclient
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/lucasepe/httplib"
+	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
+)
+
+// APIKeyAuth sends an API key where an apiKey security scheme of the
+// OpenAPI document says: in a header, a query parameter or a cookie.
+type APIKeyAuth struct {
+	Key string
+	// Scheme is the name of the security scheme to use, when the
+	// document declares more than one apiKey scheme.
+	Scheme string
+	// In and Name locate the key, see ForOperation.
+	In   string
+	Name string
+}
+
+func (a *APIKeyAuth) SetAuth(r *http.Request) {
+	if a == nil {
+		return
+	}
+
+	switch a.In {
+	case "header":
+		r.Header.Set(a.Name, a.Key)
+	case "query":
+		q := r.URL.Query()
+		q.Set(a.Name, a.Key)
+		r.URL.RawQuery = q.Encode()
+	case "cookie":
+		r.AddCookie(&http.Cookie{Name: a.Name, Value: a.Key})
+	}
+}
+
+// ForOperation returns the authentication of the operation: a copy of a
+// located by the apiKey scheme of the operation security requirements
+// (or of the document ones), nil if the operation requires none.
+// Without requirements the scheme is looked up in the components.
+func (a *APIKeyAuth) ForOperation(doc *v3.Document, op *v3.Operation) (httplib.AuthMethod, error) {
+	reqs := doc.Security
+	if op != nil && op.Security != nil {
+		reqs = op.Security
+		if len(reqs) == 0 {
+			// Explicitly public.
+			return nil, nil
+		}
+	}
+
+	var schemes map[string]*v3.SecurityScheme
+	var names []string
+	if doc.Components != nil && doc.Components.SecuritySchemes != nil {
+		schemes = map[string]*v3.SecurityScheme{}
+		for el := doc.Components.SecuritySchemes.First(); el != nil; el = el.Next() {
+			if el.Value() != nil && el.Value().Type == "apiKey" {
+				schemes[el.Key()] = el.Value()
+				names = append(names, el.Key())
+			}
+		}
+	}
+
+	for _, req := range reqs {
+		if req == nil || req.Requirements == nil {
+			continue
+		}
+		for el := req.Requirements.First(); el != nil; el = el.Next() {
+			if _, ok := schemes[el.Key()]; ok && (len(a.Scheme) == 0 || a.Scheme == el.Key()) {
+				return a.located(el.Key(), schemes[el.Key()])
+			}
+		}
+	}
+
+	if len(a.Scheme) > 0 {
+		if ss, ok := schemes[a.Scheme]; ok {
+			return a.located(a.Scheme, ss)
+		}
+		return nil, fmt.Errorf("apiKey security scheme %q not found", a.Scheme)
+	}
+	if len(names) == 0 {
+		return nil, fmt.Errorf("no apiKey security scheme found")
+	}
+	return a.located(names[0], schemes[names[0]])
+}
+
+func (a *APIKeyAuth) located(name string, ss *v3.SecurityScheme) (httplib.AuthMethod, error) {
+	switch ss.In {
+	case "header", "query", "cookie":
+	default:
+		return nil, fmt.Errorf("security scheme %q: unsupported apiKey location %q", name, ss.In)
+	}
+	if len(ss.Name) == 0 {
+		return nil, fmt.Errorf("security scheme %q: missing name", name)
+	}
+
+	res := *a
+	res.In, res.Name = ss.In, ss.Name
+	return &res, nil
+}
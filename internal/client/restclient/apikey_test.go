@@ -0,0 +1,129 @@
+package restclient
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/pb33f/libopenapi"
+	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
+	"github.com/stretchr/testify/assert"
+)
+
+const securedDoc = `openapi: 3.0.0
+info:
+  title: secured
+  version: "1.0"
+security:
+  - headerKey: []
+paths:
+  /default:
+    get:
+      responses:
+        "200":
+          description: ok
+  /query:
+    get:
+      security:
+        - queryKey: []
+      responses:
+        "200":
+          description: ok
+  /public:
+    get:
+      security: []
+      responses:
+        "200":
+          description: ok
+components:
+  securitySchemes:
+    bearer:
+      type: http
+      scheme: bearer
+    headerKey:
+      type: apiKey
+      in: header
+      name: X-API-Key
+    queryKey:
+      type: apiKey
+      in: query
+      name: api_key
+    cookieKey:
+      type: apiKey
+      in: cookie
+      name: session
+`
+
+func buildDoc(t *testing.T, spec string) *v3.Document {
+	d, err := libopenapi.NewDocument([]byte(spec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	doc, errs := d.BuildV3Model()
+	if len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	return &doc.Model
+}
+
+func operation(doc *v3.Document, path string) *v3.Operation {
+	item, _ := doc.Paths.PathItems.Get(path)
+	return item.Get
+}
+
+func TestAPIKeyForOperation(t *testing.T) {
+	doc := buildDoc(t, securedDoc)
+
+	table := []struct {
+		path   string
+		scheme string
+		header string
+		query  string
+		cookie string
+	}{
+		{path: "/default", header: "secret"},
+		{path: "/query", query: "api_key=secret"},
+		{path: "/public"},
+		// Not required by the operation: looked up in the components.
+		{path: "/default", scheme: "cookieKey", cookie: "session=secret"},
+	}
+
+	for _, tc := range table {
+		t.Run(tc.path+tc.scheme, func(t *testing.T) {
+			a := &APIKeyAuth{Key: "secret", Scheme: tc.scheme}
+			auth, err := a.ForOperation(doc, operation(doc, tc.path))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			req, _ := http.NewRequest(http.MethodGet, "http://example.com"+tc.path, nil)
+			if auth != nil {
+				auth.SetAuth(req)
+			}
+			assert.Equal(t, tc.header, req.Header.Get("X-API-Key"))
+			assert.Equal(t, tc.query, req.URL.RawQuery)
+			assert.Equal(t, tc.cookie, req.Header.Get("Cookie"))
+		})
+	}
+
+	// The receiver is not changed.
+	a := &APIKeyAuth{Key: "secret"}
+	_, err := a.ForOperation(doc, operation(doc, "/query"))
+	assert.NoError(t, err)
+	assert.Empty(t, a.In)
+}
+
+func TestAPIKeyForOperationErrors(t *testing.T) {
+	doc := buildDoc(t, securedDoc)
+
+	_, err := (&APIKeyAuth{Key: "secret", Scheme: "bearer"}).ForOperation(doc, operation(doc, "/default"))
+	assert.Error(t, err)
+
+	doc = buildDoc(t, `openapi: 3.0.0
+info:
+  title: open
+  version: "1.0"
+paths: {}
+`)
+	_, err = (&APIKeyAuth{Key: "secret"}).ForOperation(doc, nil)
+	assert.Error(t, err)
+}
@@ -1,18 +1,13 @@
 package restclient
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"net/url"
-	"os"
-	"path"
-	"path/filepath"
 	"strconv"
 	"strings"
 
-	fgetter "github.com/hashicorp/go-getter"
 	stringset "github.com/krateoplatformops/composition-dynamic-controller/internal/text"
-	"github.com/pb33f/libopenapi"
 	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
 	orderedmap "github.com/pb33f/libopenapi/orderedmap"
 )
@@ -25,6 +20,8 @@ const (
 	APICallsTypeList   APICallType = "list"
 	APICallsTypeDelete APICallType = "delete"
 	APICallsTypePatch  APICallType = "patch"
+	APICallsTypePut    APICallType = "put"
+	APICallsTypeHead   APICallType = "head"
 	APICallsTypeFindBy APICallType = "findby"
 )
 
@@ -44,6 +41,10 @@ func StringToApiCallType(ty string) (APICallType, error) {
 		return APICallsTypeDelete, nil
 	case "patch":
 		return APICallsTypePatch, nil
+	case "put":
+		return APICallsTypePut, nil
+	case "head":
+		return APICallsTypeHead, nil
 	case "findby":
 		return APICallsTypeFindBy, nil
 	}
@@ -55,6 +56,8 @@ type AuthType string
 const (
 	AuthTypeBasic  AuthType = "basic"
 	AuthTypeBearer AuthType = "bearer"
+	AuthTypeOAuth2 AuthType = "oauth2"
+	AuthTypeAPIKey AuthType = "apikey"
 )
 
 func (a AuthType) String() string {
@@ -66,6 +69,10 @@ func ToType(ty string) (AuthType, error) {
 		return AuthTypeBasic, nil
 	case "bearer":
 		return AuthTypeBearer, nil
+	case "oauth2":
+		return AuthTypeOAuth2, nil
+	case "apikey":
+		return AuthTypeAPIKey, nil
 	}
 	return "", fmt.Errorf("unknown auth type: %s", ty)
 }
@@ -94,17 +101,22 @@ func buildPath(baseUrl string, path string, parameters map[string]string, query
 	return parsed
 }
 
-func getValidResponseCode(codes *orderedmap.Map[string, *v3.Response]) (int, error) {
+// getValidResponseCodes returns the 2xx codes of the responses.
+func getValidResponseCodes(codes *orderedmap.Map[string, *v3.Response]) ([]int, error) {
+	var res []int
 	for code := codes.First(); code != nil; code = code.Next() {
 		icode, err := strconv.Atoi(code.Key())
 		if err != nil {
-			return 0, fmt.Errorf("invalid response code: %s", code.Key())
+			return nil, fmt.Errorf("invalid response code: %s", code.Key())
 		}
 		if icode >= 200 && icode < 300 {
-			return icode, nil
+			res = append(res, icode)
 		}
 	}
-	return 0, fmt.Errorf("no valid response code found")
+	if len(res) == 0 {
+		return nil, fmt.Errorf("no valid response code found")
+	}
+	return res, nil
 }
 
 func (u *UnstructuredClient) ValidateRequest(httpMethod string, path string, parameters map[string]string, query map[string]string) error {
@@ -143,6 +155,9 @@ func (u *UnstructuredClient) RequestedBody(httpMethod string, path string) (body
 		return nil, fmt.Errorf("operation not found: %s", httpMethod)
 	}
 	bodyParams = stringset.NewStringSet()
+	if getDoc.RequestBody == nil {
+		return bodyParams, nil
+	}
 	bodySchema, ok := getDoc.RequestBody.Content.Get("application/json")
 	if !ok {
 		return bodyParams, nil
@@ -180,48 +195,8 @@ func (u *UnstructuredClient) RequestedParams(httpMethod string, path string) (pa
 	return parameters, query, nil
 }
 
+// BuildClient returns a client of the API described by the
+// document, through the Documents cache.
 func BuildClient(swaggerPath string) (*UnstructuredClient, error) {
-	basePath := "/tmp/composition-dynamic-controller"
-	err := os.MkdirAll(basePath, 0755)
-	defer os.RemoveAll(basePath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create directory: %w", err)
-	}
-	err = fgetter.GetFile(filepath.Join(basePath, filepath.Base(swaggerPath)), swaggerPath)
-	if err != nil {
-		return nil, fmt.Errorf("failed to download file: %w", err)
-	}
-
-	contents, _ := os.ReadFile(filepath.Join(basePath, path.Base(swaggerPath)))
-	d, err := libopenapi.NewDocument(contents)
-	if err != nil {
-		return nil, fmt.Errorf("failed to read file: %w", err)
-	}
-
-	doc, modelErrors := d.BuildV3Model()
-	if len(modelErrors) > 0 {
-		return nil, fmt.Errorf("failed to build model: %w", errors.Join(modelErrors...))
-	}
-	if doc == nil {
-		return nil, fmt.Errorf("failed to build model")
-	}
-
-	// Resolve model references
-	resolvingErrors := doc.Index.GetResolver().Resolve()
-	errs := []error{}
-	for i := range resolvingErrors {
-		errs = append(errs, resolvingErrors[i].ErrorRef)
-	}
-	if len(resolvingErrors) > 0 {
-		return nil, fmt.Errorf("failed to resolve model references: %w", errors.Join(errs...))
-	}
-	if len(doc.Model.Servers) == 0 {
-		return nil, fmt.Errorf("no servers found in the document")
-	}
-
-	return &UnstructuredClient{
-		Server:    doc.Model.Servers[0].URL,
-		DocScheme: doc,
-		Auth:      nil,
-	}, nil
+	return Documents.BuildClient(context.Background(), swaggerPath)
 }
@@ -0,0 +1,267 @@
+package restclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	fgetter "github.com/hashicorp/go-getter"
+	"github.com/lucasepe/httplib"
+	"github.com/pb33f/libopenapi"
+	v3 "github.com/pb33f/libopenapi/datamodel/high/v3"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// DefaultDocumentTTL is how long the OpenAPI documents are
+	// used before being revalidated.
+	DefaultDocumentTTL = 5 * time.Minute
+
+	documentFetchTimeout = 30 * time.Second
+	maxDocumentSize      = 32 << 20
+)
+
+// Documents is the DocumentCache used by BuildClient.
+var Documents = NewDocumentCache(DefaultDocumentTTL)
+
+// DocumentCache keeps the parsed OpenAPI documents by URL. Once their
+// TTL expired the http(s) ones are revalidated with their ETag or
+// Last-Modified, the others downloaded again; either way they are
+// parsed again only when their contents changed.
+type DocumentCache struct {
+	ttl    atomic.Int64
+	client *http.Client
+
+	mu      sync.Mutex
+	entries map[string]*document
+	fetches singleflight.Group
+}
+
+type document struct {
+	model        *libopenapi.DocumentModel[v3.Document]
+	sum          [sha256.Size]byte
+	etag         string
+	lastModified string
+	expiry       time.Time
+}
+
+// NewDocumentCache returns an empty DocumentCache. A ttl
+// not greater than zero is replaced by DefaultDocumentTTL.
+func NewDocumentCache(ttl time.Duration) *DocumentCache {
+	res := &DocumentCache{
+		client:  &http.Client{Timeout: documentFetchTimeout},
+		entries: map[string]*document{},
+	}
+	res.SetTTL(ttl)
+	return res
+}
+
+// SetTTL changes the TTL of the documents fetched from now on.
+func (c *DocumentCache) SetTTL(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = DefaultDocumentTTL
+	}
+	c.ttl.Store(int64(ttl))
+}
+
+// BuildClient returns a client of the API described by the document.
+func (c *DocumentCache) BuildClient(ctx context.Context, swaggerPath string) (*UnstructuredClient, error) {
+	doc, err := c.Document(ctx, swaggerPath)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.Model.Servers) == 0 {
+		return nil, fmt.Errorf("no servers found in the document")
+	}
+
+	return &UnstructuredClient{
+		Server:    doc.Model.Servers[0].URL,
+		DocScheme: doc,
+	}, nil
+}
+
+// Document returns the parsed document. It is shared, never modify it.
+func (c *DocumentCache) Document(ctx context.Context, swaggerPath string) (*libopenapi.DocumentModel[v3.Document], error) {
+	if cur := c.entry(swaggerPath); cur != nil && time.Now().Before(cur.expiry) {
+		return cur.model, nil
+	}
+
+	// Concurrent fetches of the same document share one download;
+	// not canceled with the first caller.
+	ctx = context.WithoutCancel(ctx)
+	res, err, _ := c.fetches.Do(swaggerPath, func() (interface{}, error) {
+		cur := c.entry(swaggerPath)
+		if cur != nil && time.Now().Before(cur.expiry) {
+			return cur.model, nil
+		}
+
+		doc, err := c.fetch(ctx, swaggerPath, cur)
+		if err != nil {
+			return nil, err
+		}
+		c.mu.Lock()
+		c.entries[swaggerPath] = doc
+		c.mu.Unlock()
+		return doc.model, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res.(*libopenapi.DocumentModel[v3.Document]), nil
+}
+
+func (c *DocumentCache) entry(swaggerPath string) *document {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.entries[swaggerPath]
+}
+
+// fetch downloads the document, reusing the model of cur if unchanged.
+func (c *DocumentCache) fetch(ctx context.Context, swaggerPath string, cur *document) (*document, error) {
+	res := &document{}
+
+	var contents []byte
+	var err error
+	if isHTTP(swaggerPath) {
+		var notModified bool
+		contents, notModified, err = c.download(ctx, swaggerPath, cur, res)
+		if err != nil {
+			return nil, err
+		}
+		if notModified {
+			res.model, res.sum = cur.model, cur.sum
+		}
+	} else {
+		contents, err = getFile(swaggerPath)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if res.model == nil {
+		res.sum = sha256.Sum256(contents)
+		if cur != nil && cur.sum == res.sum {
+			res.model = cur.model
+		} else if res.model, err = parseDocument(contents); err != nil {
+			return nil, err
+		}
+	}
+
+	res.expiry = time.Now().Add(time.Duration(c.ttl.Load()))
+	return res, nil
+}
+
+// download gets the document with a conditional request when cur has
+// validators, storing the new ones in res.
+func (c *DocumentCache) download(ctx context.Context, swaggerPath string, cur, res *document) ([]byte, bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, swaggerPath, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to download file: %w", err)
+	}
+	if cur != nil {
+		if len(cur.etag) > 0 {
+			req.Header.Set("If-None-Match", cur.etag)
+		}
+		if len(cur.lastModified) > 0 {
+			req.Header.Set("If-Modified-Since", cur.lastModified)
+		}
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to download file: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && cur != nil {
+		res.etag, res.lastModified = cur.etag, cur.lastModified
+		return nil, true, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("failed to download file: %w",
+			&httplib.StatusError{StatusCode: resp.StatusCode, Inner: fmt.Errorf("%s", resp.Status)})
+	}
+
+	contents, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to download file: %w", err)
+	}
+	res.etag = resp.Header.Get("ETag")
+	res.lastModified = resp.Header.Get("Last-Modified")
+	return contents, false, nil
+}
+
+// isHTTP returns true for the plain http(s) URLs, the
+// ones without a go-getter forced getter or options.
+func isHTTP(swaggerPath string) bool {
+	u, err := url.Parse(swaggerPath)
+	if err != nil {
+		return false
+	}
+	return (u.Scheme == "http" || u.Scheme == "https") && len(u.RawQuery) == 0
+}
+
+// fetchMu serializes the downloads: go-getter shares its default
+// getters between the calls.
+var fetchMu sync.Mutex
+
+// getFile downloads the document with go-getter.
+func getFile(swaggerPath string) ([]byte, error) {
+	// Each call gets its own directory: the workers build clients concurrently.
+	basePath, err := os.MkdirTemp("", "composition-dynamic-controller-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create directory: %w", err)
+	}
+	defer os.RemoveAll(basePath)
+
+	dst := filepath.Join(basePath, path.Base(swaggerPath))
+	fetchMu.Lock()
+	err = fgetter.GetFile(dst, swaggerPath)
+	fetchMu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("failed to download file: %w", err)
+	}
+
+	contents, err := os.ReadFile(dst)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	return contents, nil
+}
+
+// parseDocument builds the OpenAPI v3 model and resolves its references.
+func parseDocument(contents []byte) (*libopenapi.DocumentModel[v3.Document], error) {
+	d, err := libopenapi.NewDocument(contents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+
+	doc, modelErrors := d.BuildV3Model()
+	if len(modelErrors) > 0 {
+		return nil, fmt.Errorf("failed to build model: %w", errors.Join(modelErrors...))
+	}
+	if doc == nil {
+		return nil, fmt.Errorf("failed to build model")
+	}
+
+	// Resolve model references
+	resolvingErrors := doc.Index.GetResolver().Resolve()
+	errs := []error{}
+	for i := range resolvingErrors {
+		errs = append(errs, resolvingErrors[i].ErrorRef)
+	}
+	if len(resolvingErrors) > 0 {
+		return nil, fmt.Errorf("failed to resolve model references: %w", errors.Join(errs...))
+	}
+	return doc, nil
+}
@@ -0,0 +1,131 @@
+package restclient
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const petsDoc = `openapi: 3.0.0
+info:
+  title: pets
+  version: "%s"
+servers:
+  - url: http://pets.example.com
+paths: {}
+`
+
+// docServer serves petsDoc with the version as ETag.
+func docServer(t *testing.T, version *atomic.Value) (*httptest.Server, *atomic.Int32, *atomic.Int32) {
+	var calls, notModified atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		etag := `"` + version.Load().(string) + `"`
+		if r.Header.Get("If-None-Match") == etag {
+			notModified.Add(1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		w.Write([]byte(strings.Replace(petsDoc, "%s", version.Load().(string), 1)))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &calls, &notModified
+}
+
+func TestDocumentCacheRevalidates(t *testing.T) {
+	var version atomic.Value
+	version.Store("1")
+	srv, calls, notModified := docServer(t, &version)
+	ctx := context.Background()
+
+	docs := NewDocumentCache(time.Hour)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := docs.Document(ctx, srv.URL+"/pets.yaml")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	first, err := docs.Document(ctx, srv.URL+"/pets.yaml")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, int32(1), calls.Load())
+
+	// Expired, not modified.
+	docs.SetTTL(time.Millisecond)
+	docs.expire(srv.URL + "/pets.yaml")
+	doc, err := docs.Document(ctx, srv.URL+"/pets.yaml")
+	assert.NoError(t, err)
+	assert.Same(t, first, doc)
+	assert.Equal(t, int32(1), notModified.Load())
+
+	// Expired, modified.
+	version.Store("2")
+	time.Sleep(5 * time.Millisecond)
+	doc, err = docs.Document(ctx, srv.URL+"/pets.yaml")
+	assert.NoError(t, err)
+	assert.NotSame(t, first, doc)
+	assert.Equal(t, "2", doc.Model.Info.Version)
+
+	cli, err := docs.BuildClient(ctx, srv.URL+"/pets.yaml")
+	if assert.NoError(t, err) {
+		assert.Equal(t, "http://pets.example.com", cli.Server)
+	}
+}
+
+func TestDocumentCacheFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pets.yaml")
+	if err := os.WriteFile(path, []byte(strings.Replace(petsDoc, "%s", "1", 1)), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+
+	docs := NewDocumentCache(time.Hour)
+	first, err := docs.Document(ctx, path)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	// Downloaded again, but unchanged.
+	docs.expire(path)
+	doc, err := docs.Document(ctx, path)
+	assert.NoError(t, err)
+	assert.Same(t, first, doc)
+
+	_, err = docs.Document(ctx, filepath.Join(t.TempDir(), "missing.yaml"))
+	assert.Error(t, err)
+}
+
+func TestDocumentCacheErrors(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	t.Cleanup(srv.Close)
+
+	_, err := NewDocumentCache(0).Document(context.Background(), srv.URL+"/pets.yaml")
+	assert.Error(t, err)
+}
+
+// expire makes the document stale.
+func (c *DocumentCache) expire(swaggerPath string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.entries[swaggerPath]; ok {
+		cp := *el
+		cp.expiry = time.Time{}
+		c.entries[swaggerPath] = &cp
+	}
+}
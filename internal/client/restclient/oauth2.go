@@ -0,0 +1,213 @@
+package restclient
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/lucasepe/httplib"
+	"golang.org/x/sync/singleflight"
+)
+
+const (
+	// tokenExpiryDelta is how long before their expiry the tokens are refreshed.
+	tokenExpiryDelta = time.Minute
+	// tokenIdleTTL is how long the tokens without expiry are kept unused.
+	tokenIdleTTL = time.Hour
+)
+
+// A Refresher is an AuthMethod whose credentials are fetched and
+// expire, i.e. the OAuth2 access tokens.
+type Refresher interface {
+	httplib.AuthMethod
+	// Refresh fetches the credentials if missing or about to
+	// expire, or anyway when force is true.
+	Refresh(ctx context.Context, cli *http.Client, force bool) error
+}
+
+var _ Refresher = (*OAuth2Auth)(nil)
+
+// OAuth2Auth authenticates the requests with the access tokens of the
+// OAuth2 client credentials flow. The tokens are shared by all the
+// OAuth2Auth with the same credentials, until they expire: the tokens
+// of the rotated credentials or of the deleted compositions are evicted.
+type OAuth2Auth struct {
+	TokenURL     string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	Audience     string
+}
+
+type token struct {
+	value  string
+	expiry time.Time
+	// used is the last time the token was set, guarded by tokensMu.
+	used time.Time
+}
+
+func (t *token) valid(now time.Time) bool {
+	return t != nil && (t.expiry.IsZero() || now.Add(tokenExpiryDelta).Before(t.expiry))
+}
+
+// expired returns true if the token is past its expiry or,
+// without one, unused for tokenIdleTTL.
+func (t *token) expired(now time.Time) bool {
+	if t.expiry.IsZero() {
+		return now.Sub(t.used) > tokenIdleTTL
+	}
+	return !now.Before(t.expiry)
+}
+
+var (
+	tokensMu sync.Mutex
+	tokens   = map[string]*token{}
+	fetches  singleflight.Group
+)
+
+// key identifies the credentials in the tokens cache.
+func (a *OAuth2Auth) key() string {
+	h := sha256.New()
+	for _, el := range []string{a.TokenURL, a.ClientID, a.ClientSecret, strings.Join(a.Scopes, " "), a.Audience} {
+		h.Write([]byte(el))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (a *OAuth2Auth) SetAuth(r *http.Request) {
+	if a == nil {
+		return
+	}
+
+	key, now := a.key(), time.Now()
+
+	tokensMu.Lock()
+	tok := tokens[key]
+	if tok != nil && tok.expired(now) {
+		delete(tokens, key)
+		tok = nil
+	}
+	if tok != nil {
+		tok.used = now
+	}
+	tokensMu.Unlock()
+	if tok != nil {
+		r.Header.Set("Authorization", "Bearer "+tok.value)
+	}
+}
+
+// storeToken caches the token, evicting the expired ones.
+func storeToken(key string, tok *token) {
+	now := time.Now()
+
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+
+	for k, el := range tokens {
+		if el.expired(now) {
+			delete(tokens, k)
+		}
+	}
+	tok.used = now
+	tokens[key] = tok
+}
+
+func (a *OAuth2Auth) Refresh(ctx context.Context, cli *http.Client, force bool) error {
+	key := a.key()
+
+	tokensMu.Lock()
+	tok := tokens[key]
+	tokensMu.Unlock()
+	if !force && tok.valid(time.Now()) {
+		return nil
+	}
+
+	// Concurrent refreshes of the same credentials share one request.
+	_, err, _ := fetches.Do(key, func() (interface{}, error) {
+		tokensMu.Lock()
+		cur := tokens[key]
+		tokensMu.Unlock()
+		if cur != tok && cur.valid(time.Now()) {
+			// Refreshed meanwhile.
+			return nil, nil
+		}
+
+		res, err := a.fetch(ctx, cli)
+		if err != nil {
+			return nil, err
+		}
+		storeToken(key, res)
+		return nil, nil
+	})
+	return err
+}
+
+// fetch requests a new access token to the token endpoint.
+func (a *OAuth2Auth) fetch(ctx context.Context, cli *http.Client) (*token, error) {
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {a.ClientID},
+		"client_secret": {a.ClientSecret},
+	}
+	if len(a.Scopes) > 0 {
+		form.Set("scope", strings.Join(a.Scopes, " "))
+	}
+	if len(a.Audience) > 0 {
+		form.Set("audience", a.Audience)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	now := time.Now()
+	res, err := cli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: requesting token: %w", err)
+	}
+	defer res.Body.Close()
+
+	dat, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("oauth2: reading token response: %w", err)
+	}
+	if res.StatusCode < 200 || res.StatusCode > 299 {
+		return nil, fmt.Errorf("oauth2: token request failed: %w",
+			&httplib.StatusError{StatusCode: res.StatusCode, Inner: fmt.Errorf("%s", dat)})
+	}
+
+	var body struct {
+		AccessToken string `json:"access_token"`
+		// Some providers send it as a string.
+		ExpiresIn json.RawMessage `json:"expires_in"`
+	}
+	if err := json.Unmarshal(dat, &body); err != nil {
+		return nil, fmt.Errorf("oauth2: decoding token response: %w", err)
+	}
+	if len(body.AccessToken) == 0 {
+		return nil, fmt.Errorf("oauth2: missing access_token in token response")
+	}
+
+	tok := &token{value: body.AccessToken}
+	if s := strings.Trim(string(body.ExpiresIn), `"`); len(s) > 0 && s != "null" {
+		secs, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("oauth2: invalid expires_in %q", s)
+		}
+		tok.expiry = now.Add(time.Duration(secs) * time.Second)
+	}
+	return tok, nil
+}
@@ -0,0 +1,156 @@
+package restclient
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/lucasepe/httplib"
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenServer issues the tokens tok-1, tok-2... expiring after expiresIn.
+func tokenServer(t *testing.T, expiresIn string) (*httptest.Server, *atomic.Int32) {
+	var issued atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("grant_type") != "client_credentials" ||
+			r.FormValue("client_id") != "id" || r.FormValue("client_secret") != "secret" {
+			http.Error(w, `{"error":"invalid_client"}`, http.StatusUnauthorized)
+			return
+		}
+		assert.Equal(t, "read write", r.FormValue("scope"))
+		assert.Equal(t, "api://sample", r.FormValue("audience"))
+
+		n := issued.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprintf(w, `{"access_token":"tok-%d","token_type":"Bearer","expires_in":%s}`, n, expiresIn)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &issued
+}
+
+func newOAuth2(tokenURL, secret string) *OAuth2Auth {
+	return &OAuth2Auth{
+		TokenURL:     tokenURL,
+		ClientID:     "id",
+		ClientSecret: secret,
+		Scopes:       []string{"read", "write"},
+		Audience:     "api://sample",
+	}
+}
+
+func authHeader(a httplib.AuthMethod) string {
+	req, _ := http.NewRequest(http.MethodGet, "http://example.com", nil)
+	a.SetAuth(req)
+	return req.Header.Get("Authorization")
+}
+
+func TestOAuth2Caching(t *testing.T) {
+	srv, issued := tokenServer(t, "3600")
+	ctx := context.Background()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, newOAuth2(srv.URL, "secret").Refresh(ctx, srv.Client(), false))
+		}()
+	}
+	wg.Wait()
+
+	a := newOAuth2(srv.URL, "secret")
+	assert.NoError(t, a.Refresh(ctx, srv.Client(), false))
+	assert.Equal(t, int32(1), issued.Load())
+	assert.Equal(t, "Bearer tok-1", authHeader(a))
+
+	assert.NoError(t, a.Refresh(ctx, srv.Client(), true))
+	assert.Equal(t, "Bearer tok-2", authHeader(a))
+}
+
+func TestOAuth2RefreshesBeforeExpiry(t *testing.T) {
+	// Within tokenExpiryDelta, as a string.
+	srv, issued := tokenServer(t, `"30"`)
+	ctx := context.Background()
+
+	a := newOAuth2(srv.URL, "secret")
+	assert.NoError(t, a.Refresh(ctx, srv.Client(), false))
+	assert.NoError(t, a.Refresh(ctx, srv.Client(), false))
+	assert.Equal(t, int32(2), issued.Load())
+}
+
+func TestOAuth2TokenError(t *testing.T) {
+	srv, _ := tokenServer(t, "3600")
+
+	err := newOAuth2(srv.URL, "wrong").Refresh(context.Background(), srv.Client(), false)
+	assert.True(t, httplib.HasStatusErr(err, http.StatusUnauthorized))
+}
+
+func TestFireRefreshesOnUnauthorized(t *testing.T) {
+	tokens, issued := tokenServer(t, "3600")
+
+	// Only the second token is accepted.
+	var calls atomic.Int32
+	api := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.Header.Get("Authorization") != "Bearer tok-2" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	t.Cleanup(api.Close)
+
+	u := &UnstructuredClient{Auth: newOAuth2(tokens.URL, "secret")}
+	req, err := httplib.Post(api.URL, httplib.ToJSON(map[string]string{"name": "sample"}))
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	var val map[string]interface{}
+	err = u.fire(context.Background(), api.Client(), req, nil, httplib.FireOptions{
+		ResponseHandler: httplib.FromJSON(&val),
+		Validators:      []httplib.HandleResponseFunc{httplib.CheckStatus(http.StatusOK)},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, true, val["ok"])
+	assert.Equal(t, int32(2), calls.Load())
+	assert.Equal(t, int32(2), issued.Load())
+}
+
+func TestOAuth2EvictsExpiredTokens(t *testing.T) {
+	now := time.Now()
+	storeToken("expired", &token{value: "old", expiry: now.Add(-time.Second)})
+	storeToken("idle", &token{value: "idle"})
+	tokensMu.Lock()
+	tokens["idle"].used = now.Add(-2 * tokenIdleTTL)
+	tokensMu.Unlock()
+
+	storeToken("fresh", &token{value: "new", expiry: now.Add(time.Hour)})
+
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	assert.NotContains(t, tokens, "expired")
+	assert.NotContains(t, tokens, "idle")
+	assert.Contains(t, tokens, "fresh")
+	delete(tokens, "fresh")
+}
+
+func TestOAuth2DropsExpiredToken(t *testing.T) {
+	srv, _ := tokenServer(t, "0")
+	ctx := context.Background()
+
+	// Issued already expired: gone once read.
+	old := newOAuth2(srv.URL, "secret")
+	assert.Nil(t, old.Refresh(ctx, srv.Client(), false))
+	assert.Empty(t, authHeader(old))
+
+	tokensMu.Lock()
+	defer tokensMu.Unlock()
+	assert.NotContains(t, tokens, old.key())
+}
@@ -0,0 +1,294 @@
+package restclient
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lucasepe/httplib"
+)
+
+// DefaultPollInterval is the delay between two polls of a long-running
+// operation whose responses have no Retry-After header.
+const DefaultPollInterval = 10 * time.Second
+
+// ErrOperationFailed is wrapped by the errors of the failed operations.
+var ErrOperationFailed = errors.New("operation failed")
+
+// operationHeaders hold the operation URL of a 202 Accepted response, by precedence.
+var operationHeaders = []string{"Operation-Location", "Azure-AsyncOperation", "Location"}
+
+// Polling tells how to follow the long-running operations started by a verb
+// (answered with 202 Accepted). Without it the defaults apply.
+type Polling struct {
+	// URLPath: the response field holding the operation URL, dot separated,
+	// if not in the Operation-Location, Azure-AsyncOperation or Location header
+	// +optional
+	URLPath string `json:"urlPath,omitempty"`
+	// StatusPath: the operation field holding its state, dot separated,
+	// defaults to "status"; an operation without it is completed
+	// +optional
+	StatusPath string `json:"statusPath,omitempty"`
+	// Succeeded: the states of a completed operation, defaults to [succeeded]
+	// +optional
+	Succeeded []string `json:"succeeded,omitempty"`
+	// Failed: the states of a failed operation, defaults to [failed, canceled, cancelled]
+	// +optional
+	Failed []string `json:"failed,omitempty"`
+	// ResultPath: the operation field holding the resource, dot separated;
+	// defaults to the whole operation
+	// +optional
+	ResultPath string `json:"resultPath,omitempty"`
+	// ResourceLocationPath: the operation field holding the URL of the resource,
+	// read once completed (i.e. "resourceLocation")
+	// +optional
+	ResourceLocationPath string `json:"resourceLocationPath,omitempty"`
+	// IntervalSeconds: the delay between two polls without Retry-After,
+	// defaults to DefaultPollInterval
+	// +optional
+	IntervalSeconds int `json:"intervalSeconds,omitempty"`
+	// CrossOrigin: polls the operations and reads the resources on another
+	// scheme, host or port than the server, sending them the credentials too
+	// +optional
+	CrossOrigin bool `json:"crossOrigin,omitempty"`
+}
+
+// Accepted is returned when the API accepted the request with 202 and
+// goes on asynchronously. It is not a failure.
+type Accepted struct {
+	// OperationURL polls the operation, empty if the API gave none.
+	OperationURL string
+	// RetryAfter is the delay before the first poll.
+	RetryAfter time.Duration
+	// Body is the response body, if any.
+	Body map[string]interface{}
+}
+
+func (e *Accepted) Error() string {
+	if len(e.OperationURL) == 0 {
+		return "request accepted"
+	}
+	return fmt.Sprintf("request accepted, operation: %s", e.OperationURL)
+}
+
+// IsAccepted returns the Accepted that err is (or wraps), if any.
+func IsAccepted(err error) (*Accepted, bool) {
+	var acc *Accepted
+	ok := errors.As(err, &acc)
+	return acc, ok
+}
+
+// accepted fails the 202 responses with an Accepted error.
+func (u *UnstructuredClient) accepted(p *Polling) httplib.HandleResponseFunc {
+	return func(res *http.Response) error {
+		if res.StatusCode != http.StatusAccepted {
+			return nil
+		}
+
+		acc := &Accepted{
+			RetryAfter: retryAfter(res.Header, p.interval()),
+		}
+		// The body is not always an object, if any.
+		_ = optionalJSON(&acc.Body)(res)
+
+		var loc string
+		if len(p.urlPath()) > 0 {
+			loc = fieldString(acc.Body, p.urlPath())
+		}
+		for _, h := range operationHeaders {
+			if len(loc) > 0 {
+				break
+			}
+			loc = res.Header.Get(h)
+		}
+		if len(loc) > 0 {
+			acc.OperationURL = resolve(res.Request.URL, loc)
+		}
+		return acc
+	}
+}
+
+// Poll reads the state of the operation. It returns its result once
+// completed, nil and the delay before the next poll while running,
+// an error wrapping ErrOperationFailed if it failed.
+func (u *UnstructuredClient) Poll(ctx context.Context, cli *http.Client, operationURL string, p *Polling) (*map[string]interface{}, time.Duration, error) {
+	body, code, header, err := u.read(ctx, cli, operationURL, p)
+	if err != nil {
+		return nil, 0, err
+	}
+	next := retryAfter(header, p.interval())
+	if code == http.StatusAccepted {
+		return nil, next, nil
+	}
+
+	if state := fieldString(body, p.statusPath()); len(state) > 0 {
+		switch {
+		case contains(p.failed(), state):
+			return nil, 0, fmt.Errorf("%w: %s: %s", ErrOperationFailed, operationURL, state)
+		case !contains(p.succeeded(), state):
+			return nil, next, nil
+		}
+	}
+
+	if path := p.resourceLocationPath(); len(path) > 0 {
+		if loc := fieldString(body, path); len(loc) > 0 {
+			body, _, _, err = u.read(ctx, cli, loc, p)
+			if err != nil {
+				return nil, 0, err
+			}
+		}
+	}
+	if path := p.resultPath(); len(path) > 0 {
+		res, ok := fieldMap(body, path)
+		if !ok {
+			return nil, 0, fmt.Errorf("operation %s: no result in %q", operationURL, path)
+		}
+		return &res, 0, nil
+	}
+	return &body, 0, nil
+}
+
+// read GETs the URL, relative to the server if not absolute. The URLs
+// come from the responses: those on another origin than the server are
+// refused, not to send them the credentials, unless p allows them.
+func (u *UnstructuredClient) read(ctx context.Context, cli *http.Client, uri string, p *Polling) (map[string]interface{}, int, http.Header, error) {
+	base, err := url.Parse(u.Server)
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	req, err := httplib.Get(resolve(base, uri))
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	if !p.crossOrigin() && !sameOrigin(base, req.URL) {
+		return nil, 0, nil, fmt.Errorf("polling: %s not on %s://%s", req.URL, base.Scheme, base.Host)
+	}
+
+	var code int
+	var header http.Header
+	val := map[string]interface{}{}
+	err = u.fire(ctx, cli, req, nil, httplib.FireOptions{
+		ResponseHandler: func(res *http.Response) error {
+			code, header = res.StatusCode, res.Header
+			return optionalJSON(&val)(res)
+		},
+		Validators: []httplib.HandleResponseFunc{
+			httplib.ErrorJSON(&APIError{}, http.StatusOK, http.StatusCreated, http.StatusAccepted, http.StatusNoContent),
+		},
+	})
+	if err != nil {
+		return nil, 0, nil, err
+	}
+	return val, code, header, nil
+}
+
+// retryAfter returns the delay of the Retry-After header (seconds or date), def if none.
+func retryAfter(header http.Header, def time.Duration) time.Duration {
+	v := header.Get("Retry-After")
+	if len(v) == 0 {
+		return def
+	}
+	if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+		return time.Duration(n) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+		return 0
+	}
+	return def
+}
+
+// resolve returns the reference resolved against base.
+func resolve(base *url.URL, ref string) string {
+	if base == nil {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// fieldMap returns the dot separated object field of the body.
+func fieldMap(body map[string]interface{}, path string) (map[string]interface{}, bool) {
+	var cur interface{} = body
+	for _, el := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		cur = m[el]
+	}
+	res, ok := cur.(map[string]interface{})
+	return res, ok
+}
+
+func contains(states []string, state string) bool {
+	for _, el := range states {
+		if strings.EqualFold(el, state) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *Polling) urlPath() string {
+	if p == nil {
+		return ""
+	}
+	return p.URLPath
+}
+
+func (p *Polling) statusPath() string {
+	if p == nil || len(p.StatusPath) == 0 {
+		return "status"
+	}
+	return p.StatusPath
+}
+
+func (p *Polling) succeeded() []string {
+	if p == nil || len(p.Succeeded) == 0 {
+		return []string{"succeeded"}
+	}
+	return p.Succeeded
+}
+
+func (p *Polling) failed() []string {
+	if p == nil || len(p.Failed) == 0 {
+		return []string{"failed", "canceled", "cancelled"}
+	}
+	return p.Failed
+}
+
+func (p *Polling) resultPath() string {
+	if p == nil {
+		return ""
+	}
+	return p.ResultPath
+}
+
+func (p *Polling) resourceLocationPath() string {
+	if p == nil {
+		return ""
+	}
+	return p.ResourceLocationPath
+}
+
+func (p *Polling) crossOrigin() bool {
+	return p != nil && p.CrossOrigin
+}
+
+func (p *Polling) interval() time.Duration {
+	if p == nil || p.IntervalSeconds <= 0 {
+		return DefaultPollInterval
+	}
+	return time.Duration(p.IntervalSeconds) * time.Second
+}
@@ -0,0 +1,206 @@
+package restclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/lucasepe/httplib"
+	"github.com/stretchr/testify/assert"
+)
+
+const feedsDoc = `openapi: 3.0.0
+info:
+  title: feeds
+  version: "1.0"
+servers:
+  - url: %s
+paths:
+  /feeds:
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+      responses:
+        "201":
+          description: The feed.
+        "202":
+          description: The feed is being created.
+  /feeds/{id}:
+    delete:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        "204":
+          description: The feed was deleted.
+`
+
+// feedsServer creates the feeds asynchronously: the operation
+// succeeds at the third poll, or fails if the name is "broken".
+func feedsServer(t *testing.T) (*UnstructuredClient, *http.Client) {
+	polls := map[string]int{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/feeds", func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		if body["sync"] == true {
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(map[string]interface{}{"id": "0"})
+			return
+		}
+		w.Header().Set("Operation-Location", fmt.Sprintf("/operations/%s", body["name"]))
+		w.Header().Set("Retry-After", "2")
+		w.WriteHeader(http.StatusAccepted)
+	})
+	mux.HandleFunc("/operations/", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Path[len("/operations/"):]
+		polls[name]++
+		status := "inProgress"
+		if polls[name] >= 3 {
+			status = "succeeded"
+			if name == "broken" {
+				status = "failed"
+			}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"status":           status,
+			"resourceLocation": "/feeds/1",
+		})
+	})
+	mux.HandleFunc("/feeds/1", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			w.Header().Set("Location", "/deletions/1")
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id": "1", "name": "feed"})
+	})
+	mux.HandleFunc("/deletions/1", func(w http.ResponseWriter, r *http.Request) {
+		// Running until the resource is gone, then no content.
+		polls["deletion"]++
+		if polls["deletion"] < 2 {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+
+	doc, err := parseDocument([]byte(fmt.Sprintf(feedsDoc, srv.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &UnstructuredClient{Server: srv.URL, DocScheme: doc}, srv.Client()
+}
+
+func TestAcceptedOperation(t *testing.T) {
+	u, cli := feedsServer(t)
+	ctx := context.Background()
+	polling := &Polling{ResourceLocationPath: "resourceLocation"}
+
+	// Any documented 2xx is valid.
+	res, err := u.Post(ctx, cli, "/feeds", &RequestConfiguration{
+		Body: map[string]interface{}{"name": "feed", "sync": true},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "0", (*res)["id"])
+	}
+
+	_, err = u.Post(ctx, cli, "/feeds", &RequestConfiguration{
+		Body:    map[string]interface{}{"name": "feed"},
+		Polling: polling,
+	})
+	acc, ok := IsAccepted(err)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, u.Server+"/operations/feed", acc.OperationURL)
+	assert.Equal(t, 2*time.Second, acc.RetryAfter)
+
+	for i := 0; i < 2; i++ {
+		res, next, err := u.Poll(ctx, cli, acc.OperationURL, polling)
+		assert.NoError(t, err)
+		assert.Nil(t, res)
+		assert.Equal(t, DefaultPollInterval, next)
+	}
+	res, _, err = u.Poll(ctx, cli, acc.OperationURL, polling)
+	if assert.NoError(t, err) && assert.NotNil(t, res) {
+		assert.Equal(t, "1", (*res)["id"])
+	}
+
+	_, err = u.Post(ctx, cli, "/feeds", &RequestConfiguration{
+		Body: map[string]interface{}{"name": "broken"},
+	})
+	acc, _ = IsAccepted(err)
+	for i := 0; i < 3; i++ {
+		if _, _, err = u.Poll(ctx, cli, acc.OperationURL, nil); err != nil {
+			break
+		}
+	}
+	assert.ErrorIs(t, err, ErrOperationFailed)
+}
+
+func TestAcceptedDeletion(t *testing.T) {
+	u, cli := feedsServer(t)
+	ctx := context.Background()
+
+	_, err := u.Delete(ctx, cli, "/feeds/{id}", &RequestConfiguration{
+		Parameters: map[string]string{"id": "1"},
+	})
+	acc, ok := IsAccepted(err)
+	if !assert.True(t, ok) {
+		return
+	}
+	assert.Equal(t, u.Server+"/deletions/1", acc.OperationURL)
+
+	res, _, err := u.Poll(ctx, cli, acc.OperationURL, &Polling{IntervalSeconds: 1})
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+	res, _, err = u.Poll(ctx, cli, acc.OperationURL, nil)
+	assert.NoError(t, err)
+	assert.NotNil(t, res)
+}
+
+func TestPollOtherOrigin(t *testing.T) {
+	u, cli := feedsServer(t)
+	u.Auth = &httplib.BasicAuth{Username: "admin", Password: "s3cr3t"}
+	ctx := context.Background()
+
+	var calls int
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": "succeeded"})
+	}))
+	t.Cleanup(other.Close)
+
+	_, _, err := u.Poll(ctx, cli, other.URL+"/operations/1", nil)
+	assert.ErrorContains(t, err, "not on")
+	assert.Equal(t, 0, calls)
+
+	res, _, err := u.Poll(ctx, cli, other.URL+"/operations/1", &Polling{CrossOrigin: true})
+	assert.NoError(t, err)
+	assert.NotNil(t, res)
+	assert.Equal(t, 1, calls)
+}
+
+func TestRetryAfter(t *testing.T) {
+	h := http.Header{}
+	assert.Equal(t, time.Minute, retryAfter(h, time.Minute))
+	h.Set("Retry-After", "5")
+	assert.Equal(t, 5*time.Second, retryAfter(h, time.Minute))
+	h.Set("Retry-After", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat))
+	assert.Equal(t, time.Duration(0), retryAfter(h, time.Minute))
+	h.Set("Retry-After", "soon")
+	assert.Equal(t, time.Minute, retryAfter(h, time.Minute))
+}
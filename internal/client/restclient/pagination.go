@@ -0,0 +1,307 @@
+package restclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/text"
+	"github.com/lucasepe/httplib"
+)
+
+// DefaultMaxPages bounds the pages read by a paginated list.
+const DefaultMaxPages = 100
+
+// The pagination strategies.
+const (
+	// PaginationLink follows the next page URL of the RFC 5988 Link
+	// header (rel="next"), or of the NextPath response field.
+	PaginationLink = "link"
+	// PaginationPage increments the page number query parameter
+	// until a page is empty (or shorter than PerPage).
+	PaginationPage = "page"
+	// PaginationToken sends back the continuation token of the
+	// TokenHeader response header or of the TokenPath response field.
+	PaginationToken = "token"
+)
+
+// Pagination tells how to read all the pages of a list.
+type Pagination struct {
+	// Type: the strategy [link, page, token]
+	Type string `json:"type"`
+	// NextPath: the response field holding the next page URL, if not
+	// in the Link header (i.e. "nextLink") - link only
+	// +optional
+	NextPath string `json:"nextPath,omitempty"`
+	// PageParam: the page number query parameter, defaults to "page" - page only
+	// +optional
+	PageParam string `json:"pageParam,omitempty"`
+	// PerPageParam: the page size query parameter, defaults to "per_page" - page only
+	// +optional
+	PerPageParam string `json:"perPageParam,omitempty"`
+	// PerPage: the page size, not sent if zero - page only
+	// +optional
+	PerPage int `json:"perPage,omitempty"`
+	// StartPage: the first page number, defaults to 1 - page only
+	// +optional
+	StartPage int `json:"startPage,omitempty"`
+	// TokenParam: the query parameter sending the continuation token - token only
+	// +optional
+	TokenParam string `json:"tokenParam,omitempty"`
+	// TokenHeader: the response header holding the continuation token - token only
+	// (i.e. "x-ms-continuationtoken")
+	// +optional
+	TokenHeader string `json:"tokenHeader,omitempty"`
+	// TokenPath: the response field holding the continuation token,
+	// dot separated, if not in a header - token only
+	// +optional
+	TokenPath string `json:"tokenPath,omitempty"`
+	// MaxPages: the pages read at most, defaults to DefaultMaxPages
+	// +optional
+	MaxPages int `json:"maxPages,omitempty"`
+	// CrossOrigin: follows the next page URLs to another scheme, host or
+	// port, sending them the credentials too - link only
+	// +optional
+	CrossOrigin bool `json:"crossOrigin,omitempty"`
+}
+
+func (p *Pagination) validate() error {
+	switch p.Type {
+	case PaginationLink, PaginationPage:
+	case PaginationToken:
+		if len(p.TokenParam) == 0 || (len(p.TokenHeader) == 0 && len(p.TokenPath) == 0) {
+			return fmt.Errorf("pagination: token requires tokenParam and tokenHeader or tokenPath")
+		}
+	default:
+		return fmt.Errorf("pagination: unknown type: %q", p.Type)
+	}
+	return nil
+}
+
+// page is a response of a list.
+type page struct {
+	body   map[string]interface{}
+	header http.Header
+	// items are the elements of the first array field of the body,
+	// key its name; a top level array is returned as "items".
+	items []interface{}
+	key   string
+}
+
+// eachPage calls fn with the pages of the list, following opts.Pagination
+// until fn returns false or the last page.
+func (u *UnstructuredClient) eachPage(ctx context.Context, cli *http.Client, path string, opts *RequestConfiguration, fn func(p *page) bool) error {
+	err := u.ValidateRequest("GET", path, opts.Parameters, opts.Query)
+	if err != nil {
+		return err
+	}
+
+	httpMethod := "GET"
+	pathItem, ok := u.DocScheme.Model.Paths.PathItems.Get(path)
+	if !ok {
+		return fmt.Errorf("path not found: %s", path)
+	}
+	getDoc, ok := pathItem.GetOperations().Get(strings.ToLower(httpMethod))
+	if !ok {
+		return fmt.Errorf("operation not found: %s", httpMethod)
+	}
+
+	validStatusCodes, err := getValidResponseCodes(getDoc.Responses.Codes)
+	if err != nil {
+		return err
+	}
+
+	pag := opts.Pagination
+	maxPages := 1
+	if pag != nil {
+		if err := pag.validate(); err != nil {
+			return err
+		}
+		maxPages = pag.MaxPages
+		if maxPages <= 0 {
+			maxPages = DefaultMaxPages
+		}
+	}
+
+	query := make(map[string]string, len(opts.Query))
+	for k, v := range opts.Query {
+		query[k] = v
+	}
+	pageNum := 1
+	if pag != nil && pag.StartPage > 0 {
+		pageNum = pag.StartPage
+	}
+
+	var next string
+	for n := 0; n < maxPages; n++ {
+		if pag != nil && pag.Type == PaginationPage {
+			query[paramOr(pag.PageParam, "page")] = strconv.Itoa(pageNum)
+			if pag.PerPage > 0 {
+				query[paramOr(pag.PerPageParam, "per_page")] = strconv.Itoa(pag.PerPage)
+			}
+		}
+		uri := next
+		if len(uri) == 0 {
+			uri = buildPath(u.Server, path, opts.Parameters, query).String()
+		}
+
+		req, err := httplib.Get(uri)
+		if err != nil {
+			return err
+		}
+		setHeaders(req, opts.Headers)
+
+		res := &page{}
+		err = u.fire(ctx, cli, req, getDoc, httplib.FireOptions{
+			ResponseHandler: res.read,
+			Validators: []httplib.HandleResponseFunc{
+				httplib.ErrorJSON(&APIError{}, validStatusCodes...),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		if !fn(res) || pag == nil {
+			return nil
+		}
+
+		switch pag.Type {
+		case PaginationLink:
+			next = nextLink(res, pag.NextPath, req.URL)
+			if len(next) == 0 {
+				return nil
+			}
+			// Not to hand the credentials to the host a response points to.
+			if to, _ := url.Parse(next); !pag.CrossOrigin && !sameOrigin(req.URL, to) {
+				return fmt.Errorf("pagination: next page %s not on %s://%s", next, req.URL.Scheme, req.URL.Host)
+			}
+		case PaginationPage:
+			if len(res.items) == 0 || (pag.PerPage > 0 && len(res.items) < pag.PerPage) {
+				return nil
+			}
+			pageNum++
+		case PaginationToken:
+			tok := res.header.Get(pag.TokenHeader)
+			if len(pag.TokenHeader) == 0 {
+				tok = fieldString(res.body, pag.TokenPath)
+			}
+			if len(tok) == 0 {
+				return nil
+			}
+			query[pag.TokenParam] = tok
+		}
+	}
+
+	return fmt.Errorf("pagination: more than %d pages", maxPages)
+}
+
+// read decodes the page body.
+func (p *page) read(res *http.Response) error {
+	p.header = res.Header
+
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+	var val interface{}
+	if err := json.Unmarshal(data, &val); err != nil {
+		return err
+	}
+
+	switch v := val.(type) {
+	case []interface{}:
+		p.items, p.key = v, "items"
+		p.body = map[string]interface{}{"items": v}
+	case map[string]interface{}:
+		p.body = v
+		// The first array field in name order, to be deterministic.
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			if items, ok := v[k].([]interface{}); ok {
+				p.items, p.key = items, k
+				break
+			}
+		}
+	default:
+		return fmt.Errorf("unexpected list response: %T", val)
+	}
+	return nil
+}
+
+// nextLink returns the URL of the next page, resolved against cur.
+func nextLink(p *page, nextPath string, cur *url.URL) string {
+	var next string
+	if len(nextPath) > 0 {
+		next = fieldString(p.body, nextPath)
+	} else {
+		next = linkNext(p.header.Values("Link"))
+	}
+	if len(next) == 0 {
+		return ""
+	}
+
+	u, err := cur.Parse(next)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+// linkNext returns the target of the rel="next" link of RFC 5988 headers.
+func linkNext(headers []string) string {
+	for _, h := range headers {
+		for _, link := range strings.Split(h, ",") {
+			parts := strings.Split(link, ";")
+			target := strings.TrimSpace(parts[0])
+			if !strings.HasPrefix(target, "<") || !strings.HasSuffix(target, ">") {
+				continue
+			}
+			for _, param := range parts[1:] {
+				k, v, _ := strings.Cut(strings.TrimSpace(param), "=")
+				if !strings.EqualFold(k, "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.Trim(v, `"`)) {
+					if strings.EqualFold(rel, "next") {
+						return strings.Trim(target, "<>")
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// fieldString returns the value of the dot separated field of the body.
+func fieldString(body map[string]interface{}, path string) string {
+	var cur interface{} = body
+	for _, el := range strings.Split(path, ".") {
+		m, ok := cur.(map[string]interface{})
+		if !ok {
+			return ""
+		}
+		cur = m[el]
+	}
+	if cur == nil {
+		return ""
+	}
+	return text.GenericToString(cur)
+}
+
+func paramOr(name, def string) string {
+	if len(name) == 0 {
+		return def
+	}
+	return name
+}
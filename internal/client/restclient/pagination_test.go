@@ -0,0 +1,204 @@
+package restclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/lucasepe/httplib"
+	"github.com/stretchr/testify/assert"
+)
+
+const reposDoc = `openapi: 3.0.0
+info:
+  title: repos
+  version: "1.0"
+servers:
+  - url: %s
+paths:
+  /repos:
+    get:
+      responses:
+        "200":
+          description: The repositories.
+`
+
+const numRepos = 25
+
+// reposServer pages the repositories by 10 as the strategy says.
+func reposServer(t *testing.T, strategy string) (*UnstructuredClient, *http.Client, *int) {
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		start := 0
+		switch strategy {
+		case PaginationLink, PaginationPage:
+			if n, err := strconv.Atoi(r.URL.Query().Get("page")); err == nil {
+				start = (n - 1) * 10
+			}
+		case PaginationToken:
+			start, _ = strconv.Atoi(r.URL.Query().Get("continuationToken"))
+		}
+
+		items := []interface{}{}
+		for i := start; i < start+10 && i < numRepos; i++ {
+			items = append(items, map[string]interface{}{"name": fmt.Sprintf("repo-%d", i)})
+		}
+		more := start+10 < numRepos
+
+		var body interface{} = items
+		switch strategy {
+		case PaginationLink:
+			if more {
+				w.Header().Add("Link", fmt.Sprintf(`</repos?page=%d>; rel="next", </repos?page=3>; rel="last"`, start/10+2))
+			}
+		case PaginationToken:
+			if more {
+				w.Header().Set("x-ms-continuationtoken", strconv.Itoa(start+10))
+			}
+			body = map[string]interface{}{"count": len(items), "value": items}
+		}
+		json.NewEncoder(w).Encode(body)
+	}))
+	t.Cleanup(srv.Close)
+
+	doc, err := parseDocument([]byte(fmt.Sprintf(reposDoc, srv.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &UnstructuredClient{Server: srv.URL, DocScheme: doc}, srv.Client(), &calls
+}
+
+func TestFindByPaginated(t *testing.T) {
+	table := []struct {
+		pagination *Pagination
+		calls      int
+	}{
+		{pagination: &Pagination{Type: PaginationLink}, calls: 3},
+		{pagination: &Pagination{Type: PaginationPage, PerPage: 10}, calls: 3},
+		{pagination: &Pagination{Type: PaginationToken, TokenParam: "continuationToken", TokenHeader: "x-ms-continuationtoken"}, calls: 3},
+	}
+
+	for _, tc := range table {
+		t.Run(tc.pagination.Type, func(t *testing.T) {
+			u, cli, calls := reposServer(t, tc.pagination.Type)
+
+			res, err := u.FindBy(context.Background(), cli, "/repos", &RequestConfiguration{
+				Query:      map[string]string{"name": "repo-21"},
+				Pagination: tc.pagination,
+			})
+			if assert.NoError(t, err) {
+				assert.Equal(t, "repo-21", (*res)["name"])
+			}
+			assert.Equal(t, tc.calls, *calls)
+
+			_, err = u.FindBy(context.Background(), cli, "/repos", &RequestConfiguration{
+				Query:      map[string]string{"name": "missing"},
+				Pagination: tc.pagination,
+			})
+			assert.True(t, httplib.IsNotFoundError(err))
+
+			list, err := u.List(context.Background(), cli, "/repos", &RequestConfiguration{
+				Pagination: tc.pagination,
+			})
+			if assert.NoError(t, err) {
+				key := "items"
+				if tc.pagination.Type == PaginationToken {
+					key = "value"
+				}
+				assert.Len(t, (*list)[key], numRepos)
+			}
+		})
+	}
+}
+
+func TestFindByPageLimit(t *testing.T) {
+	u, cli, _ := reposServer(t, PaginationLink)
+
+	// Only the first page.
+	_, err := u.FindBy(context.Background(), cli, "/repos", &RequestConfiguration{
+		Query: map[string]string{"name": "repo-21"},
+	})
+	assert.True(t, httplib.IsNotFoundError(err))
+
+	// Not reported as missing.
+	_, err = u.FindBy(context.Background(), cli, "/repos", &RequestConfiguration{
+		Query:      map[string]string{"name": "repo-21"},
+		Pagination: &Pagination{Type: PaginationLink, MaxPages: 2},
+	})
+	assert.Error(t, err)
+	assert.False(t, httplib.IsNotFoundError(err))
+
+	_, err = u.FindBy(context.Background(), cli, "/repos", &RequestConfiguration{
+		Pagination: &Pagination{Type: "offset"},
+	})
+	assert.Error(t, err)
+}
+
+func TestFindByOtherOrigin(t *testing.T) {
+	var leaked []string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = append(leaked, r.Header.Get("Authorization"))
+		json.NewEncoder(w).Encode([]interface{}{map[string]interface{}{"name": "repo-1"}})
+	}))
+	t.Cleanup(other.Close)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Link", fmt.Sprintf(`<%s/repos?page=2>; rel="next"`, other.URL))
+		json.NewEncoder(w).Encode([]interface{}{})
+	}))
+	t.Cleanup(srv.Close)
+
+	doc, err := parseDocument([]byte(fmt.Sprintf(reposDoc, srv.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	u := &UnstructuredClient{Server: srv.URL, DocScheme: doc, Auth: &httplib.BasicAuth{Username: "admin", Password: "s3cr3t"}}
+
+	_, err = u.FindBy(context.Background(), srv.Client(), "/repos", &RequestConfiguration{
+		Query:      map[string]string{"name": "repo-1"},
+		Pagination: &Pagination{Type: PaginationLink},
+	})
+	assert.ErrorContains(t, err, "not on")
+	assert.Empty(t, leaked)
+
+	res, err := u.FindBy(context.Background(), srv.Client(), "/repos", &RequestConfiguration{
+		Query:      map[string]string{"name": "repo-1"},
+		Pagination: &Pagination{Type: PaginationLink, CrossOrigin: true},
+	})
+	if assert.NoError(t, err) {
+		assert.Equal(t, "repo-1", (*res)["name"])
+	}
+	assert.Len(t, leaked, 1)
+}
+
+func TestSameOrigin(t *testing.T) {
+	table := []struct {
+		a, b string
+		want bool
+	}{
+		{a: "https://api.example.com/a", b: "https://API.example.com:443/b?page=2", want: true},
+		{a: "http://api.example.com", b: "https://api.example.com"},
+		{a: "https://api.example.com", b: "https://evil.example.com"},
+		{a: "https://api.example.com", b: "https://api.example.com:8443"},
+	}
+
+	for _, tc := range table {
+		a, _ := url.Parse(tc.a)
+		b, _ := url.Parse(tc.b)
+		assert.Equal(t, tc.want, sameOrigin(a, b), tc.b)
+	}
+}
+
+func TestLinkNext(t *testing.T) {
+	assert.Equal(t, "https://api.github.com/orgs/krateo/repos?page=2",
+		linkNext([]string{`<https://api.github.com/orgs/krateo/repos?page=2>; rel="next", <https://api.github.com/orgs/krateo/repos?page=5>; rel="last"`}))
+	assert.Equal(t, "/next", linkNext([]string{`</prev>; rel="prev"`, `</next>; rel="next"`}))
+	assert.Empty(t, linkNext([]string{`</first>; rel="first"`}))
+	assert.Empty(t, linkNext(nil))
+}
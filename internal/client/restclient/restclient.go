@@ -1,8 +1,12 @@
 package restclient
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"io"
 	"net/http"
+	"net/url"
 	"strings"
 
 	"fmt"
@@ -30,6 +34,13 @@ type RequestConfiguration struct {
 	Parameters map[string]string
 	Query      map[string]string
 	Body       interface{}
+	// Headers are added to the request.
+	Headers map[string]string
+	// Pagination reads all the pages of List and FindBy.
+	Pagination *Pagination
+	// Polling follows the operations accepted by Post, Put, Patch and Delete,
+	// returned as Accepted errors.
+	Polling *Polling
 }
 
 func (u *UnstructuredClient) Get(ctx context.Context, cli *http.Client, path string, opts *RequestConfiguration) (*map[string]interface{}, error) {
@@ -45,31 +56,7 @@ func (u *UnstructuredClient) Get(ctx context.Context, cli *http.Client, path str
 	}
 
 	var val map[string]interface{}
-	apiErr := &APIError{}
-
-	httpMethod := "GET"
-	pathItem, ok := u.DocScheme.Model.Paths.PathItems.Get(path)
-	if !ok {
-		return nil, fmt.Errorf("path not found: %s", path)
-	}
-	getDoc, ok := pathItem.GetOperations().Get(strings.ToLower(httpMethod))
-	if !ok {
-		return nil, fmt.Errorf("operation not found: %s", httpMethod)
-	}
-
-	validStatusCode, err := getValidResponseCode(getDoc.Responses.Codes)
-	if err != nil {
-		return nil, err
-	}
-
-	err = httplib.Fire(cli, req, httplib.FireOptions{
-		Verbose:         u.Verbose,
-		ResponseHandler: httplib.FromJSON(&val),
-		AuthMethod:      u.Auth,
-		Validators: []httplib.HandleResponseFunc{
-			httplib.ErrorJSON(apiErr, validStatusCode),
-		},
-	})
+	err = u.send(ctx, cli, req, path, opts, &val)
 	if err != nil {
 		return nil, err
 	}
@@ -91,109 +78,68 @@ func (u *UnstructuredClient) Post(ctx context.Context, cli *http.Client, path st
 	req.Header.Add("Content-Type", "application/json")
 
 	var val map[string]interface{}
-	apiErr := &APIError{}
-
-	httpMethod := "POST"
-	pathItem, ok := u.DocScheme.Model.Paths.PathItems.Get(path)
-	if !ok {
-		return nil, fmt.Errorf("path not found: %s", path)
-	}
-	getDoc, ok := pathItem.GetOperations().Get(strings.ToLower(httpMethod))
-	if !ok {
-		return nil, fmt.Errorf("operation not found: %s", httpMethod)
-	}
-
-	validStatusCode, err := getValidResponseCode(getDoc.Responses.Codes)
-	if err != nil {
-		return nil, err
-	}
-
-	err = httplib.Fire(cli, req, httplib.FireOptions{
-		Verbose:         u.Verbose,
-		ResponseHandler: httplib.FromJSON(&val),
-		AuthMethod:      u.Auth,
-		Validators: []httplib.HandleResponseFunc{
-			httplib.ErrorJSON(apiErr, validStatusCode),
-		},
-	})
+	err = u.send(ctx, cli, req, path, opts, &val)
 	if err != nil {
 		return nil, err
 	}
 	return &val, nil
 }
 
+// List returns the list; with opts.Pagination, the items of
+// all the pages are merged in the list field of the first one.
 func (u *UnstructuredClient) List(ctx context.Context, cli *http.Client, path string, opts *RequestConfiguration) (*map[string]interface{}, error) {
-	uri := buildPath(u.Server, path, opts.Parameters, opts.Query)
-
-	err := u.ValidateRequest("GET", path, opts.Parameters, opts.Query)
-	if err != nil {
-		return nil, err
-	}
-	req, err := httplib.Get(uri.String())
-	if err != nil {
-		return nil, err
-	}
-
 	var val map[string]interface{}
-	apiErr := &APIError{}
-
-	httpMethod := "GET"
-	pathItem, ok := u.DocScheme.Model.Paths.PathItems.Get(path)
-	if !ok {
-		return nil, fmt.Errorf("path not found: %s", path)
-	}
-	getDoc, ok := pathItem.GetOperations().Get(strings.ToLower(httpMethod))
-	if !ok {
-		return nil, fmt.Errorf("operation not found: %s", httpMethod)
-	}
-
-	validStatusCode, err := getValidResponseCode(getDoc.Responses.Codes)
-	if err != nil {
-		return nil, err
-	}
-
-	err = httplib.Fire(cli, req, httplib.FireOptions{
-		Verbose:         u.Verbose,
-		ResponseHandler: httplib.FromJSON(&val),
-		AuthMethod:      u.Auth,
-		Validators: []httplib.HandleResponseFunc{
-			httplib.ErrorJSON(apiErr, validStatusCode),
-		},
+	var key string
+	var items []interface{}
+	err := u.eachPage(ctx, cli, path, opts, func(p *page) bool {
+		if val == nil {
+			val, key = p.body, p.key
+		}
+		items = append(items, p.items...)
+		return true
 	})
 	if err != nil {
 		return nil, err
 	}
+	if len(key) > 0 {
+		val[key] = items
+	}
 	return &val, nil
 }
 
+// FindBy returns the first item of the list matching the parameters or
+// the query values, reading the following pages with opts.Pagination.
 func (u *UnstructuredClient) FindBy(ctx context.Context, cli *http.Client, path string, opts *RequestConfiguration) (*map[string]interface{}, error) {
-	list, err := u.List(ctx, cli, path, opts)
+	var found map[string]interface{}
+	err := u.eachPage(ctx, cli, path, opts, func(p *page) bool {
+		found = findItem(p.items, opts)
+		return found == nil
+	})
 	if err != nil {
 		return nil, err
 	}
+	if found == nil {
+		return nil, &httplib.StatusError{StatusCode: 404}
+	}
+	return &found, nil
+}
 
-	for _, v := range *list {
-		if v, ok := v.([]interface{}); ok {
-			if len(v) > 0 {
-				for _, item := range v {
-					if item, ok := item.(map[string]interface{}); ok {
-						for key, val := range opts.Parameters {
-							if strItem, ok := item[key].(string); ok && strItem == val {
-								return &item, nil
-							}
-						}
-						for key, val := range opts.Query {
-							if strItem, ok := item[key].(string); ok && strItem == val {
-								return &item, nil
-							}
-						}
-					}
+func findItem(items []interface{}, opts *RequestConfiguration) map[string]interface{} {
+	for _, item := range items {
+		if item, ok := item.(map[string]interface{}); ok {
+			for key, val := range opts.Parameters {
+				if strItem, ok := item[key].(string); ok && strItem == val {
+					return item
+				}
+			}
+			for key, val := range opts.Query {
+				if strItem, ok := item[key].(string); ok && strItem == val {
+					return item
 				}
 			}
-			break
 		}
 	}
-	return nil, &httplib.StatusError{StatusCode: 404}
+	return nil
 }
 
 func (u *UnstructuredClient) Patch(ctx context.Context, cli *http.Client, path string, opts *RequestConfiguration) (*map[string]interface{}, error) {
@@ -211,37 +157,56 @@ func (u *UnstructuredClient) Patch(ctx context.Context, cli *http.Client, path s
 	req.Header.Add("Content-Type", "application/json")
 
 	var val map[string]interface{}
-	apiErr := &APIError{}
-
-	httpMethod := "PATCH"
-	pathItem, ok := u.DocScheme.Model.Paths.PathItems.Get(path)
-	if !ok {
-		return nil, fmt.Errorf("path not found: %s", path)
+	err = u.send(ctx, cli, req, path, opts, &val)
+	if err != nil {
+		return nil, err
 	}
-	getDoc, ok := pathItem.GetOperations().Get(strings.ToLower(httpMethod))
-	if !ok {
-		return nil, fmt.Errorf("operation not found: %s", httpMethod)
+	return &val, nil
+}
+
+func (u *UnstructuredClient) Put(ctx context.Context, cli *http.Client, path string, opts *RequestConfiguration) (*map[string]interface{}, error) {
+	uri := buildPath(u.Server, path, opts.Parameters, opts.Query)
+
+	err := u.ValidateRequest("PUT", path, opts.Parameters, opts.Query)
+	if err != nil {
+		return nil, err
 	}
 
-	validStatusCode, err := getValidResponseCode(getDoc.Responses.Codes)
+	req, err := httplib.Put(uri.String(), httplib.ToJSON(opts.Body))
 	if err != nil {
 		return nil, err
 	}
+	req.Header.Add("Content-Type", "application/json")
 
-	err = httplib.Fire(cli, req, httplib.FireOptions{
-		Verbose:         u.Verbose,
-		ResponseHandler: httplib.FromJSON(&val),
-		AuthMethod:      u.Auth,
-		Validators: []httplib.HandleResponseFunc{
-			httplib.ErrorJSON(apiErr, validStatusCode),
-		},
-	})
+	// The replacements often answer with no content.
+	var val map[string]interface{}
+	err = u.send(ctx, cli, req, path, opts, &val)
 	if err != nil {
 		return nil, err
 	}
 	return &val, nil
 }
 
+// Head checks the resource exists; the returned fields are always empty.
+func (u *UnstructuredClient) Head(ctx context.Context, cli *http.Client, path string, opts *RequestConfiguration) (*map[string]interface{}, error) {
+	uri := buildPath(u.Server, path, opts.Parameters, opts.Query)
+
+	err := u.ValidateRequest("HEAD", path, opts.Parameters, opts.Query)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodHead, uri.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	err = u.send(ctx, cli, req, path, opts, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &map[string]interface{}{}, nil
+}
+
 func (u *UnstructuredClient) Delete(ctx context.Context, cli *http.Client, path string, opts *RequestConfiguration) (*map[string]interface{}, error) {
 	uri := buildPath(u.Server, path, opts.Parameters, opts.Query)
 
@@ -255,33 +220,134 @@ func (u *UnstructuredClient) Delete(ctx context.Context, cli *http.Client, path
 	}
 
 	var val map[string]interface{}
-	apiErr := &APIError{}
+	err = u.send(ctx, cli, req, path, opts, &val)
+	if err != nil {
+		return nil, err
+	}
+	return &val, nil
+}
+
+// fire sends the request of the operation authenticated with u.Auth.
+// An APIKeyAuth is placed as the operation security schemes say; a
+// Refresher is refreshed before, and forcibly once more on a 401 to
+// retry the request.
+func (u *UnstructuredClient) fire(ctx context.Context, cli *http.Client, req *http.Request, op *v3.Operation, opts httplib.FireOptions) error {
+	opts.Verbose = u.Verbose
+	opts.AuthMethod = u.Auth
+
+	if key, ok := u.Auth.(*APIKeyAuth); ok {
+		var err error
+		if opts.AuthMethod, err = key.ForOperation(&u.DocScheme.Model, op); err != nil {
+			return err
+		}
+	}
+
+	ref, ok := u.Auth.(Refresher)
+	if !ok {
+		return httplib.Fire(cli, req.WithContext(ctx), opts)
+	}
+
+	if err := ref.Refresh(ctx, cli, false); err != nil {
+		return err
+	}
+	err := httplib.Fire(cli, req.WithContext(ctx), opts)
+	if !httplib.HasStatusErr(err, http.StatusUnauthorized) {
+		return err
+	}
+
+	if err := ref.Refresh(ctx, cli, true); err != nil {
+		return err
+	}
+	retry := req.Clone(ctx)
+	if req.GetBody != nil {
+		if retry.Body, err = req.GetBody(); err != nil {
+			return err
+		}
+	}
+	retry.Header.Del("Authorization")
+	return httplib.Fire(cli, retry, opts)
+}
+
+// send fires the request of the documented operation on the path with the
+// headers of opts, checking the response code against the documented ones.
+// The response body is decoded into val: as a JSON object for a GET, as an
+// optional one otherwise, with the 202 Accepted responses returned as
+// Accepted errors. A nil val expects no body.
+func (u *UnstructuredClient) send(ctx context.Context, cli *http.Client, req *http.Request, path string, opts *RequestConfiguration, val *map[string]interface{}) error {
+	setHeaders(req, opts.Headers)
 
-	httpMethod := "DELETE"
 	pathItem, ok := u.DocScheme.Model.Paths.PathItems.Get(path)
 	if !ok {
-		return nil, fmt.Errorf("path not found: %s", path)
+		return fmt.Errorf("path not found: %s", path)
 	}
-	getDoc, ok := pathItem.GetOperations().Get(strings.ToLower(httpMethod))
+	op, ok := pathItem.GetOperations().Get(strings.ToLower(req.Method))
 	if !ok {
-		return nil, fmt.Errorf("operation not found: %s", httpMethod)
+		return fmt.Errorf("operation not found: %s", req.Method)
 	}
 
-	validStatusCode, err := getValidResponseCode(getDoc.Responses.Codes)
+	validStatusCodes, err := getValidResponseCodes(op.Responses.Codes)
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	err = httplib.Fire(cli, req, httplib.FireOptions{
-		Verbose:         u.Verbose,
-		ResponseHandler: httplib.FromJSON(&val),
-		AuthMethod:      u.Auth,
+	fireOpts := httplib.FireOptions{
 		Validators: []httplib.HandleResponseFunc{
-			httplib.ErrorJSON(apiErr, validStatusCode),
+			httplib.CheckStatus(validStatusCodes...),
 		},
-	})
-	if err != nil {
-		return nil, err
 	}
-	return &val, nil
+	switch {
+	case val == nil:
+	case req.Method == http.MethodGet:
+		fireOpts.ResponseHandler = httplib.FromJSON(val)
+		fireOpts.Validators = []httplib.HandleResponseFunc{
+			httplib.ErrorJSON(&APIError{}, validStatusCodes...),
+		}
+	default:
+		fireOpts.ResponseHandler = optionalJSON(val)
+		fireOpts.Validators = []httplib.HandleResponseFunc{
+			u.accepted(opts.Polling),
+			httplib.ErrorJSON(&APIError{}, validStatusCodes...),
+		}
+	}
+	return u.fire(ctx, cli, req, op, fireOpts)
+}
+
+// sameOrigin returns true if the URLs have the same scheme, host and port.
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Hostname(), b.Hostname()) &&
+		portOf(a) == portOf(b)
+}
+
+func portOf(u *url.URL) string {
+	if p := u.Port(); len(p) > 0 {
+		return p
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http":
+		return "80"
+	case "https":
+		return "443"
+	}
+	return ""
+}
+
+func setHeaders(req *http.Request, headers map[string]string) {
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+}
+
+// optionalJSON decodes a response as a JSON object, if it has a body.
+func optionalJSON(v interface{}) httplib.HandleResponseFunc {
+	return func(res *http.Response) error {
+		data, err := io.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		if len(bytes.TrimSpace(data)) == 0 {
+			return nil
+		}
+		return json.Unmarshal(data, v)
+	}
 }
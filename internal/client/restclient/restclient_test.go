@@ -0,0 +1,137 @@
+package restclient
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/lucasepe/httplib"
+	"github.com/stretchr/testify/assert"
+)
+
+const itemsDoc = `openapi: 3.0.0
+info:
+  title: items
+  version: "1.0"
+servers:
+  - url: %s
+paths:
+  /items/{id}:
+    put:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      requestBody:
+        content:
+          application/json:
+            schema:
+              type: object
+              properties:
+                name:
+                  type: string
+      responses:
+        "200":
+          description: The replaced item.
+    head:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        "200":
+          description: The item exists.
+`
+
+func itemsClient(t *testing.T, handler http.HandlerFunc) (*UnstructuredClient, *http.Client) {
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	doc, err := parseDocument([]byte(fmt.Sprintf(itemsDoc, srv.URL)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &UnstructuredClient{Server: srv.URL, DocScheme: doc}, srv.Client()
+}
+
+func TestPut(t *testing.T) {
+	items := map[string]map[string]interface{}{}
+	u, cli := itemsClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		var body map[string]interface{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		_, exists := items[r.URL.Path]
+		items[r.URL.Path] = body
+		if exists {
+			// No content on replacement.
+			return
+		}
+		json.NewEncoder(w).Encode(body)
+	})
+
+	params, _, err := u.RequestedParams("PUT", "/items/{id}")
+	assert.NoError(t, err)
+	assert.True(t, params.Contains("id"))
+	body, err := u.RequestedBody("PUT", "/items/{id}")
+	assert.NoError(t, err)
+	assert.True(t, body.Contains("name"))
+
+	opts := &RequestConfiguration{
+		Parameters: map[string]string{"id": "1"},
+		Body:       map[string]interface{}{"name": "first"},
+	}
+	res, err := u.Put(context.Background(), cli, "/items/{id}", opts)
+	if assert.NoError(t, err) {
+		assert.Equal(t, "first", (*res)["name"])
+	}
+
+	opts.Body = map[string]interface{}{"name": "second"}
+	res, err = u.Put(context.Background(), cli, "/items/{id}", opts)
+	if assert.NoError(t, err) {
+		assert.Empty(t, *res)
+	}
+	assert.Equal(t, "second", items["/items/1"]["name"])
+
+	_, err = u.Put(context.Background(), cli, "/items/{id}", &RequestConfiguration{})
+	assert.Error(t, err)
+}
+
+func TestHead(t *testing.T) {
+	u, cli := itemsClient(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodHead, r.Method)
+		if r.URL.Path != "/items/1" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	})
+
+	res, err := u.Head(context.Background(), cli, "/items/{id}", &RequestConfiguration{
+		Parameters: map[string]string{"id": "1"},
+	})
+	if assert.NoError(t, err) {
+		assert.NotNil(t, res)
+	}
+
+	_, err = u.Head(context.Background(), cli, "/items/{id}", &RequestConfiguration{
+		Parameters: map[string]string{"id": "2"},
+	})
+	assert.True(t, httplib.IsNotFoundError(err))
+}
+
+func TestStringToApiCallType(t *testing.T) {
+	for _, el := range []string{"GET", "post", "Put", "PATCH", "delete", "HEAD", "list", "findby"} {
+		_, err := StringToApiCallType(el)
+		assert.NoError(t, err, el)
+	}
+	_, err := StringToApiCallType("OPTIONS")
+	assert.Error(t, err)
+}
@@ -0,0 +1,141 @@
+package restclient
+
+import (
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+)
+
+// maxPooledClients bounds the http clients of a ClientPool: the ones
+// of the rotated certificates are otherwise never released.
+const maxPooledClients = 64
+
+// TLSConfig is the TLS configuration of the calls to an API:
+// the PEM encoded CA bundle and client certificate and key.
+type TLSConfig struct {
+	CA   []byte
+	Cert []byte
+	Key  []byte
+	// ServerName overrides the name the server certificate is verified against.
+	ServerName string
+	// InsecureSkipVerify disables the server certificate verification,
+	// for testing only.
+	InsecureSkipVerify bool
+}
+
+// Build returns the tls.Config of c. Without a CA bundle, the
+// server certificates are verified against the system ones.
+func (c *TLSConfig) Build() (*tls.Config, error) {
+	res := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if len(c.CA) > 0 {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(c.CA) {
+			return nil, fmt.Errorf("tls: no certificates found in CA bundle")
+		}
+		res.RootCAs = pool
+	}
+
+	if len(c.Cert) > 0 || len(c.Key) > 0 {
+		if len(c.Cert) == 0 || len(c.Key) == 0 {
+			return nil, fmt.Errorf("tls: both client certificate and key are required")
+		}
+		cert, err := tls.X509KeyPair(c.Cert, c.Key)
+		if err != nil {
+			return nil, fmt.Errorf("tls: loading client certificate: %w", err)
+		}
+		res.Certificates = []tls.Certificate{cert}
+	}
+
+	return res, nil
+}
+
+// key identifies the configuration in a ClientPool.
+func (c *TLSConfig) key() string {
+	h := sha256.New()
+	for _, el := range [][]byte{c.CA, c.Cert, c.Key, []byte(c.ServerName), []byte(strconv.FormatBool(c.InsecureSkipVerify))} {
+		h.Write(el)
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// ClientPool shares one http client, and so its connections,
+// among the calls with the same TLS configuration.
+type ClientPool struct {
+	base      *http.Client
+	newClient func(*tls.Config) *http.Client
+
+	mu      sync.Mutex
+	clients map[string]*http.Client
+}
+
+// NewClientPool returns a ClientPool creating the clients with
+// newClient. The calls without TLS configuration use base.
+func NewClientPool(base *http.Client, newClient func(*tls.Config) *http.Client) *ClientPool {
+	return &ClientPool{
+		base:      base,
+		newClient: newClient,
+		clients:   map[string]*http.Client{},
+	}
+}
+
+// ClientWithTLS returns a function creating the clients as base, with
+// its transport (if an *http.Transport) cloned to use the tls.Config.
+func ClientWithTLS(base *http.Client) func(*tls.Config) *http.Client {
+	return func(tc *tls.Config) *http.Client {
+		tr, ok := base.Transport.(*http.Transport)
+		if !ok {
+			tr = http.DefaultTransport.(*http.Transport)
+		}
+		tr = tr.Clone()
+		tr.TLSClientConfig = tc
+
+		res := *base
+		res.Transport = tr
+		return &res
+	}
+}
+
+// Client returns the http client of the TLS configuration.
+func (p *ClientPool) Client(cfg *TLSConfig) (*http.Client, error) {
+	if cfg == nil {
+		return p.base, nil
+	}
+	key := cfg.key()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if cli, ok := p.clients[key]; ok {
+		return cli, nil
+	}
+
+	tc, err := cfg.Build()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(p.clients) >= maxPooledClients {
+		for k, cli := range p.clients {
+			cli.CloseIdleConnections()
+			delete(p.clients, k)
+			break
+		}
+	}
+	cli := p.newClient(tc)
+	p.clients[key] = cli
+	return cli, nil
+}
@@ -0,0 +1,142 @@
+package restclient
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type issuer struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+// newCA returns a self signed CA.
+func newCA(t *testing.T) *issuer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign,
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+	}
+	dat, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(dat)
+	return &issuer{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: dat})}
+}
+
+// issue returns the PEM encoded certificate and key for the name.
+func (ca *issuer) issue(t *testing.T, name string, usage x509.ExtKeyUsage) (certPEM, keyPEM []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	dat, err := x509.CreateCertificate(rand.Reader, tpl, ca.cert, &key.PublicKey, ca.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: dat}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: der})
+}
+
+func TestClientPoolMutualTLS(t *testing.T) {
+	ca := newCA(t)
+	srvCert, srvKey := ca.issue(t, "api.internal", x509.ExtKeyUsageServerAuth)
+	cliCert, cliKey := ca.issue(t, "controller", x509.ExtKeyUsageClientAuth)
+
+	pair, err := tls.X509KeyPair(srvCert, srvKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		ClientCAs:    roots,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	base := &http.Client{Timeout: 5 * time.Second}
+	pool := NewClientPool(base, ClientWithTLS(base))
+
+	cli, err := pool.Client(nil)
+	assert.NoError(t, err)
+	assert.Same(t, base, cli)
+	_, err = cli.Get(srv.URL)
+	assert.Error(t, err)
+
+	cfg := &TLSConfig{CA: ca.pem, Cert: cliCert, Key: cliKey, ServerName: "api.internal"}
+	cli, err = pool.Client(cfg)
+	if !assert.NoError(t, err) {
+		return
+	}
+	res, err := cli.Get(srv.URL)
+	if assert.NoError(t, err) {
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	// Pooled by configuration.
+	same, err := pool.Client(&TLSConfig{CA: ca.pem, Cert: cliCert, Key: cliKey, ServerName: "api.internal"})
+	assert.NoError(t, err)
+	assert.Same(t, cli, same)
+
+	other, err := pool.Client(&TLSConfig{Cert: cliCert, Key: cliKey, InsecureSkipVerify: true})
+	assert.NoError(t, err)
+	assert.NotSame(t, cli, other)
+	res, err = other.Get(srv.URL)
+	if assert.NoError(t, err) {
+		res.Body.Close()
+	}
+}
+
+func TestTLSConfigBuildErrors(t *testing.T) {
+	ca := newCA(t)
+	cert, _ := ca.issue(t, "controller", x509.ExtKeyUsageClientAuth)
+
+	_, err := (&TLSConfig{Cert: cert}).Build()
+	assert.Error(t, err)
+
+	_, err = (&TLSConfig{CA: []byte("not a pem")}).Build()
+	assert.Error(t, err)
+}
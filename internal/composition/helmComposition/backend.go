@@ -0,0 +1,37 @@
+package composition
+
+import (
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/backend"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/client"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/helmchart/archive"
+)
+
+const (
+	// ParamChart is the backend parameter holding a static chart url.
+	// When empty the chart is resolved from the composition definition.
+	ParamChart = "chart"
+	// ParamRepositoryCache is the backend parameter holding the helm repository cache path.
+	ParamRepositoryCache = "repositoryCache"
+	// ParamRepositoryConfig is the backend parameter holding the helm repository config path.
+	ParamRepositoryConfig = "repositoryConfig"
+)
+
+func init() {
+	backend.Register(client.ClientHelm.String(), func(opts backend.Options) (controller.ExternalClient, error) {
+		hopts := HandlerOptions{
+			RepositoryCache:  opts.Param(ParamRepositoryCache, defaultRepositoryCache),
+			RepositoryConfig: opts.Param(ParamRepositoryConfig, defaultRepositoryConfig),
+		}
+
+		if chart := opts.Param(ParamChart, ""); len(chart) > 0 {
+			return NewHandler(opts.RESTConfig, opts.Logger, archive.Static(chart), hopts), nil
+		}
+
+		pig, err := archive.Dynamic(opts.RESTConfig)
+		if err != nil {
+			return nil, err
+		}
+		return NewHandler(opts.RESTConfig, opts.Logger, pig, hopts), nil
+	})
+}
@@ -32,43 +32,88 @@ var (
 
 var _ controller.ExternalClient = (*handler)(nil)
 
-func NewHandler(cfg *rest.Config, log *zerolog.Logger, pig archive.Getter) controller.ExternalClient {
-	dyn, err := dynamic.NewForConfig(cfg)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Creating dynamic client.")
+const (
+	defaultRepositoryCache  = "/tmp/.helmcache"
+	defaultRepositoryConfig = "/tmp/.helmrepo"
+)
+
+type HandlerOptions struct {
+	// RepositoryCache is the helm repository cache path.
+	RepositoryCache string
+	// RepositoryConfig is the helm repository config file path.
+	RepositoryConfig string
+	// DynamicClient defaults to a client built from the rest config.
+	DynamicClient dynamic.Interface
+	// DiscoveryClient defaults to a client built from the rest config.
+	DiscoveryClient discovery.DiscoveryInterface
+	// HelmClientFactory returns the helm client of a resource.
+	// Defaults to helmclient.New.
+	HelmClientFactory func(opts *helmclient.Options) (helmclient.Client, error)
+}
+
+func NewHandler(cfg *rest.Config, log *zerolog.Logger, pig archive.Getter, opts HandlerOptions) controller.ExternalClient {
+	var err error
+	if opts.DynamicClient == nil {
+		opts.DynamicClient, err = dynamic.NewForConfig(cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Creating dynamic client.")
+		}
 	}
 
-	dis, err := discovery.NewDiscoveryClientForConfig(cfg)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Creating discovery client.")
+	if opts.DiscoveryClient == nil {
+		opts.DiscoveryClient, err = discovery.NewDiscoveryClientForConfig(cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Creating discovery client.")
+		}
 	}
 
-	return &handler{
+	if opts.HelmClientFactory == nil {
+		opts.HelmClientFactory = helmclient.New
+	}
+
+	if len(opts.RepositoryCache) == 0 {
+		opts.RepositoryCache = defaultRepositoryCache
+	}
+	if len(opts.RepositoryConfig) == 0 {
+		opts.RepositoryConfig = defaultRepositoryConfig
+	}
+
+	h := &handler{
 		logger:            log,
-		dynamicClient:     dyn,
-		discoveryClient:   dis,
+		dynamicClient:     opts.DynamicClient,
+		discoveryClient:   opts.DiscoveryClient,
 		packageInfoGetter: pig,
+		repositoryCache:   opts.RepositoryCache,
+		repositoryConfig:  opts.RepositoryConfig,
+		newHelmClient:     opts.HelmClientFactory,
 	}
+
+	return controller.Chain(h,
+		controller.WithLogging(log),
+		controller.WithPrecondition(h.check),
+	)
+}
+
+// check fails all the operations when the handler is not usable.
+func (h *handler) check(context.Context, *unstructured.Unstructured) error {
+	if h.packageInfoGetter == nil {
+		return fmt.Errorf("helm chart package info getter must be specified")
+	}
+	return nil
 }
 
 type handler struct {
 	logger            *zerolog.Logger
 	dynamicClient     dynamic.Interface
-	discoveryClient   *discovery.DiscoveryClient
+	discoveryClient   discovery.DiscoveryInterface
 	packageInfoGetter archive.Getter
+	repositoryCache   string
+	repositoryConfig  string
+	newHelmClient     func(opts *helmclient.Options) (helmclient.Client, error)
 }
 
 func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (bool, error) {
-	log := h.logger.With().
-		Str("op", "Observe").
-		Str("apiVersion", mg.GetAPIVersion()).
-		Str("kind", mg.GetKind()).
-		Str("name", mg.GetName()).
-		Str("namespace", mg.GetNamespace()).Logger()
-
-	if h.packageInfoGetter == nil {
-		return false, fmt.Errorf("helm chart package info getter must be specified")
-	}
+	log := zerolog.Ctx(ctx)
 
 	hc, err := h.helmClientForResource(mg)
 	if err != nil {
@@ -130,10 +175,7 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 			_ = unstructuredtools.SetFailedObjectRef(mg, ref)
 			_ = unstructuredtools.SetCondition(mg, condition.Unavailable())
 
-			return true, tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-				DiscoveryClient: h.discoveryClient,
-				DynamicClient:   h.dynamicClient,
-			})
+			return true, nil
 		}
 	}
 
@@ -148,42 +190,19 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 	}
 
 	_ = unstructuredtools.SetCondition(mg, condition.Available())
-	err = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
-	})
-	if err != nil {
-		log.Err(err).Msgf("Updating cr status with condition: %v", condition.Available())
-	}
 
-	return true, err
+	return true, nil
 }
 
 func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) error {
-	log := h.logger.With().
-		Str("op", "Create").
-		Str("apiVersion", mg.GetAPIVersion()).
-		Str("kind", mg.GetKind()).
-		Str("name", mg.GetName()).
-		Str("namespace", mg.GetNamespace()).Logger()
+	log := zerolog.Ctx(ctx)
 
 	// If we started but never completed creation of an external resource we
 	// may have lost critical information.The safest thing to
 	// do is to refuse to proceed.
 	if meta.ExternalCreateIncomplete(mg) {
 		log.Warn().Msg(errCreateIncomplete)
-		err := unstructuredtools.SetCondition(mg, condition.Creating())
-		if err != nil {
-			return err
-		}
-		return tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-			DiscoveryClient: h.discoveryClient,
-			DynamicClient:   h.dynamicClient,
-		})
-	}
-
-	if h.packageInfoGetter == nil {
-		return fmt.Errorf("helm chart package info getter must be specified")
+		return unstructuredtools.SetCondition(mg, condition.Creating())
 	}
 
 	hc, err := h.helmClientForResource(mg)
@@ -214,11 +233,6 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 		unstructuredtools.SetCondition(mg, condition.FailWithReason(
 			fmt.Sprintf("Creating failed: %s", err.Error())))
 
-		_ = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-			DiscoveryClient: h.discoveryClient,
-			DynamicClient:   h.dynamicClient,
-		})
-
 		return err
 	}
 
@@ -232,12 +246,7 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 }
 
 func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) error {
-	log := h.logger.With().
-		Str("op", "Update").
-		Str("apiVersion", mg.GetAPIVersion()).
-		Str("kind", mg.GetKind()).
-		Str("name", mg.GetName()).
-		Str("namespace", mg.GetNamespace()).Logger()
+	log := zerolog.Ctx(ctx)
 
 	log.Debug().Msg("Handling composition values update.")
 
@@ -246,12 +255,7 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 	// do is to refuse to proceed.
 	if meta.ExternalCreateIncomplete(mg) {
 		log.Warn().Msg(errCreateIncomplete)
-		_ = unstructuredtools.SetCondition(mg, condition.Creating())
-
-		return tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-			DiscoveryClient: h.discoveryClient,
-			DynamicClient:   h.dynamicClient,
-		})
+		return unstructuredtools.SetCondition(mg, condition.Creating())
 	}
 
 	meta.SetExternalCreatePending(mg, time.Now())
@@ -264,10 +268,6 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 		return err
 	}
 
-	if h.packageInfoGetter == nil {
-		return fmt.Errorf("helm chart package info getter must be specified")
-	}
-
 	hc, err := h.helmClientForResource(mg)
 	if err != nil {
 		log.Err(err).Msg("Getting helm client")
@@ -296,10 +296,6 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 }
 
 func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) error {
-	if h.packageInfoGetter == nil {
-		return fmt.Errorf("helm chart package info getter must be specified")
-	}
-
 	// mg := unstructured.Unstructured{}
 	// mg.SetAPIVersion(ref.APIVersion)
 	// mg.SetKind(ref.Kind)
@@ -316,25 +312,17 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 		return err
 	}
 
-	chartSpec := helmclient.ChartSpec{
-		ReleaseName: mg.GetName(),
-		Namespace:   mg.GetNamespace(),
-		ChartName:   pkg.URL,
-		Version:     pkg.Version,
-		Wait:        true,
-		Timeout:     time.Minute * 3,
-	}
-
-	err = hc.UninstallRelease(&chartSpec)
+	err = helmchart.Uninstall(ctx, helmchart.UninstallOptions{
+		HelmClient: hc,
+		ChartName:  pkg.URL,
+		Version:    pkg.Version,
+		Resource:   mg,
+	})
 	if err != nil {
 		return err
 	}
 
-	h.logger.Debug().Str("apiVersion", mg.GetAPIVersion()).
-		Str("kind", mg.GetKind()).
-		Str("name", mg.GetName()).
-		Str("namespace", mg.GetNamespace()).
-		Str("package", pkg.URL).
+	zerolog.Ctx(ctx).Debug().Str("package", pkg.URL).
 		Msg("Composition package removed.")
 
 	return nil
@@ -349,8 +337,8 @@ func (h *handler) helmClientForResource(mg *unstructured.Unstructured) (helmclie
 
 	opts := &helmclient.Options{
 		Namespace:        mg.GetNamespace(),
-		RepositoryCache:  "/tmp/.helmcache",
-		RepositoryConfig: "/tmp/.helmrepo",
+		RepositoryCache:  h.repositoryCache,
+		RepositoryConfig: h.repositoryConfig,
 		Debug:            true,
 		Linting:          false,
 		DebugLog: func(format string, v ...interface{}) {
@@ -366,5 +354,5 @@ func (h *handler) helmClientForResource(mg *unstructured.Unstructured) (helmclie
 		},
 	}
 
-	return helmclient.New(opts)
+	return h.newHelmClient(opts)
 }
@@ -0,0 +1,143 @@
+package composition
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/harness"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/helmchart/archive"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var (
+	widgets = harness.Kind{
+		GVR:  schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1", Resource: "widgets"},
+		Kind: "Widget",
+	}
+	configMaps = harness.Kind{
+		GVR:  schema.GroupVersionResource{Version: "v1", Resource: "configmaps"},
+		Kind: "ConfigMap",
+	}
+)
+
+const manifest = `apiVersion: v1
+kind: ConfigMap
+metadata:
+  name: sample-config
+data:
+  value: a
+`
+
+func newConfigMap(conditions ...interface{}) *unstructured.Unstructured {
+	res := &unstructured.Unstructured{}
+	res.SetAPIVersion("v1")
+	res.SetKind("ConfigMap")
+	res.SetName("sample-config")
+	res.SetNamespace(harness.Namespace)
+	if len(conditions) > 0 {
+		res.Object["status"] = map[string]interface{}{"conditions": conditions}
+	}
+	return res
+}
+
+func startHandler(t *testing.T, objs ...runtime.Object) (*harness.Env, *harness.FakeHelm) {
+	env := harness.New(t, harness.Options{
+		Watched: widgets,
+		Kinds:   []harness.Kind{configMaps},
+		Objects: objs,
+	})
+	hc := harness.NewFakeHelm(t, manifest)
+
+	log := zerolog.Nop()
+	env.Start(controller.Options{
+		// The Ready condition is set by the Observe following
+		// the create completion, on resync.
+		ResyncInterval: 100 * time.Millisecond,
+		ExternalClient: NewHandler(nil, &log, archive.Static("oci://charts.example.com/widget"), HandlerOptions{
+			DynamicClient:     env.Dynamic,
+			DiscoveryClient:   env.Discovery,
+			HelmClientFactory: hc.Factory(),
+		}),
+	})
+
+	return env, hc
+}
+
+// readyCondition returns the status and the reason of the Ready condition.
+func readyCondition(el *unstructured.Unstructured) (string, string) {
+	all, _, _ := unstructured.NestedSlice(el.Object, "status", "conditions")
+	for _, co := range all {
+		co, ok := co.(map[string]interface{})
+		if ok && co["type"] == condition.TypeReady {
+			status, _ := co["status"].(string)
+			reason, _ := co["reason"].(string)
+			return status, reason
+		}
+	}
+	return "", ""
+}
+
+func TestHandlerLifecycle(t *testing.T) {
+	env, hc := startHandler(t, newConfigMap())
+
+	env.Create(env.NewObject("sample", map[string]interface{}{"value": "a"}))
+
+	el := env.Eventually("sample", func(el *unstructured.Unstructured) bool {
+		status, _ := readyCondition(el)
+		return status == "True"
+	})
+	assert.False(t, meta.ExternalCreateIncomplete(el))
+
+	rel := hc.Release("sample")
+	if assert.NotNil(t, rel) {
+		assert.Equal(t, harness.Namespace, rel.Namespace)
+	}
+	specs := hc.Specs()
+	if assert.NotEmpty(t, specs) {
+		assert.Equal(t, "oci://charts.example.com/widget", specs[0].ChartName)
+		assert.Equal(t, "value: a\n", specs[0].ValuesYaml)
+	}
+
+	env.Update("sample", func(el *unstructured.Unstructured) {
+		unstructured.SetNestedField(el.Object, "b", "spec", "value")
+	})
+	env.Wait("release upgrade", func() bool {
+		specs := hc.Specs()
+		return specs[len(specs)-1].ValuesYaml == "value: b\n"
+	})
+
+	env.Delete("sample")
+	env.Wait("release removal", func() bool {
+		return hc.Release("sample") == nil
+	})
+}
+
+func TestHandlerUnavailableResource(t *testing.T) {
+	env, _ := startHandler(t, newConfigMap(map[string]interface{}{
+		"type":   "Ready",
+		"status": "False",
+		"reason": "Broken",
+	}))
+
+	env.Create(env.NewObject("sample", map[string]interface{}{"value": "a"}))
+
+	el := env.Eventually("sample", func(el *unstructured.Unstructured) bool {
+		status, reason := readyCondition(el)
+		return status == "False" && reason == condition.ReasonUnavailable
+	})
+
+	ref, _, _ := unstructured.NestedStringMap(el.Object, "status", "failedObjectRef")
+	assert.Equal(t, map[string]string{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"name":       "sample-config",
+		"namespace":  harness.Namespace,
+	}, ref)
+}
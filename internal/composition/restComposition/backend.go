@@ -0,0 +1,122 @@
+package composition
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/backend"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/client"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/restclient"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/faults"
+	getter "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/restclient"
+)
+
+const (
+	// ParamHTTPTimeout is the backend parameter holding the http client timeout.
+	ParamHTTPTimeout = "httpTimeout"
+	// ParamHTTPMaxIdleConnsPerHost is the backend parameter holding
+	// the maximum number of idle connections per host.
+	ParamHTTPMaxIdleConnsPerHost = "httpMaxIdleConnsPerHost"
+	// ParamHTTPIdleConnTimeout is the backend parameter holding
+	// how long an idle connection is kept open.
+	ParamHTTPIdleConnTimeout = "httpIdleConnTimeout"
+	// ParamHTTPFaults is the backend parameter holding the faults to
+	// inject in the http calls (see faults.ParseSpec), for testing only.
+	ParamHTTPFaults = "httpFaults"
+	// ParamDocumentCacheTTL is the backend parameter holding how long
+	// the OpenAPI documents are used before being revalidated.
+	ParamDocumentCacheTTL = "documentCacheTTL"
+
+	defaultHTTPTimeout = 30 * time.Second
+)
+
+func init() {
+	backend.Register(client.ClientREST.String(), func(opts backend.Options) (controller.ExternalClient, error) {
+		swg, err := getter.Dynamic(opts.RESTConfig, opts.References)
+		if err != nil {
+			return nil, err
+		}
+
+		cli, newClient, err := httpClientFromParams(opts)
+		if err != nil {
+			return nil, err
+		}
+
+		docs := restclient.Documents
+		if ttl := opts.Param(ParamDocumentCacheTTL, ""); len(ttl) > 0 {
+			d, err := time.ParseDuration(ttl)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %w", ParamDocumentCacheTTL, err)
+			}
+			docs = restclient.NewDocumentCache(d)
+		}
+
+		return NewHandler(opts.RESTConfig, opts.Logger, swg, HandlerOptions{
+			HTTPClient: cli,
+			Clients:    restclient.NewClientPool(cli, newClient),
+			Documents:  docs,
+		}), nil
+	})
+}
+
+// httpClientFromParams returns the http client configured by the
+// http backend parameters and the function creating the ones with
+// a TLS configuration.
+func httpClientFromParams(opts backend.Options) (*http.Client, func(*tls.Config) *http.Client, error) {
+	timeout := opts.Param(ParamHTTPTimeout, "")
+	maxIdle := opts.Param(ParamHTTPMaxIdleConnsPerHost, "")
+	idleTimeout := opts.Param(ParamHTTPIdleConnTimeout, "")
+	faultSpec := opts.Param(ParamHTTPFaults, "")
+
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	cliTimeout := defaultHTTPTimeout
+
+	if len(timeout) > 0 {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: %w", ParamHTTPTimeout, err)
+		}
+		cliTimeout = d
+	}
+	if len(maxIdle) > 0 {
+		n, err := strconv.Atoi(maxIdle)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: %w", ParamHTTPMaxIdleConnsPerHost, err)
+		}
+		base.MaxIdleConnsPerHost = n
+	}
+	if len(idleTimeout) > 0 {
+		d, err := time.ParseDuration(idleTimeout)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: %w", ParamHTTPIdleConnTimeout, err)
+		}
+		base.IdleConnTimeout = d
+	}
+	var in *faults.Injector
+	if len(faultSpec) > 0 {
+		spec, err := faults.ParseSpec(faultSpec)
+		if err != nil {
+			return nil, nil, fmt.Errorf("invalid %s: %w", ParamHTTPFaults, err)
+		}
+		in = faults.New(spec)
+	}
+
+	newClient := func(tc *tls.Config) *http.Client {
+		tr := base
+		if tc != nil {
+			tr = base.Clone()
+			tr.TLSClientConfig = tc
+		}
+		cli := &http.Client{Transport: tr, Timeout: cliTimeout}
+		if in != nil {
+			cli.Transport = faults.NewTransport(tr, in)
+		}
+		return cli
+	}
+
+	return newClient(nil), newClient, nil
+}
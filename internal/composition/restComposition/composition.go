@@ -14,7 +14,6 @@ import (
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/restclient"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
-	"github.com/krateoplatformops/composition-dynamic-controller/internal/text"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/apiaction"
 	getter "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/restclient"
 	"github.com/lucasepe/httplib"
@@ -32,43 +31,88 @@ import (
 
 var _ controller.ExternalClient = (*handler)(nil)
 
-func NewHandler(cfg *rest.Config, log *zerolog.Logger, swg getter.Getter) controller.ExternalClient {
-	dyn, err := dynamic.NewForConfig(cfg)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Creating dynamic client.")
+type HandlerOptions struct {
+	// HTTPClient is the client used to call the external APIs.
+	// Defaults to a client with a defaultHTTPTimeout timeout; the
+	// calls are also bounded by the deadline of the operation ctx.
+	HTTPClient *http.Client
+	// Clients are the http clients of the calls with a TLS configuration.
+	// Defaults to clients as HTTPClient, with the TLS configuration.
+	Clients *restclient.ClientPool
+	// Documents caches the OpenAPI documents. Defaults to restclient.Documents.
+	Documents *restclient.DocumentCache
+	// DynamicClient defaults to a client built from the rest config.
+	DynamicClient dynamic.Interface
+	// DiscoveryClient defaults to a client built from the rest config.
+	DiscoveryClient discovery.DiscoveryInterface
+}
+
+func NewHandler(cfg *rest.Config, log *zerolog.Logger, swg getter.Getter, opts HandlerOptions) controller.ExternalClient {
+	var err error
+	if opts.DynamicClient == nil {
+		opts.DynamicClient, err = dynamic.NewForConfig(cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Creating dynamic client.")
+		}
 	}
 
-	dis, err := discovery.NewDiscoveryClientForConfig(cfg)
-	if err != nil {
-		log.Fatal().Err(err).Msg("Creating discovery client.")
+	if opts.DiscoveryClient == nil {
+		opts.DiscoveryClient, err = discovery.NewDiscoveryClientForConfig(cfg)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Creating discovery client.")
+		}
+	}
+
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{
+			Transport: http.DefaultTransport.(*http.Transport).Clone(),
+			Timeout:   defaultHTTPTimeout,
+		}
 	}
 
-	return &handler{
+	if opts.Clients == nil {
+		opts.Clients = restclient.NewClientPool(opts.HTTPClient, restclient.ClientWithTLS(opts.HTTPClient))
+	}
+
+	if opts.Documents == nil {
+		opts.Documents = restclient.Documents
+	}
+
+	h := &handler{
 		logger:            log,
-		dynamicClient:     dyn,
-		discoveryClient:   dis,
+		dynamicClient:     opts.DynamicClient,
+		discoveryClient:   opts.DiscoveryClient,
 		swaggerInfoGetter: swg,
+		clients:           opts.Clients,
+		documents:         opts.Documents,
+	}
+
+	return controller.Chain(h,
+		controller.WithLogging(log),
+		controller.WithPrecondition(h.check),
+	)
+}
+
+// check fails all the operations when the handler is not usable.
+func (h *handler) check(context.Context, *unstructured.Unstructured) error {
+	if h.swaggerInfoGetter == nil {
+		return fmt.Errorf("swagger info getter must be specified")
 	}
+	return nil
 }
 
 type handler struct {
 	logger            *zerolog.Logger
 	dynamicClient     dynamic.Interface
-	discoveryClient   *discovery.DiscoveryClient
+	discoveryClient   discovery.DiscoveryInterface
 	swaggerInfoGetter getter.Getter
+	clients           *restclient.ClientPool
+	documents         *restclient.DocumentCache
+	schemas           statusSchemas
 }
 
 func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (bool, error) {
-	log := h.logger.With().Timestamp().
-		Str("op", "Observe").
-		Str("apiVersion", mg.GetAPIVersion()).
-		Str("kind", mg.GetKind()).
-		Str("name", mg.GetName()).
-		Str("namespace", mg.GetNamespace()).Logger()
-
-	if h.swaggerInfoGetter == nil {
-		return false, fmt.Errorf("swagger file info getter must be specified")
-	}
+	log := zerolog.Ctx(ctx)
 	clientInfo, err := h.swaggerInfoGetter.Get(mg)
 	if err != nil {
 		log.Err(err).Msg("Getting REST client info")
@@ -99,7 +143,7 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 		DynamicClient:   h.dynamicClient,
 	})
 
-	cli, err := restclient.BuildClient(clientInfo.URL)
+	cli, err := h.documents.BuildClient(ctx, clientInfo.URL)
 	if err != nil {
 		log.Err(err).Msg("Building REST client")
 		return false, err
@@ -107,6 +151,37 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 	cli.Auth = clientInfo.Auth
 	cli.Verbose = meta.IsVerbose(mg)
 
+	httpClient, err := h.clients.Client(clientInfo.TLS)
+	if err != nil {
+		log.Err(err).Msg("Building HTTP client")
+		return false, err
+	}
+
+	// An accepted create or update completes before observing;
+	// an accepted deletion is awaited by Delete, not to create again.
+	op := operationOf(mg)
+	if op != nil && op.Action == apiaction.Delete {
+		log.Debug().Str("operation", op.URL).Msg("External resource deletion in progress.")
+		return true, nil
+	}
+	if op != nil {
+		res, err := h.await(ctx, mg, cli, httpClient, clientInfo, op)
+		if err != nil {
+			return false, err
+		}
+		_, callInfo, err := APICallBuilder(cli, clientInfo, op.Action)
+		if err != nil {
+			log.Err(err).Msg("Building API call")
+			return false, err
+		}
+		err = h.storeResponse(ctx, mg, clientInfo, callInfo, res)
+		if err != nil {
+			log.Err(err).Msg("Storing response fields")
+			return false, err
+		}
+		log.Debug().Str("operation", op.URL).Msg("Operation completed.")
+	}
+
 	specFields, err := unstructuredtools.GetFieldsFromUnstructured(mg, "spec")
 	if err != nil {
 		log.Err(err).Msg("Getting spec")
@@ -118,6 +193,7 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 		// return false, nil
 	}
 	var body *map[string]interface{}
+	var callInfo *CallInfo
 	isKnown := false
 	// If status is empty, the resource is not created yet.
 	for _, identifier := range clientInfo.Resource.Identifiers {
@@ -128,16 +204,18 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 	}
 	if isKnown {
 		// Getting the external resource by its identifier
-		apiCall, callInfo, err := APICallBuilder(cli, clientInfo, apiaction.Get)
+		var apiCall APIFuncDef
+		apiCall, callInfo, err = APICallBuilder(cli, clientInfo, apiaction.Get)
 		if err != nil {
 			log.Err(err).Msg("Building API call")
 			return false, err
 		}
-		reqConfiguration := BuildCallConfig(callInfo, statusFields, specFields)
-		if reqConfiguration == nil {
-			return false, fmt.Errorf("error building call configuration")
+		reqConfiguration, err := BuildCallConfig(callInfo, statusFields, specFields)
+		if err != nil {
+			log.Err(err).Msg("Building call configuration")
+			return false, err
 		}
-		body, err = apiCall(ctx, http.DefaultClient, callInfo.Path, reqConfiguration)
+		body, err = apiCall(ctx, httpClient, callInfo.Path, reqConfiguration)
 		if httplib.IsNotFoundError(err) {
 			log.Debug().Str("Resource", mg.GetKind()).Msg("External resource not found.")
 			return false, nil
@@ -150,21 +228,23 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 			return false, fmt.Errorf("response body is nil")
 		}
 	} else {
-		apiCall, callInfo, err := APICallBuilder(cli, clientInfo, apiaction.FindBy)
+		var apiCall APIFuncDef
+		apiCall, callInfo, err = APICallBuilder(cli, clientInfo, apiaction.FindBy)
 		if err != nil {
 			log.Err(err).Msg("Building API call")
 			return false, err
 		}
-		reqConfiguration := BuildCallConfig(callInfo, statusFields, specFields)
-		if reqConfiguration == nil {
-			return false, fmt.Errorf("error building call configuration")
+		reqConfiguration, err := BuildCallConfig(callInfo, statusFields, specFields)
+		if err != nil {
+			log.Err(err).Msg("Building call configuration")
+			return false, err
 		}
 		for _, identifier := range callInfo.IdentifierFields { //da rivedere la costruzione della query con i vari parametri.
 			if strIdentifier, ok := specFields[identifier].(string); ok {
 				reqConfiguration.Query[identifier] = strIdentifier
 			}
 		}
-		body, err = apiCall(ctx, http.DefaultClient, callInfo.Path, reqConfiguration)
+		body, err = apiCall(ctx, httpClient, callInfo.Path, reqConfiguration)
 		if httplib.IsNotFoundError(err) {
 			log.Debug().Str("Resource", mg.GetKind()).Msg("External resource not found.")
 			return false, nil
@@ -178,24 +258,9 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 		}
 	}
 
-	for k, v := range *body {
-		for _, identifier := range clientInfo.Resource.Identifiers {
-			if k == identifier {
-				err = unstructured.SetNestedField(mg.Object, text.GenericToString(v), "status", identifier)
-				if err != nil {
-					log.Err(err).Msg("Setting identifier")
-					return false, err
-				}
-				break
-			}
-		}
-	}
-	err = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
-	})
+	err = h.storeResponse(ctx, mg, clientInfo, callInfo, *body)
 	if err != nil {
-		log.Err(err).Msg("Updating status")
+		log.Err(err).Msg("Storing response fields")
 		return false, err
 	}
 
@@ -221,16 +286,7 @@ func (h *handler) Observe(ctx context.Context, mg *unstructured.Unstructured) (b
 }
 
 func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) error {
-	log := h.logger.With().Timestamp().
-		Str("op", "Create").
-		Str("apiVersion", mg.GetAPIVersion()).
-		Str("kind", mg.GetKind()).
-		Str("name", mg.GetName()).
-		Str("namespace", mg.GetNamespace()).Logger()
-
-	if h.swaggerInfoGetter == nil {
-		return fmt.Errorf("swagger info getter must be specified")
-	}
+	log := zerolog.Ctx(ctx)
 
 	clientInfo, err := h.swaggerInfoGetter.Get(mg)
 	if err != nil {
@@ -238,7 +294,7 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 		return err
 	}
 
-	cli, err := restclient.BuildClient(clientInfo.URL)
+	cli, err := h.documents.BuildClient(ctx, clientInfo.URL)
 	if err != nil {
 		log.Err(err).Msg("Building REST client")
 		return err
@@ -246,6 +302,12 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 	cli.Auth = clientInfo.Auth
 	cli.Verbose = meta.IsVerbose(mg)
 
+	httpClient, err := h.clients.Client(clientInfo.TLS)
+	if err != nil {
+		log.Err(err).Msg("Building HTTP client")
+		return err
+	}
+
 	specFields, err := unstructuredtools.GetFieldsFromUnstructured(mg, "spec")
 	if err != nil {
 		log.Err(err).Msg("Getting spec")
@@ -256,8 +318,19 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 		log.Err(err).Msg("Building API call")
 		return err
 	}
-	reqConfiguration := BuildCallConfig(callInfo, nil, specFields)
-	body, err := apiCall(ctx, http.DefaultClient, callInfo.Path, reqConfiguration)
+	reqConfiguration, err := BuildCallConfig(callInfo, nil, specFields)
+	if err != nil {
+		log.Err(err).Msg("Building call configuration")
+		return err
+	}
+	body, err := apiCall(ctx, httpClient, callInfo.Path, reqConfiguration)
+	if acc, ok := restclient.IsAccepted(err); ok {
+		if len(acc.OperationURL) > 0 {
+			// Observed once the operation completes.
+			return recordOperation(ctx, mg, apiaction.Create, acc)
+		}
+		body, err = &acc.Body, nil
+	}
 	if err != nil {
 		log.Err(err).Msg("Performing REST call")
 		return err
@@ -266,52 +339,28 @@ func (h *handler) Create(ctx context.Context, mg *unstructured.Unstructured) err
 		return fmt.Errorf("response body is nil")
 	}
 
-	for k, v := range *body {
-		for _, identifier := range clientInfo.Resource.Identifiers {
-			if k == identifier {
-				err = unstructured.SetNestedField(mg.Object, text.GenericToString(v), "status", identifier)
-				if err != nil {
-					log.Err(err).Msg("Setting identifier")
-					return err
-				}
-			}
-		}
-	}
-
-	log.Debug().Str("Resource", mg.GetKind()).Msg("Creating external resource.")
-
-	err = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
-	})
+	err = h.storeResponse(ctx, mg, clientInfo, callInfo, *body)
 	if err != nil {
-		log.Err(err).Msg("Updating status")
+		log.Err(err).Msg("Storing response fields")
 		return err
 	}
 
+	log.Debug().Str("Resource", mg.GetKind()).Msg("Creating external resource.")
+
 	return nil
 }
 
 func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) error {
-	log := h.logger.With().
-		Str("op", "Update").
-		Str("apiVersion", mg.GetAPIVersion()).
-		Str("kind", mg.GetKind()).
-		Str("name", mg.GetName()).
-		Str("namespace", mg.GetNamespace()).Logger()
+	log := zerolog.Ctx(ctx)
 
 	log.Debug().Msg("Handling composition values update.")
-	if h.swaggerInfoGetter == nil {
-		return fmt.Errorf("swagger info getter must be specified")
-	}
-
 	clientInfo, err := h.swaggerInfoGetter.Get(mg)
 	if err != nil {
 		log.Err(err).Msg("Getting REST client info")
 		return err
 	}
 
-	cli, err := restclient.BuildClient(clientInfo.URL)
+	cli, err := h.documents.BuildClient(ctx, clientInfo.URL)
 	if err != nil {
 		log.Err(err).Msg("Building REST client")
 		return err
@@ -319,6 +368,12 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 	cli.Auth = clientInfo.Auth
 	cli.Verbose = meta.IsVerbose(mg)
 
+	httpClient, err := h.clients.Client(clientInfo.TLS)
+	if err != nil {
+		log.Err(err).Msg("Building HTTP client")
+		return err
+	}
+
 	specFields, err := unstructuredtools.GetFieldsFromUnstructured(mg, "spec")
 	if err != nil {
 		log.Err(err).Msg("Getting spec")
@@ -335,8 +390,19 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 		log.Debug().Str("Resource", mg.GetKind()).Msg("External resource not created yet.")
 		return err
 	}
-	reqConfiguration := BuildCallConfig(callInfo, statusFields, specFields)
-	body, err := apiCall(ctx, http.DefaultClient, callInfo.Path, reqConfiguration)
+	reqConfiguration, err := BuildCallConfig(callInfo, statusFields, specFields)
+	if err != nil {
+		log.Err(err).Msg("Building call configuration")
+		return err
+	}
+	body, err := apiCall(ctx, httpClient, callInfo.Path, reqConfiguration)
+	if acc, ok := restclient.IsAccepted(err); ok {
+		if len(acc.OperationURL) > 0 {
+			// Observed once the operation completes.
+			return recordOperation(ctx, mg, apiaction.Update, acc)
+		}
+		body, err = &acc.Body, nil
+	}
 	if err != nil {
 		log.Err(err).Msg("Performing REST call")
 		return err
@@ -345,28 +411,13 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 		return fmt.Errorf("response body is nil")
 	}
 
-	for k, v := range *body {
-		for _, identifier := range clientInfo.Resource.Identifiers {
-			if k == identifier {
-				err = unstructured.SetNestedField(mg.Object, text.GenericToString(v), "status", identifier)
-				if err != nil {
-					log.Err(err).Msg("Setting identifier")
-					return err
-				}
-			}
-		}
-	}
-
-	log.Debug().Str("Resource", mg.GetKind()).Msg("Creating external resource.")
-
-	err = tools.UpdateStatus(ctx, mg, tools.UpdateOptions{
-		DiscoveryClient: h.discoveryClient,
-		DynamicClient:   h.dynamicClient,
-	})
+	err = h.storeResponse(ctx, mg, clientInfo, callInfo, *body)
 	if err != nil {
-		log.Err(err).Msg("Updating status")
+		log.Err(err).Msg("Storing response fields")
 		return err
 	}
+
+	log.Debug().Str("Resource", mg.GetKind()).Msg("Creating external resource.")
 	log.Debug().Str("kind", mg.GetKind()).Msg("Composition values updated.")
 
 	return nil
@@ -374,58 +425,80 @@ func (h *handler) Update(ctx context.Context, mg *unstructured.Unstructured) err
 }
 
 func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) error {
-	log := h.logger.With().
-		Str("op", "Delete").
-		Str("apiVersion", mg.GetAPIVersion()).
-		Str("kind", mg.GetKind()).
-		Str("name", mg.GetName()).
-		Str("namespace", mg.GetNamespace()).Logger()
+	log := zerolog.Ctx(ctx)
 
 	log.Debug().Msg("Handling composition values deletion.")
 
-	if h.swaggerInfoGetter == nil {
-		return fmt.Errorf("swagger info getter must be specified")
-	}
-
 	clientInfo, err := h.swaggerInfoGetter.Get(mg)
 	if err != nil {
 		log.Err(err).Msg("Getting REST client info")
 		return err
 	}
 
-	cli, err := restclient.BuildClient(clientInfo.URL)
+	cli, err := h.documents.BuildClient(ctx, clientInfo.URL)
 	if err != nil {
 		log.Err(err).Msg("Building REST client")
 		return err
 	}
 	cli.Auth = clientInfo.Auth
-	cli.Verbose = true
+	cli.Verbose = meta.IsVerbose(mg)
 
-	specFields, err := unstructuredtools.GetFieldsFromUnstructured(mg, "spec")
-	if err != nil {
-		log.Err(err).Msg("Getting spec")
-		return err
-	}
-	statusFields, err := unstructuredtools.GetFieldsFromUnstructured(mg, "status")
-	if err != nil {
-		log.Err(err).Msg("Getting status")
-		return err
-	}
-	apiCall, callInfo, err := APICallBuilder(cli, clientInfo, apiaction.Delete)
+	httpClient, err := h.clients.Client(clientInfo.TLS)
 	if err != nil {
-		log.Err(err).Msg("Building API call")
+		log.Err(err).Msg("Building HTTP client")
 		return err
 	}
-	reqConfiguration := BuildCallConfig(callInfo, statusFields, specFields)
-	if reqConfiguration == nil {
-		return fmt.Errorf("error building call configuration")
-	}
 
-	_, err = apiCall(ctx, http.DefaultClient, callInfo.Path, reqConfiguration)
-	// if err != nil {
-	// 	log.Err(err).Msg("Performing REST call")
-	// 	return err
-	// }
+	// The finalizer is removed once an accepted deletion completes.
+	if op := operationOf(mg); op != nil && op.Action == apiaction.Delete {
+		if _, err := h.await(ctx, mg, cli, httpClient, clientInfo, op); err != nil {
+			return err
+		}
+	} else {
+		specFields, err := unstructuredtools.GetFieldsFromUnstructured(mg, "spec")
+		if err != nil {
+			log.Err(err).Msg("Getting spec")
+			return err
+		}
+		statusFields, err := unstructuredtools.GetFieldsFromUnstructured(mg, "status")
+		if err != nil {
+			log.Err(err).Msg("Getting status")
+			return err
+		}
+		apiCall, callInfo, err := APICallBuilder(cli, clientInfo, apiaction.Delete)
+		if err != nil {
+			log.Err(err).Msg("Building API call")
+			return err
+		}
+		reqConfiguration, err := BuildCallConfig(callInfo, statusFields, specFields)
+		if err != nil {
+			log.Err(err).Msg("Building call configuration")
+			return err
+		}
+
+		_, err = apiCall(ctx, httpClient, callInfo.Path, reqConfiguration)
+		if acc, ok := restclient.IsAccepted(err); ok {
+			// Without an operation there is nothing to wait for.
+			err = nil
+			if len(acc.OperationURL) > 0 {
+				if err := recordOperation(ctx, mg, apiaction.Delete, acc); err != nil {
+					log.Err(err).Msg("Recording the operation")
+					return err
+				}
+				// Persisted by the controller status middleware.
+				return controller.RequeueAfter(acc.RetryAfter, "Waiting for the deletion "+acc.OperationURL)
+			}
+		}
+		if httplib.IsNotFoundError(err) {
+			log.Debug().Str("Resource", mg.GetKind()).Msg("External resource already deleted.")
+			err = nil
+		}
+		if err != nil {
+			// The finalizer is kept: the external resource may still exist.
+			log.Err(err).Msg("Performing REST call")
+			return err
+		}
+	}
 
 	log.Debug().Str("Resource", mg.GetKind()).Msg("Deleting external resource.")
 
@@ -435,7 +508,7 @@ func (h *handler) Delete(ctx context.Context, mg *unstructured.Unstructured) err
 		DiscoveryClient: h.discoveryClient,
 		DynamicClient:   h.dynamicClient,
 	})
-	if err != nil {
+	if err != nil && !apierrors.IsNotFound(err) {
 		log.Err(err).Msg("Deleting finalizer")
 		return err
 	}
@@ -0,0 +1,99 @@
+package composition
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/harness"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var widgets = harness.Kind{
+	GVR:  schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1", Resource: "widgets"},
+	Kind: "Widget",
+}
+
+func TestHandlerLifecycle(t *testing.T) {
+	env := harness.New(t, harness.Options{Watched: widgets})
+	srv := harness.NewOpenAPIServer(t)
+
+	log := zerolog.Nop()
+	env.Start(controller.Options{
+		ExternalClient: NewHandler(nil, &log, srv.Getter("Widget"), HandlerOptions{
+			DynamicClient:   env.Dynamic,
+			DiscoveryClient: env.Discovery,
+		}),
+	})
+
+	env.Create(env.NewObject("sample", map[string]interface{}{
+		"name":  "sample",
+		"value": "a",
+	}))
+
+	env.Eventually("sample", func(el *unstructured.Unstructured) bool {
+		id, _, _ := unstructured.NestedString(el.Object, "status", "id")
+		return id == "1"
+	})
+	items := srv.Items()
+	if assert.Equal(t, 1, len(items)) {
+		assert.Equal(t, "sample", items[0]["name"])
+		assert.Equal(t, "a", items[0]["value"])
+	}
+
+	env.Update("sample", func(el *unstructured.Unstructured) {
+		unstructured.SetNestedField(el.Object, "b", "spec", "value")
+	})
+	env.Wait("remote update", func() bool {
+		items := srv.Items()
+		return len(items) == 1 && items[0]["value"] == "b"
+	})
+	assert.Contains(t, srv.Requests(), "PATCH /resources/1")
+
+	env.Delete("sample")
+	env.Gone("sample")
+	assert.Empty(t, srv.Items())
+}
+
+func TestHandlerKeepsFinalizerOnFailedDelete(t *testing.T) {
+	env := harness.New(t, harness.Options{Watched: widgets})
+	srv := harness.NewOpenAPIServer(t)
+
+	log := zerolog.Nop()
+	env.Start(controller.Options{
+		ExternalClient: NewHandler(nil, &log, srv.Getter("Widget"), HandlerOptions{
+			DynamicClient:   env.Dynamic,
+			DiscoveryClient: env.Discovery,
+		}),
+	})
+
+	env.Create(env.NewObject("sample", map[string]interface{}{
+		"name":  "sample",
+		"value": "a",
+	}))
+	env.Eventually("sample", func(el *unstructured.Unstructured) bool {
+		id, _, _ := unstructured.NestedString(el.Object, "status", "id")
+		return id == "1"
+	})
+
+	srv.FailDeletes(http.StatusInternalServerError)
+	env.Delete("sample")
+	env.Wait("retried delete", func() bool {
+		n := 0
+		for _, el := range srv.Requests() {
+			if el == "DELETE /resources/1" {
+				n++
+			}
+		}
+		return n > 1
+	})
+	assert.NotNil(t, env.Get("sample"))
+	assert.Equal(t, 1, len(srv.Items()))
+
+	srv.FailDeletes(0)
+	env.Gone("sample")
+	assert.Empty(t, srv.Items())
+}
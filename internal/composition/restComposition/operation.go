@@ -0,0 +1,105 @@
+package composition
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/restclient"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/text"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/apiaction"
+	getter "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/restclient"
+	"github.com/rs/zerolog"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// statusOperation is the status field recording the long-running
+// operation of the external API started by a create, update or delete.
+const statusOperation = "operation"
+
+// operation is a long-running operation recorded in the status.
+type operation struct {
+	Action apiaction.APIAction
+	URL    string
+}
+
+// operationOf returns the operation recorded in the status of mg, if any.
+func operationOf(mg *unstructured.Unstructured) *operation {
+	m, ok, err := unstructured.NestedStringMap(mg.Object, "status", statusOperation)
+	if err != nil || !ok || len(m["url"]) == 0 {
+		return nil
+	}
+	return &operation{Action: apiaction.APIAction(m["action"]), URL: m["url"]}
+}
+
+// storeResponse copies the identifiers, the mapped and the
+// projected fields of the response body into the status of mg.
+func (h *handler) storeResponse(ctx context.Context, mg *unstructured.Unstructured, clientInfo *getter.Info, callInfo *CallInfo, body map[string]interface{}) error {
+	for k, v := range body {
+		for _, identifier := range clientInfo.Resource.Identifiers {
+			if k == identifier {
+				err := unstructured.SetNestedField(mg.Object, text.GenericToString(v), "status", identifier)
+				if err != nil {
+					return err
+				}
+				break
+			}
+		}
+	}
+	if err := processResponseMapping(callInfo, mg, body); err != nil {
+		return err
+	}
+	return h.projectStatus(ctx, mg, clientInfo.Resource.StatusFields, body)
+}
+
+// recordOperation records the operation of an accepted request in the status of mg.
+func recordOperation(ctx context.Context, mg *unstructured.Unstructured, action apiaction.APIAction, acc *restclient.Accepted) error {
+	err := unstructured.SetNestedStringMap(mg.Object, map[string]string{
+		"action": action.String(),
+		"url":    acc.OperationURL,
+	}, "status", statusOperation)
+	if err != nil {
+		return err
+	}
+
+	zerolog.Ctx(ctx).Debug().Str("operation", acc.OperationURL).
+		Str("action", action.String()).
+		Msg("Request accepted, waiting for the operation.")
+	return nil
+}
+
+// await polls the operation recorded in the status of mg. Once completed,
+// it returns its result and removes it from the status; while running, a
+// controller.RequeueError. A failed operation is removed from the status
+// as well, for the action to be tried again.
+func (h *handler) await(ctx context.Context, mg *unstructured.Unstructured, cli *restclient.UnstructuredClient, httpClient *http.Client, clientInfo *getter.Info, op *operation) (map[string]interface{}, error) {
+	res, next, err := cli.Poll(ctx, httpClient, op.URL, pollingOf(clientInfo, op.Action))
+	if errors.Is(err, restclient.ErrOperationFailed) {
+		unstructured.RemoveNestedField(mg.Object, "status", statusOperation)
+		return nil, err
+	}
+	if err != nil {
+		return nil, err
+	}
+	if res == nil {
+		return nil, controller.RequeueAfter(next, "Waiting for the operation "+op.URL)
+	}
+
+	unstructured.RemoveNestedField(mg.Object, "status", statusOperation)
+	if *res == nil {
+		return map[string]interface{}{}, nil
+	}
+	return *res, nil
+}
+
+// pollingOf returns the polling configuration of the action.
+func pollingOf(clientInfo *getter.Info, action apiaction.APIAction) *restclient.Polling {
+	for _, descr := range clientInfo.Resource.VerbsDescription {
+		if strings.EqualFold(descr.Action, action.String()) {
+			return descr.Polling
+		}
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package composition
+
+import (
+	"testing"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/restclient"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/apiaction"
+	getter "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/restclient"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestOperationOf(t *testing.T) {
+	mg := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	assert.Nil(t, operationOf(mg))
+
+	mg.Object["status"] = map[string]interface{}{
+		"id": "1",
+		"operation": map[string]interface{}{
+			"action": "delete",
+			"url":    "https://dev.azure.com/krateo/_apis/operations/1",
+		},
+	}
+	assert.Equal(t, &operation{
+		Action: apiaction.Delete,
+		URL:    "https://dev.azure.com/krateo/_apis/operations/1",
+	}, operationOf(mg))
+}
+
+func TestPollingOf(t *testing.T) {
+	polling := &restclient.Polling{StatusPath: "state"}
+	info := &getter.Info{Resource: getter.Resource{
+		VerbsDescription: []getter.VerbsDescription{
+			{Action: "create", Method: "POST", Path: "/feeds", Polling: polling},
+			{Action: "delete", Method: "DELETE", Path: "/feeds/{id}"},
+		},
+	}}
+
+	assert.Same(t, polling, pollingOf(info, apiaction.Create))
+	assert.Nil(t, pollingOf(info, apiaction.Delete))
+	assert.Nil(t, pollingOf(info, apiaction.Update))
+}
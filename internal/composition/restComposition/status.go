@@ -0,0 +1,267 @@
+package composition
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/text"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/mapping"
+	unstructuredtools "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured"
+	"github.com/rs/zerolog"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+// statusSchemaTTL is how long the status schemas of the CRDs are cached.
+const statusSchemaTTL = time.Minute
+
+var gvrForCRDs = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// statusSchemas caches the openAPIV3Schema of the status of the CRDs.
+type statusSchemas struct {
+	mu      sync.Mutex
+	entries map[schema.GroupVersionResource]statusSchema
+}
+
+type statusSchema struct {
+	// schema is nil when the CRD is unknown.
+	schema map[string]interface{}
+	expiry time.Time
+}
+
+// get returns the status schema of the version of the resource,
+// nil if its CRD is not found or does not constrain the status.
+func (s *statusSchemas) get(ctx context.Context, dyn dynamic.Interface, mg *unstructured.Unstructured) (map[string]interface{}, error) {
+	if dyn == nil {
+		return nil, nil
+	}
+	gvr, err := unstructuredtools.GVR(mg)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	el, ok := s.entries[gvr]
+	s.mu.Unlock()
+	if ok && time.Now().Before(el.expiry) {
+		return el.schema, nil
+	}
+
+	crd, err := dyn.Resource(gvrForCRDs).
+		Get(ctx, gvr.GroupResource().String(), metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return nil, err
+	}
+	el = statusSchema{expiry: time.Now().Add(statusSchemaTTL)}
+	if err == nil {
+		versions, _, _ := unstructured.NestedSlice(crd.Object, "spec", "versions")
+		for _, v := range versions {
+			ver, ok := v.(map[string]interface{})
+			if !ok || ver["name"] != gvr.Version {
+				continue
+			}
+			root, _, _ := unstructured.NestedMap(ver, "schema", "openAPIV3Schema")
+			el.schema, _, _ = unstructured.NestedMap(root, "properties", "status")
+			if el.schema == nil && !preservesUnknownFields(root) {
+				// The status is not declared: all its fields are pruned.
+				el.schema = map[string]interface{}{}
+			}
+		}
+	}
+
+	s.mu.Lock()
+	if s.entries == nil {
+		s.entries = map[schema.GroupVersionResource]statusSchema{}
+	}
+	s.entries[gvr] = el
+	s.mu.Unlock()
+	return el.schema, nil
+}
+
+// projectStatus copies the fields of the response body into the status
+// of mg, checked against the status schema of its CRD.
+func (h *handler) projectStatus(ctx context.Context, mg *unstructured.Unstructured, fields []string, body map[string]interface{}) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	sch, err := h.schemas.get(ctx, h.dynamicClient, mg)
+	if err != nil {
+		return err
+	}
+
+	skipped, err := projectFields(mg, fields, body, sch)
+	if len(skipped) > 0 {
+		zerolog.Ctx(ctx).Warn().Strs("fields", skipped).
+			Msg("Response fields not matching the status schema.")
+	}
+	return err
+}
+
+// projectFields copies the fields of the response body into the status of mg,
+// keeping their JSON types. A field null in the response is removed from the
+// status, a missing one is left untouched. When sch is not nil the values are
+// converted to the types of the status schema; the ones that can't be, or
+// that the schema does not declare, are skipped and returned.
+func projectFields(mg *unstructured.Unstructured, fields []string, body map[string]interface{}, sch map[string]interface{}) ([]string, error) {
+	var skipped []string
+	for _, field := range fields {
+		path := strings.Split(field, ".")
+		value, ok, err := unstructured.NestedFieldNoCopy(body, path...)
+		if err != nil || !ok {
+			continue
+		}
+		if value == nil {
+			unstructured.RemoveNestedField(mg.Object, append([]string{"status"}, path...)...)
+			continue
+		}
+
+		if sch != nil {
+			fieldSchema, allowed := schemaAt(sch, path)
+			if !allowed {
+				skipped = append(skipped, field)
+				continue
+			}
+			if value, ok = conform(value, fieldSchema); !ok {
+				skipped = append(skipped, field)
+				continue
+			}
+		}
+
+		status, _, err := unstructured.NestedMap(mg.Object, "status")
+		if err != nil {
+			return skipped, err
+		}
+		if status == nil {
+			status = map[string]interface{}{}
+		}
+		if err := mapping.SetField(status, field, runtime.DeepCopyJSONValue(value)); err != nil {
+			return skipped, fmt.Errorf("projecting %q: %w", field, err)
+		}
+		if err := unstructured.SetNestedMap(mg.Object, status, "status"); err != nil {
+			return skipped, err
+		}
+	}
+	return skipped, nil
+}
+
+// schemaAt returns the schema of the nested field, false if the
+// schema does not allow it; a nil schema allows any value.
+func schemaAt(sch map[string]interface{}, path []string) (map[string]interface{}, bool) {
+	for _, el := range path {
+		if sch == nil {
+			return nil, true
+		}
+		if sub, ok, _ := unstructured.NestedMap(sch, "properties", el); ok {
+			sch = sub
+			continue
+		}
+		if sub, ok, _ := unstructured.NestedMap(sch, "additionalProperties"); ok {
+			sch = sub
+			continue
+		}
+		if preservesUnknownFields(sch) {
+			sch = nil
+			continue
+		}
+		return nil, false
+	}
+	return sch, true
+}
+
+// conform converts the value to the type of the schema, dropping the
+// object fields that the schema does not declare; false if not possible.
+func conform(value interface{}, sch map[string]interface{}) (interface{}, bool) {
+	if sch == nil || value == nil {
+		return value, true
+	}
+
+	typ, _ := sch["type"].(string)
+	if len(typ) == 0 {
+		if intOrString, _ := sch["x-kubernetes-int-or-string"].(bool); intOrString {
+			if s, ok := value.(string); ok {
+				return s, true
+			}
+			return conform(value, map[string]interface{}{"type": "integer"})
+		}
+		if preservesUnknownFields(sch) {
+			return value, true
+		}
+	}
+
+	switch typ {
+	case "string":
+		switch v := value.(type) {
+		case string:
+			return v, true
+		case bool, float64, int64:
+			return text.GenericToString(v), true
+		}
+	case "integer":
+		switch v := value.(type) {
+		case int64:
+			return v, true
+		case float64:
+			if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+				return int64(v), true
+			}
+		}
+	case "number":
+		switch v := value.(type) {
+		case int64, float64:
+			return v, true
+		}
+	case "boolean":
+		if v, ok := value.(bool); ok {
+			return v, true
+		}
+	case "array":
+		v, ok := value.([]interface{})
+		if !ok {
+			return nil, false
+		}
+		items, _, _ := unstructured.NestedMap(sch, "items")
+		res := make([]interface{}, 0, len(v))
+		for _, el := range v {
+			conv, ok := conform(el, items)
+			if !ok {
+				return nil, false
+			}
+			res = append(res, conv)
+		}
+		return res, true
+	case "object", "":
+		v, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		res := make(map[string]interface{}, len(v))
+		for k, el := range v {
+			fieldSchema, allowed := schemaAt(sch, []string{k})
+			if !allowed {
+				continue
+			}
+			if conv, ok := conform(el, fieldSchema); ok {
+				res[k] = conv
+			}
+		}
+		return res, true
+	}
+	return nil, false
+}
+
+func preservesUnknownFields(sch map[string]interface{}) bool {
+	res, _ := sch["x-kubernetes-preserve-unknown-fields"].(bool)
+	return res
+}
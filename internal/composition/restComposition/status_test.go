@@ -0,0 +1,159 @@
+package composition
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func repoCRD(status map[string]interface{}) *unstructured.Unstructured {
+	schema := map[string]interface{}{"type": "object"}
+	if status != nil {
+		schema["properties"] = map[string]interface{}{"status": status}
+	}
+	res := &unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"group": "github.krateo.io",
+			"versions": []interface{}{
+				map[string]interface{}{
+					"name":   "v1alpha1",
+					"schema": map[string]interface{}{"openAPIV3Schema": schema},
+				},
+			},
+		},
+	}}
+	res.SetAPIVersion("apiextensions.k8s.io/v1")
+	res.SetKind("CustomResourceDefinition")
+	res.SetName("repoes.github.krateo.io")
+	return res
+}
+
+func repo() *unstructured.Unstructured {
+	res := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{"id": "1", "closed_at": "2024-01-01T00:00:00Z"},
+	}}
+	res.SetAPIVersion("github.krateo.io/v1alpha1")
+	res.SetKind("Repo")
+	res.SetName("sample")
+	return res
+}
+
+var repoResponse = map[string]interface{}{
+	"id":        float64(1),
+	"html_url":  "https://github.com/krateoplatformops/sample",
+	"private":   true,
+	"size":      float64(42),
+	"closed_at": nil,
+	"owner": map[string]interface{}{
+		"login": "krateoplatformops",
+		"id":    float64(7),
+	},
+	"topics": []interface{}{"krateo", "sample"},
+}
+
+func TestProjectStatus(t *testing.T) {
+	fields := []string{"html_url", "private", "size", "closed_at", "owner", "topics", "id", "missing"}
+
+	table := []struct {
+		name    string
+		crd     *unstructured.Unstructured
+		status  map[string]interface{}
+		skipped []string
+	}{
+		{
+			name: "no CRD",
+			status: map[string]interface{}{
+				"id":       float64(1),
+				"html_url": "https://github.com/krateoplatformops/sample",
+				"private":  true,
+				"size":     float64(42),
+				"owner":    map[string]interface{}{"login": "krateoplatformops", "id": float64(7)},
+				"topics":   []interface{}{"krateo", "sample"},
+			},
+		},
+		{
+			name: "status schema",
+			crd: repoCRD(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"id":       map[string]interface{}{"type": "string"},
+					"html_url": map[string]interface{}{"type": "string"},
+					"private":  map[string]interface{}{"type": "string"},
+					"size":     map[string]interface{}{"type": "integer"},
+					"owner": map[string]interface{}{
+						"type": "object",
+						"properties": map[string]interface{}{
+							"login": map[string]interface{}{"type": "string"},
+						},
+					},
+					"topics": map[string]interface{}{
+						"type":  "array",
+						"items": map[string]interface{}{"type": "integer"},
+					},
+				},
+			}),
+			status: map[string]interface{}{
+				"id":       "1",
+				"html_url": "https://github.com/krateoplatformops/sample",
+				"private":  "true",
+				"size":     int64(42),
+				"owner":    map[string]interface{}{"login": "krateoplatformops"},
+			},
+			skipped: []string{"topics"},
+		},
+		{
+			name: "status not declared",
+			crd:  repoCRD(nil),
+			status: map[string]interface{}{
+				"id": "1",
+			},
+			skipped: []string{"html_url", "private", "size", "owner", "topics", "id"},
+		},
+	}
+
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			objs := []runtime.Object{}
+			if tc.crd != nil {
+				objs = append(objs, tc.crd)
+			}
+			h := &handler{dynamicClient: fake.NewSimpleDynamicClient(runtime.NewScheme(), objs...)}
+
+			mg := repo()
+			sch, err := h.schemas.get(context.Background(), h.dynamicClient, mg)
+			if !assert.NoError(t, err) {
+				return
+			}
+			skipped, err := projectFields(mg, fields, repoResponse, sch)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.skipped, skipped)
+			assert.Equal(t, tc.status, mg.Object["status"])
+		})
+	}
+}
+
+func TestConform(t *testing.T) {
+	intOrString := map[string]interface{}{"x-kubernetes-int-or-string": true}
+	conv, ok := conform(float64(8080), intOrString)
+	assert.True(t, ok)
+	assert.Equal(t, int64(8080), conv)
+	conv, ok = conform("http", intOrString)
+	assert.True(t, ok)
+	assert.Equal(t, "http", conv)
+
+	_, ok = conform(1.5, map[string]interface{}{"type": "integer"})
+	assert.False(t, ok)
+	_, ok = conform(map[string]interface{}{}, map[string]interface{}{"type": "string"})
+	assert.False(t, ok)
+
+	conv, ok = conform(map[string]interface{}{"a": "b"}, map[string]interface{}{
+		"type":                                 "object",
+		"x-kubernetes-preserve-unknown-fields": true,
+	})
+	assert.True(t, ok)
+	assert.Equal(t, map[string]interface{}{"a": "b"}, conv)
+}
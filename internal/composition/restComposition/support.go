@@ -11,10 +11,12 @@ import (
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/restclient"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/text"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/apiaction"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/mapping"
 	getter "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/restclient"
 	unstructuredtools "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
 )
@@ -30,6 +32,10 @@ type CallInfo struct {
 	ReqParams        *RequestedParams
 	IdentifierFields []string
 	AltFields        map[string]string
+	Pagination       *restclient.Pagination
+	Polling          *restclient.Polling
+	RequestMapping   []mapping.Mapping
+	ResponseMapping  []mapping.Mapping
 }
 
 type APIFuncDef func(ctx context.Context, cli *http.Client, path string, conf *restclient.RequestConfiguration) (*map[string]interface{}, error)
@@ -50,7 +56,8 @@ func APICallBuilder(cli *restclient.UnstructuredClient, info *getter.Info, actio
 				return nil, nil, fmt.Errorf("error retrieving requested params: %s", err)
 			}
 			var body text.StringSet
-			if descr.Method == "POST" || descr.Method == "PUT" || descr.Method == "PATCH" {
+			switch method {
+			case restclient.APICallsTypePost, restclient.APICallsTypePut, restclient.APICallsTypePatch:
 				body, err = cli.RequestedBody(descr.Method, descr.Path)
 				if err != nil {
 					return nil, nil, fmt.Errorf("error retrieving requested body params: %s", err)
@@ -66,6 +73,10 @@ func APICallBuilder(cli *restclient.UnstructuredClient, info *getter.Info, actio
 				},
 				AltFields:        descr.AltFieldMapping,
 				IdentifierFields: identifierFields,
+				Pagination:       descr.Pagination,
+				Polling:          descr.Polling,
+				RequestMapping:   descr.RequestFieldMapping,
+				ResponseMapping:  descr.ResponseFieldMapping,
 			}
 			switch method {
 			case restclient.APICallsTypeGet:
@@ -78,6 +89,10 @@ func APICallBuilder(cli *restclient.UnstructuredClient, info *getter.Info, actio
 				return cli.Delete, callInfo, nil
 			case restclient.APICallsTypePatch:
 				return cli.Patch, callInfo, nil
+			case restclient.APICallsTypePut:
+				return cli.Put, callInfo, nil
+			case restclient.APICallsTypeHead:
+				return cli.Head, callInfo, nil
 			case restclient.APICallsTypeFindBy:
 				return cli.FindBy, callInfo, nil
 			}
@@ -86,56 +101,22 @@ func APICallBuilder(cli *restclient.UnstructuredClient, info *getter.Info, actio
 	return nil, nil, fmt.Errorf("impossible to build api call for action %s", action.String())
 }
 
-func BuildCallConfig(callInfo *CallInfo, statusFields map[string]interface{}, specFields map[string]interface{}) *restclient.RequestConfiguration {
+func BuildCallConfig(callInfo *CallInfo, statusFields map[string]interface{}, specFields map[string]interface{}) (*restclient.RequestConfiguration, error) {
 	reqConfiguration := &restclient.RequestConfiguration{}
 	reqConfiguration.Parameters = make(map[string]string)
 	reqConfiguration.Query = make(map[string]string)
 	mapBody := make(map[string]interface{})
 
-	// for field, value := range specFields {
-	// 	field, value = processAltFields(callInfo, field, value)
-	// 	if callInfo.ReqParams.Parameters.Contains(field) {
-	// 		stringVal := fmt.Sprintf("%v", value)
-	// 		reqConfiguration.Parameters[field] = stringVal
-	// 	} else if callInfo.ReqParams.Query.Contains(field) {
-	// 		stringVal := fmt.Sprintf("%v", value)
-	// 		reqConfiguration.Query[field] = stringVal
-	// 	} else if callInfo.ReqParams.Body.Contains(field) {
-	// 		mapBody[field] = value
-	// 	}
-	// }
-	// for field, value := range statusFields {
-	// 	// for k := range callInfo.AltFields {
-	// 	// 	fields := strings.Split(k, ".")
-	// 	// 	for _, field := range fields {
-	// 	// 		mapval, ok := value.(map[string]interface{})
-	// 	// 		if ok {
-	// 	// 			val, ok := mapval[field]
-	// 	// 			if ok {
-	// 	// 				value = val
-	// 	// 			}
-	// 	// 		}
-	// 	// 	}
-	// 	// }
-	// 	// f, ok := callInfo.AltFields[field]
-	// 	// if ok {
-	// 	// 	field = f
-	// 	// }
-	// 	field, value = processAltFields(callInfo, field, value)
-	// 	if callInfo.ReqParams.Parameters.Contains(field) {
-	// 		stringVal := fmt.Sprintf("%v", value)
-	// 		reqConfiguration.Parameters[field] = stringVal
-	// 	} else if callInfo.ReqParams.Query.Contains(field) {
-	// 		stringVal := fmt.Sprintf("%v", value)
-	// 		reqConfiguration.Query[field] = stringVal
-	// 	} else if callInfo.ReqParams.Body.Contains(field) {
-	// 		mapBody[field] = value
-	// 	}
-	// }
 	processFields(callInfo, specFields, reqConfiguration, mapBody)
 	processFields(callInfo, statusFields, reqConfiguration, mapBody)
+	err := processRequestMapping(callInfo, statusFields, specFields, reqConfiguration, mapBody)
+	if err != nil {
+		return nil, err
+	}
 	reqConfiguration.Body = mapBody
-	return reqConfiguration
+	reqConfiguration.Pagination = callInfo.Pagination
+	reqConfiguration.Polling = callInfo.Polling
+	return reqConfiguration, nil
 }
 
 func processFields(callInfo *CallInfo, fields map[string]interface{}, reqConfiguration *restclient.RequestConfiguration, mapBody map[string]interface{}) {
@@ -153,25 +134,111 @@ func processFields(callInfo *CallInfo, fields map[string]interface{}, reqConfigu
 	}
 }
 
+// processAltFields renames the field as AltFields says; a dot separated
+// key also selects the nested value of its first element.
 func processAltFields(callInfo *CallInfo, field string, value interface{}) (string, interface{}) {
-	for k := range callInfo.AltFields {
-		for _, field := range strings.Split(k, ".") {
-			mapval, ok := value.(map[string]interface{})
-			if ok {
-				val, ok := mapval[field]
-				if ok {
-					value = val
-				}
+	if f, ok := callInfo.AltFields[field]; ok {
+		return f, value
+	}
+	for k, f := range callInfo.AltFields {
+		head, rest, ok := strings.Cut(k, ".")
+		if !ok || head != field {
+			continue
+		}
+		nested := value
+		for _, el := range strings.Split(rest, ".") {
+			mapval, ok := nested.(map[string]interface{})
+			if !ok {
+				return field, value
+			}
+			if nested, ok = mapval[el]; !ok {
+				return field, value
 			}
 		}
-	}
-	f, ok := callInfo.AltFields[field]
-	if ok {
-		field = f
+		return f, nested
 	}
 	return field, value
 }
 
+// processRequestMapping sets the values selected by the request mappings,
+// overriding the ones of the fields with the same name.
+func processRequestMapping(callInfo *CallInfo, statusFields map[string]interface{}, specFields map[string]interface{}, reqConfiguration *restclient.RequestConfiguration, mapBody map[string]interface{}) error {
+	if len(callInfo.RequestMapping) == 0 {
+		return nil
+	}
+	src := map[string]interface{}{
+		"spec":   specFields,
+		"status": statusFields,
+	}
+	for _, m := range callInfo.RequestMapping {
+		expr, err := m.Compile()
+		if err != nil {
+			return err
+		}
+		value, ok, err := expr.Search(src)
+		if err != nil {
+			return fmt.Errorf("mapping to %q: %w", m.To, err)
+		}
+		if !ok {
+			continue
+		}
+
+		in, name := m.Target()
+		switch in {
+		case mapping.InPath:
+			reqConfiguration.Parameters[name] = text.GenericToString(value)
+		case mapping.InQuery:
+			reqConfiguration.Query[name] = text.GenericToString(value)
+		case mapping.InHeader:
+			if reqConfiguration.Headers == nil {
+				reqConfiguration.Headers = make(map[string]string)
+			}
+			reqConfiguration.Headers[name] = text.GenericToString(value)
+		case mapping.InBody:
+			if err := mapping.SetField(mapBody, name, value); err != nil {
+				return fmt.Errorf("mapping to %q: %w", m.To, err)
+			}
+		default:
+			return fmt.Errorf("mapping to %q: unknown location: %q", m.To, in)
+		}
+	}
+	return nil
+}
+
+// processResponseMapping stores in the status of mg the values
+// selected in the response body by the response mappings.
+func processResponseMapping(callInfo *CallInfo, mg *unstructured.Unstructured, body map[string]interface{}) error {
+	for _, m := range callInfo.ResponseMapping {
+		expr, err := m.Compile()
+		if err != nil {
+			return err
+		}
+		value, ok, err := expr.Search(body)
+		if err != nil {
+			return fmt.Errorf("mapping to %q: %w", m.To, err)
+		}
+		if !ok {
+			continue
+		}
+
+		status, _, err := unstructured.NestedMap(mg.Object, "status")
+		if err != nil {
+			return err
+		}
+		if status == nil {
+			status = map[string]interface{}{}
+		}
+		_, name := m.Target()
+		if err := mapping.SetField(status, name, runtime.DeepCopyJSONValue(value)); err != nil {
+			return fmt.Errorf("mapping to %q: %w", m.To, err)
+		}
+		if err := unstructured.SetNestedMap(mg.Object, status, "status"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func resolveObjectFromReferenceInfo(ref getter.ReferenceInfo, mg *unstructured.Unstructured, dyClient dynamic.Interface) (*unstructured.Unstructured, error) {
 	gvrForReference := schema.GroupVersionResource{
 		Group:    ref.GroupVersionKind.Group,
@@ -0,0 +1,72 @@
+package composition
+
+import (
+	"testing"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/text"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/mapping"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestBuildCallConfig(t *testing.T) {
+	callInfo := &CallInfo{
+		ReqParams: &RequestedParams{
+			Parameters: text.NewStringSet("organization", "project"),
+			Query:      text.NewStringSet("api-version"),
+			Body:       text.NewStringSet("name", "description"),
+		},
+		AltFields: map[string]string{"project.name": "project", "title": "description"},
+		RequestMapping: []mapping.Mapping{
+			{From: "{.spec.owner.login}", To: "body.upstream.owner"},
+			{From: "status.etag", Language: mapping.JMESPath, To: "header.If-Match"},
+			{From: "{.spec.apiVersion}", To: "query.api-version"},
+		},
+	}
+	specFields := map[string]interface{}{
+		"organization": "krateo",
+		"project":      map[string]interface{}{"name": "pipelineProj"},
+		"name":         "feed",
+		"title":        "A feed",
+		"owner":        map[string]interface{}{"login": "octocat", "name": "unrelated"},
+		"apiVersion":   "7.0",
+	}
+	statusFields := map[string]interface{}{"etag": `"1"`}
+
+	conf, err := BuildCallConfig(callInfo, statusFields, specFields)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, map[string]string{"organization": "krateo", "project": "pipelineProj"}, conf.Parameters)
+	assert.Equal(t, map[string]string{"api-version": "7.0"}, conf.Query)
+	assert.Equal(t, map[string]string{"If-Match": `"1"`}, conf.Headers)
+	assert.Equal(t, map[string]interface{}{
+		"name":        "feed",
+		"description": "A feed",
+		"upstream":    map[string]interface{}{"owner": "octocat"},
+	}, conf.Body)
+}
+
+func TestProcessResponseMapping(t *testing.T) {
+	callInfo := &CallInfo{
+		ResponseMapping: []mapping.Mapping{
+			{From: "{.project.id}", To: "status.projectId"},
+			{From: "upstreamSources[0].location", Language: mapping.JMESPath, To: "status.upstream.location"},
+			{From: "{.missing}", To: "status.missing"},
+		},
+	}
+	mg := &unstructured.Unstructured{Object: map[string]interface{}{
+		"status": map[string]interface{}{"id": "1"},
+	}}
+	body := map[string]interface{}{
+		"project":         map[string]interface{}{"id": "42"},
+		"upstreamSources": []interface{}{map[string]interface{}{"location": "https://registry.npmjs.org"}},
+	}
+
+	assert.NoError(t, processResponseMapping(callInfo, mg, body))
+	assert.Equal(t, map[string]interface{}{
+		"id":        "1",
+		"projectId": "42",
+		"upstream":  map[string]interface{}{"location": "https://registry.npmjs.org"},
+	}, mg.Object["status"])
+}
@@ -0,0 +1,478 @@
+// Package config loads and validates the controller configuration file.
+package config
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/faults"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/maintenance"
+	"github.com/rs/zerolog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/yaml"
+)
+
+const (
+	// APIVersion is the only supported configuration file version.
+	APIVersion = "config.krateo.io/v1alpha1"
+	// Kind is the expected configuration file kind.
+	Kind = "CompositionControllerConfig"
+)
+
+// Config is the controller configuration.
+// Fields marked as reloadable are applied on SIGHUP or on file change
+// without restarting the informers; all the others require a restart.
+type Config struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+
+	// Log configures the controller logger.
+	Log Log `json:"log,omitempty"`
+	// Namespace to watch (empty means all namespaces).
+	Namespace string `json:"namespace,omitempty"`
+	// Resources is the list of the watched resources.
+	Resources []Resource `json:"resources,omitempty"`
+	// Workers is the number of workers per watched resource.
+	Workers int `json:"workers,omitempty"`
+	// ResyncInterval is the informers resync interval.
+	ResyncInterval metav1.Duration `json:"resyncInterval,omitempty"`
+	// LiveReads makes the workers read the objects from the API
+	// server instead of the informer cache.
+	LiveReads bool `json:"liveReads,omitempty"`
+	// Retry is the retry policy of the failed events.
+	Retry Retry `json:"retry,omitempty"`
+	// Timeouts are the deadlines of the external client operations (reloadable).
+	Timeouts Timeouts `json:"timeouts,omitempty"`
+	// PriorityWeights are the weights of the work queue lanes, used
+	// to keep the lower priority events from starving.
+	PriorityWeights PriorityWeights `json:"priorityWeights,omitempty"`
+	// Namespaces caps the concurrent events per namespace (reloadable).
+	Namespaces Namespaces `json:"namespaces,omitempty"`
+	// Backends configures the ExternalClient backends.
+	Backends Backends `json:"backends,omitempty"`
+	// Sharding splits the watched objects across the replicas.
+	Sharding Sharding `json:"sharding,omitempty"`
+	// Orphans configures the handling of the external resources whose
+	// object was deleted while the controller was down.
+	Orphans Orphans `json:"orphans,omitempty"`
+	// Faults injects failures in the external calls, for testing only.
+	Faults Faults `json:"faults,omitempty"`
+	// Maintenance is the default maintenance window of the objects (reloadable).
+	Maintenance Maintenance `json:"maintenance,omitempty"`
+}
+
+type Maintenance struct {
+	// Window is a cron expression (i.e. '0 22 * * mon-fri') telling when the
+	// window opens; out of it the updates and the deletes are deferred.
+	// Empty means always open.
+	Window string `json:"window,omitempty"`
+	// Duration is how long the window stays open.
+	Duration metav1.Duration `json:"duration,omitempty"`
+	// Timezone is the IANA timezone the window is evaluated in (defaults to UTC).
+	Timezone string `json:"timezone,omitempty"`
+	// GateCreate makes the creations wait for the window too.
+	GateCreate bool `json:"gateCreate,omitempty"`
+}
+
+// Spec returns the maintenance window spec.
+func (m Maintenance) Spec() maintenance.Spec {
+	return maintenance.Spec{
+		Schedule:   m.Window,
+		Duration:   m.Duration.Duration,
+		Timezone:   m.Timezone,
+		GateCreate: m.GateCreate,
+	}
+}
+
+type Faults struct {
+	// Client are the faults injected in the external client operations
+	// (see faults.ParseSpec); when set, the resource annotations are honored too.
+	Client string `json:"client,omitempty"`
+	// HTTP are the faults injected in the REST backend http calls.
+	HTTP string `json:"http,omitempty"`
+}
+
+type Orphans struct {
+	// Inventory enables recording the last known state of the objects in ConfigMaps.
+	Inventory bool `json:"inventory"`
+	// Policy is either report or delete.
+	Policy string `json:"policy,omitempty"`
+}
+
+type Sharding struct {
+	// Shards is the total number of shards (zero disables sharding).
+	Shards int `json:"shards,omitempty"`
+	// LeaseNamespace is the namespace of the shard leases.
+	LeaseNamespace string `json:"leaseNamespace,omitempty"`
+	// LeaseName is the prefix of the shard leases name.
+	LeaseName string `json:"leaseName,omitempty"`
+	// Identity uniquely identifies this replica (defaults to the hostname).
+	Identity string `json:"identity,omitempty"`
+	// LeaseDuration is how long a shard lease is valid without renewal.
+	LeaseDuration metav1.Duration `json:"leaseDuration,omitempty"`
+	// RenewDeadline is how long a shard is processed without a successful renewal.
+	RenewDeadline metav1.Duration `json:"renewDeadline,omitempty"`
+	// RetryPeriod is how often shard leases are renewed and rebalanced.
+	RetryPeriod metav1.Duration `json:"retryPeriod,omitempty"`
+}
+
+type Log struct {
+	// Level is the log level [trace|debug|info|warn|error] (reloadable).
+	Level string `json:"level,omitempty"`
+}
+
+type Resource struct {
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+}
+
+func (r Resource) GVR() schema.GroupVersionResource {
+	return schema.GroupVersionResource{
+		Group:    r.Group,
+		Version:  r.Version,
+		Resource: r.Resource,
+	}
+}
+
+type Retry struct {
+	// MaxRetries is the number of attempts before giving up an event (reloadable).
+	MaxRetries int `json:"maxRetries,omitempty"`
+	// BaseDelay is the initial per item exponential backoff.
+	BaseDelay metav1.Duration `json:"baseDelay,omitempty"`
+	// MaxDelay is the maximum per item exponential backoff.
+	MaxDelay metav1.Duration `json:"maxDelay,omitempty"`
+	// QPS is the overall retry rate limit (reloadable).
+	QPS float64 `json:"qps,omitempty"`
+	// Burst is the overall retry bucket size (reloadable).
+	Burst int `json:"burst,omitempty"`
+	// PollInterval is the delay before a Create follows an Observe
+	// reporting a missing external resource, and before the Observe
+	// following every Create and Update (reloadable).
+	PollInterval metav1.Duration `json:"pollInterval,omitempty"`
+}
+
+type Timeouts struct {
+	// Observe is the deadline of the Observe operations.
+	Observe metav1.Duration `json:"observe,omitempty"`
+	// Create is the deadline of the Create operations.
+	Create metav1.Duration `json:"create,omitempty"`
+	// Update is the deadline of the Update operations.
+	Update metav1.Duration `json:"update,omitempty"`
+	// Delete is the deadline of the Delete operations.
+	Delete metav1.Duration `json:"delete,omitempty"`
+}
+
+type PriorityWeights struct {
+	// High is the weight of the Delete and Update events.
+	High int `json:"high,omitempty"`
+	// Normal is the weight of the Create events.
+	Normal int `json:"normal,omitempty"`
+	// Low is the weight of the Observe events.
+	Low int `json:"low,omitempty"`
+}
+
+type Namespaces struct {
+	// MaxConcurrent is the number of events of the same namespace
+	// processed at the same time across all the resources (zero means no cap).
+	MaxConcurrent int `json:"maxConcurrent,omitempty"`
+	// Limits overrides MaxConcurrent for specific namespaces.
+	Limits map[string]int `json:"limits,omitempty"`
+}
+
+type Backends struct {
+	// Default is the backend serving kinds without a route.
+	Default string `json:"default,omitempty"`
+	// Routes maps a 'Kind.group' to a backend name.
+	Routes map[string]string `json:"routes,omitempty"`
+	// Helm configures the HELM backend.
+	Helm Helm `json:"helm,omitempty"`
+	// REST configures the REST backend.
+	REST REST `json:"rest,omitempty"`
+	// Params are passed as is to the backend factories
+	// (useful for out-of-tree backends).
+	Params map[string]string `json:"params,omitempty"`
+}
+
+type Helm struct {
+	// Chart is a static chart url, when empty it is resolved
+	// from the composition definition.
+	Chart string `json:"chart,omitempty"`
+	// RepositoryCache is the helm repository cache path.
+	RepositoryCache string `json:"repositoryCache,omitempty"`
+	// RepositoryConfig is the helm repository config file path.
+	RepositoryConfig string `json:"repositoryConfig,omitempty"`
+}
+
+type REST struct {
+	// Timeout is the http client timeout of a single request (defaults to 30s).
+	Timeout metav1.Duration `json:"timeout,omitempty"`
+	// MaxIdleConnsPerHost is the maximum number of idle connections per host.
+	MaxIdleConnsPerHost int `json:"maxIdleConnsPerHost,omitempty"`
+	// IdleConnTimeout is how long an idle connection is kept open.
+	IdleConnTimeout metav1.Duration `json:"idleConnTimeout,omitempty"`
+	// DocumentCacheTTL is how long the OpenAPI documents are used
+	// before being revalidated (defaults to 5m).
+	DocumentCacheTTL metav1.Duration `json:"documentCacheTTL,omitempty"`
+}
+
+// Default returns a configuration with the default values.
+func Default() *Config {
+	return &Config{
+		APIVersion: APIVersion,
+		Kind:       Kind,
+		Log: Log{
+			Level: zerolog.InfoLevel.String(),
+		},
+		Namespace:      "default",
+		Workers:        1,
+		ResyncInterval: metav1.Duration{Duration: time.Minute * 3},
+		Retry: Retry{
+			MaxRetries:   5,
+			BaseDelay:    metav1.Duration{Duration: time.Second * 3},
+			MaxDelay:     metav1.Duration{Duration: time.Second * 180},
+			QPS:          10,
+			Burst:        100,
+			PollInterval: metav1.Duration{Duration: time.Second * 3},
+		},
+		Timeouts: Timeouts{
+			Observe: metav1.Duration{Duration: time.Minute * 2},
+			Create:  metav1.Duration{Duration: time.Minute * 5},
+			Update:  metav1.Duration{Duration: time.Minute * 5},
+			Delete:  metav1.Duration{Duration: time.Minute * 5},
+		},
+		PriorityWeights: PriorityWeights{
+			High:   8,
+			Normal: 4,
+			Low:    1,
+		},
+		Backends: Backends{
+			Default: "HELM",
+			Helm: Helm{
+				RepositoryCache:  "/tmp/.helmcache",
+				RepositoryConfig: "/tmp/.helmrepo",
+			},
+		},
+		Orphans: Orphans{
+			Inventory: true,
+			Policy:    "report",
+		},
+		Sharding: Sharding{
+			LeaseName:     "composition-dynamic-controller",
+			LeaseDuration: metav1.Duration{Duration: time.Second * 15},
+			RenewDeadline: metav1.Duration{Duration: time.Second * 10},
+			RetryPeriod:   metav1.Duration{Duration: time.Second * 2},
+		},
+	}
+}
+
+// Load reads the configuration file at the specified path on top of a
+// copy of base, so that only the keys present in the file are overridden,
+// and validates the result.
+func Load(path string, base *Config) (*Config, error) {
+	dat, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return Parse(dat, base)
+}
+
+// Parse decodes the configuration on top of a copy of base and validates the result.
+func Parse(dat []byte, base *Config) (*Config, error) {
+	cfg := Default()
+	if base != nil {
+		cfg = base.DeepCopy()
+	}
+	cfg.APIVersion, cfg.Kind = "", ""
+
+	if err := yaml.UnmarshalStrict(dat, cfg); err != nil {
+		return nil, fmt.Errorf("decoding configuration: %w", err)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks the configuration for errors.
+func (c *Config) Validate() error {
+	if c.APIVersion != APIVersion {
+		return fmt.Errorf("unsupported configuration apiVersion %q (expected %q)", c.APIVersion, APIVersion)
+	}
+	if c.Kind != Kind {
+		return fmt.Errorf("unsupported configuration kind %q (expected %q)", c.Kind, Kind)
+	}
+	if _, err := zerolog.ParseLevel(strings.ToLower(c.Log.Level)); err != nil {
+		return fmt.Errorf("invalid log.level: %w", err)
+	}
+	if len(c.Resources) == 0 {
+		return fmt.Errorf("at least one resource must be specified")
+	}
+	for i, el := range c.Resources {
+		if len(el.Version) == 0 || len(el.Resource) == 0 {
+			return fmt.Errorf("resources[%d]: version and resource are required", i)
+		}
+	}
+	if c.Workers < 1 {
+		return fmt.Errorf("workers must be greater than zero")
+	}
+	if c.ResyncInterval.Duration < 0 {
+		return fmt.Errorf("resyncInterval must not be negative")
+	}
+	if c.Retry.MaxRetries < 0 {
+		return fmt.Errorf("retry.maxRetries must not be negative")
+	}
+	if c.Retry.BaseDelay.Duration <= 0 || c.Retry.MaxDelay.Duration < c.Retry.BaseDelay.Duration {
+		return fmt.Errorf("retry.baseDelay must be positive and not greater than retry.maxDelay")
+	}
+	if c.Retry.QPS <= 0 || c.Retry.Burst < 1 {
+		return fmt.Errorf("retry.qps and retry.burst must be greater than zero")
+	}
+	if c.Retry.PollInterval.Duration < 0 {
+		return fmt.Errorf("retry.pollInterval must not be negative")
+	}
+	if c.Timeouts.Observe.Duration <= 0 || c.Timeouts.Create.Duration <= 0 ||
+		c.Timeouts.Update.Duration <= 0 || c.Timeouts.Delete.Duration <= 0 {
+		return fmt.Errorf("timeouts must be positive")
+	}
+	if c.PriorityWeights.High < 1 || c.PriorityWeights.Normal < 1 || c.PriorityWeights.Low < 1 {
+		return fmt.Errorf("priorityWeights must be greater than zero")
+	}
+	if c.Namespaces.MaxConcurrent < 0 {
+		return fmt.Errorf("namespaces.maxConcurrent must not be negative")
+	}
+	for k, v := range c.Namespaces.Limits {
+		if len(k) == 0 || v < 0 {
+			return fmt.Errorf("invalid namespaces.limits entry %q: %d", k, v)
+		}
+	}
+	if len(c.Backends.Default) == 0 {
+		return fmt.Errorf("backends.default must be specified")
+	}
+	for k, v := range c.Backends.Routes {
+		if len(k) == 0 || len(v) == 0 {
+			return fmt.Errorf("invalid backends.routes entry %q: %q", k, v)
+		}
+	}
+	if c.Backends.REST.Timeout.Duration < 0 || c.Backends.REST.IdleConnTimeout.Duration < 0 ||
+		c.Backends.REST.DocumentCacheTTL.Duration < 0 {
+		return fmt.Errorf("backends.rest timeouts must not be negative")
+	}
+	if c.Backends.REST.MaxIdleConnsPerHost < 0 {
+		return fmt.Errorf("backends.rest.maxIdleConnsPerHost must not be negative")
+	}
+	if p := strings.ToLower(c.Orphans.Policy); p != "report" && p != "delete" {
+		return fmt.Errorf("orphans.policy must be either report or delete")
+	}
+	if _, err := faults.ParseSpec(c.Faults.Client); err != nil {
+		return fmt.Errorf("invalid faults.client: %w", err)
+	}
+	if _, err := faults.ParseSpec(c.Faults.HTTP); err != nil {
+		return fmt.Errorf("invalid faults.http: %w", err)
+	}
+	if _, err := maintenance.New(c.Maintenance.Spec()); err != nil {
+		return fmt.Errorf("invalid maintenance: %w", err)
+	}
+	if c.Sharding.Shards < 0 {
+		return fmt.Errorf("sharding.shards must not be negative")
+	}
+	if c.Sharding.Shards > 0 {
+		if len(c.Sharding.LeaseName) == 0 {
+			return fmt.Errorf("sharding.leaseName must be specified")
+		}
+		if c.Sharding.RenewDeadline.Duration >= c.Sharding.LeaseDuration.Duration {
+			return fmt.Errorf("sharding.renewDeadline must be less than sharding.leaseDuration")
+		}
+	}
+
+	return nil
+}
+
+// LogLevel returns the parsed log level.
+func (c *Config) LogLevel() zerolog.Level {
+	lvl, err := zerolog.ParseLevel(strings.ToLower(c.Log.Level))
+	if err != nil {
+		return zerolog.InfoLevel
+	}
+	return lvl
+}
+
+// GVRs returns the list of the watched resources.
+func (c *Config) GVRs() []schema.GroupVersionResource {
+	res := make([]schema.GroupVersionResource, 0, len(c.Resources))
+	for _, el := range c.Resources {
+		res = append(res, el.GVR())
+	}
+	return res
+}
+
+// RequiresRestart returns the names of the settings that differ
+// between c and other and that cannot be applied without a restart.
+func (c *Config) RequiresRestart(other *Config) []string {
+	res := []string{}
+	if c.Namespace != other.Namespace {
+		res = append(res, "namespace")
+	}
+	if fmt.Sprint(c.Resources) != fmt.Sprint(other.Resources) {
+		res = append(res, "resources")
+	}
+	if c.Workers != other.Workers {
+		res = append(res, "workers")
+	}
+	if c.ResyncInterval != other.ResyncInterval {
+		res = append(res, "resyncInterval")
+	}
+	if c.LiveReads != other.LiveReads {
+		res = append(res, "liveReads")
+	}
+	if c.Retry.BaseDelay != other.Retry.BaseDelay || c.Retry.MaxDelay != other.Retry.MaxDelay {
+		res = append(res, "retry.baseDelay", "retry.maxDelay")
+	}
+	if c.PriorityWeights != other.PriorityWeights {
+		res = append(res, "priorityWeights")
+	}
+	if fmt.Sprint(c.Backends) != fmt.Sprint(other.Backends) {
+		res = append(res, "backends")
+	}
+	if c.Sharding != other.Sharding {
+		res = append(res, "sharding")
+	}
+	if c.Orphans != other.Orphans {
+		res = append(res, "orphans")
+	}
+	if c.Faults != other.Faults {
+		res = append(res, "faults")
+	}
+	return res
+}
+
+// DeepCopy returns a deep copy of the configuration.
+func (c *Config) DeepCopy() *Config {
+	res := *c
+	res.Resources = append([]Resource(nil), c.Resources...)
+	if c.Namespaces.Limits != nil {
+		res.Namespaces.Limits = make(map[string]int, len(c.Namespaces.Limits))
+		for k, v := range c.Namespaces.Limits {
+			res.Namespaces.Limits[k] = v
+		}
+	}
+	if c.Backends.Routes != nil {
+		res.Backends.Routes = make(map[string]string, len(c.Backends.Routes))
+		for k, v := range c.Backends.Routes {
+			res.Backends.Routes[k] = v
+		}
+	}
+	if c.Backends.Params != nil {
+		res.Backends.Params = make(map[string]string, len(c.Backends.Params))
+		for k, v := range c.Backends.Params {
+			res.Backends.Params[k] = v
+		}
+	}
+	return &res
+}
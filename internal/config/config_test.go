@@ -0,0 +1,167 @@
+package config
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoad(t *testing.T) {
+	base := Default()
+	base.Workers = 4
+
+	cfg, err := Load(filepath.Join("..", "..", "samples", "config.yaml"), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, 2, cfg.Workers)
+	assert.Equal(t, 4, base.Workers)
+	assert.Equal(t, zerolog.InfoLevel, cfg.LogLevel())
+	assert.Equal(t, 2, len(cfg.GVRs()))
+	assert.Equal(t, "REST", cfg.Backends.Routes["Repo.github.krateo.io"])
+	assert.Equal(t, 30*time.Second, cfg.Backends.REST.Timeout.Duration)
+	assert.Equal(t, 5*time.Minute, cfg.Backends.REST.DocumentCacheTTL.Duration)
+	assert.Equal(t, 3*time.Minute, cfg.Retry.MaxDelay.Duration)
+	assert.Equal(t, 10*time.Minute, cfg.Timeouts.Delete.Duration)
+	assert.Equal(t, 2*time.Minute, cfg.Timeouts.Observe.Duration)
+	assert.Equal(t, "0 22 * * mon-fri", cfg.Maintenance.Window)
+	assert.Equal(t, "Europe/Rome", cfg.Maintenance.Timezone)
+}
+
+func TestParseOverridesOnlyPresentKeys(t *testing.T) {
+	base := Default()
+	base.Resources = []Resource{{Group: "g", Version: "v1", Resource: "things"}}
+
+	cfg, err := Parse([]byte(`
+apiVersion: config.krateo.io/v1alpha1
+kind: CompositionControllerConfig
+log:
+  level: debug
+`), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(t, zerolog.DebugLevel, cfg.LogLevel())
+	assert.Equal(t, base.Resources, cfg.Resources)
+	assert.Equal(t, base.Retry, cfg.Retry)
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+	}{
+		{
+			name: "wrong version",
+			yaml: "apiVersion: config.krateo.io/v2\nkind: CompositionControllerConfig\n",
+		},
+		{
+			name: "missing kind",
+			yaml: "apiVersion: config.krateo.io/v1alpha1\n",
+		},
+		{
+			name: "unknown field",
+			yaml: "apiVersion: config.krateo.io/v1alpha1\nkind: CompositionControllerConfig\nfoo: bar\n",
+		},
+		{
+			name: "bad log level",
+			yaml: "apiVersion: config.krateo.io/v1alpha1\nkind: CompositionControllerConfig\nlog:\n  level: loud\n",
+		},
+		{
+			name: "no workers",
+			yaml: "apiVersion: config.krateo.io/v1alpha1\nkind: CompositionControllerConfig\nworkers: -1\n",
+		},
+		{
+			name: "bad retry delays",
+			yaml: "apiVersion: config.krateo.io/v1alpha1\nkind: CompositionControllerConfig\nretry:\n  baseDelay: 1m\n  maxDelay: 1s\n",
+		},
+		{
+			name: "bad orphans policy",
+			yaml: "apiVersion: config.krateo.io/v1alpha1\nkind: CompositionControllerConfig\norphans:\n  policy: ignore\n",
+		},
+		{
+			name: "no delete timeout",
+			yaml: "apiVersion: config.krateo.io/v1alpha1\nkind: CompositionControllerConfig\ntimeouts:\n  delete: 0s\n",
+		},
+		{
+			name: "negative namespace limit",
+			yaml: "apiVersion: config.krateo.io/v1alpha1\nkind: CompositionControllerConfig\nnamespaces:\n  limits:\n    team-a: -1\n",
+		},
+		{
+			name: "maintenance window without duration",
+			yaml: "apiVersion: config.krateo.io/v1alpha1\nkind: CompositionControllerConfig\nmaintenance:\n  window: 0 22 * * *\n",
+		},
+	}
+
+	base := Default()
+	base.Resources = []Resource{{Group: "g", Version: "v1", Resource: "things"}}
+
+	for _, tc := range tests {
+		_, err := Parse([]byte(tc.yaml), base)
+		assert.NotNil(t, err, tc.name)
+	}
+}
+
+func TestRequiresRestart(t *testing.T) {
+	a := Default()
+	b := a.DeepCopy()
+	b.Log.Level = "debug"
+	b.Retry.QPS = 50
+	b.Namespaces.Limits = map[string]int{"team-a": 2}
+	assert.Empty(t, a.RequiresRestart(b))
+
+	b.Workers = 10
+	assert.Equal(t, []string{"workers"}, a.RequiresRestart(b))
+}
+
+func TestWatchReloadsOnFileChange(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	write := func(level string) {
+		err := os.WriteFile(path, []byte("apiVersion: config.krateo.io/v1alpha1\n"+
+			"kind: CompositionControllerConfig\nlog:\n  level: "+level+"\n"), 0o600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("info")
+
+	base := Default()
+	base.Resources = []Resource{{Group: "g", Version: "v1", Resource: "things"}}
+	cur, err := Load(path, base)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	reloaded := make(chan *Config, 1)
+	log := zerolog.Nop()
+	go Watch(ctx, WatchOptions{
+		Path:     path,
+		Base:     base,
+		Current:  cur,
+		Interval: 10 * time.Millisecond,
+		Logger:   &log,
+		OnReload: func(_, cur *Config) {
+			reloaded <- cur
+		},
+	})
+
+	time.Sleep(50 * time.Millisecond)
+	write("warn")
+
+	select {
+	case got := <-reloaded:
+		assert.Equal(t, zerolog.WarnLevel, got.LogLevel())
+	case <-ctx.Done():
+		t.Fatal("configuration not reloaded")
+	}
+}
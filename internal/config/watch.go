@@ -0,0 +1,87 @@
+package config
+
+import (
+	"context"
+	"os"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// ReloadFunc is invoked with the previous and the new configuration
+// every time the configuration file changes.
+type ReloadFunc func(old, cur *Config)
+
+type WatchOptions struct {
+	// Path of the configuration file.
+	Path string
+	// Base is the configuration the file is loaded on top of.
+	Base *Config
+	// Current is the configuration in use.
+	Current *Config
+	// Interval is how often the file is checked for changes.
+	// Zero disables the polling (only reload signals are honored).
+	Interval time.Duration
+	// Signals receives a value every time a reload is requested.
+	Signals <-chan os.Signal
+	// Logger is used to report reload errors.
+	Logger *zerolog.Logger
+	// OnReload is invoked after a successful reload.
+	OnReload ReloadFunc
+}
+
+// Watch reloads the configuration file on reload signals and,
+// if an interval is provided, whenever its modification time or size changes.
+// Invalid configurations are logged and discarded.
+// Watch blocks until the context is done.
+func Watch(ctx context.Context, opts WatchOptions) {
+	var tick <-chan time.Time
+	if opts.Interval > 0 {
+		ticker := time.NewTicker(opts.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	cur := opts.Current
+	last, _ := os.Stat(opts.Path)
+
+	reload := func(reason string) {
+		next, err := Load(opts.Path, opts.Base)
+		if err != nil {
+			opts.Logger.Error().Err(err).
+				Str("path", opts.Path).
+				Str("trigger", reason).
+				Msg("Reloading configuration, keeping the previous one.")
+			return
+		}
+
+		opts.Logger.Info().Str("path", opts.Path).
+			Str("trigger", reason).
+			Msg("Configuration reloaded.")
+
+		if opts.OnReload != nil {
+			opts.OnReload(cur, next)
+		}
+		cur = next
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-opts.Signals:
+			last, _ = os.Stat(opts.Path)
+			reload("signal")
+		case <-tick:
+			fi, err := os.Stat(opts.Path)
+			if err != nil {
+				continue
+			}
+			if last != nil && fi.ModTime().Equal(last.ModTime()) && fi.Size() == last.Size() {
+				continue
+			}
+			last = fi
+			reload("file change")
+		}
+	}
+}
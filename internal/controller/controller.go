@@ -4,6 +4,8 @@ import (
 	"context"
 	"fmt"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -11,6 +13,7 @@ import (
 	"github.com/gobuffalo/flect"
 	"github.com/google/go-cmp/cmp"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/listwatcher"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/maintenance"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/shortid"
 	"github.com/rs/zerolog"
 	"golang.org/x/time/rate"
@@ -32,28 +35,191 @@ type Options struct {
 	Recorder       record.EventRecorder
 	Logger         *zerolog.Logger
 	ExternalClient ExternalClient
+	Retry          RetryOptions
+	Timeouts       TimeoutOptions
+	// Middlewares decorate the ExternalClient after the built-in ones
+	// (logging, management policy, metrics, timeouts reporting and
+	// timeouts), i.e. they run within the operation deadline.
+	Middlewares []Middleware
+	// PriorityWeights are the weights of the Delete/Update,
+	// Create and Observe lanes.
+	// Defaults to DefaultPriorityWeights.
+	PriorityWeights [numPriorities]int
+	// NamespaceLimiter, when set, caps the events of a namespace
+	// processed at the same time. It can be shared by many controllers.
+	NamespaceLimiter *NamespaceLimiter
+	// FieldManager is the name the controller writes with, used to
+	// ignore its own changes. Defaults to FieldManager.
+	FieldManager string
+	// Predicates are added to the DefaultPredicates to filter
+	// the update events.
+	Predicates []Predicate
+	// LiveReads makes the workers read the objects from the API server
+	// instead of the informer cache.
+	LiveReads bool
+	// Inventory, when set, records the last known state of the objects
+	// so that the external resources of the objects deleted while the
+	// controller was down are found at startup.
+	Inventory Inventory
+	// OrphanPolicy tells what to do with those external resources.
+	// Defaults to OrphanPolicyReport.
+	OrphanPolicy OrphanPolicy
+	// Sharder, when set, restricts the controller to the objects
+	// belonging to the shards held by this replica.
+	Sharder Sharder
+	// Dependencies tracks the objects waiting for their dependencies.
+	// Shared by many controllers, the changes of the objects served by
+	// one requeue their dependents served by another.
+	Dependencies *Dependencies
+	// References, when set, tracks the objects read by the backends,
+	// so that their changes requeue the objects reading them.
+	References *References
+	// Maintenance is the default maintenance window of the objects:
+	// out of it the updates and the deletes (and optionally the
+	// creates) are deferred. The objects can override it with the
+	// meta.AnnotationKeyMaintenanceWindow annotations.
+	Maintenance maintenance.Spec
+}
+
+// A Sharder tells which objects are handled by this controller replica.
+type Sharder interface {
+	// Owns returns true if the object belongs to this replica.
+	Owns(namespace, name string) bool
+	// Track marks the object as in-flight until done is called and
+	// returns the context to process it with, canceled if the object
+	// stops belonging to this replica meanwhile; ok is false if the
+	// object does not belong to this replica.
+	Track(ctx context.Context, namespace, name string) (_ context.Context, done func(), ok bool)
+	// OnAcquire registers a function invoked when new objects
+	// become owned by this replica.
+	OnAcquire(fn func())
+}
+
+// RetryOptions is the retry policy of the failed events.
+// Zero values are replaced by the defaults.
+type RetryOptions struct {
+	// MaxRetries is the number of attempts before giving up an event.
+	MaxRetries int
+	// BaseDelay is the initial per item exponential backoff.
+	BaseDelay time.Duration
+	// MaxDelay is the maximum per item exponential backoff.
+	MaxDelay time.Duration
+	// QPS is the overall retry rate limit.
+	QPS float64
+	// Burst is the overall retry bucket size.
+	Burst int
+	// PollInterval is the delay before a Create follows an Observe
+	// reporting a missing external resource, and before the Observe
+	// following every Create and Update.
+	PollInterval time.Duration
+}
+
+func (o *RetryOptions) setDefaults() {
+	if o.MaxRetries <= 0 {
+		o.MaxRetries = defaultMaxRetries
+	}
+	if o.BaseDelay <= 0 {
+		o.BaseDelay = 3 * time.Second
+	}
+	if o.MaxDelay <= 0 {
+		o.MaxDelay = 180 * time.Second
+	}
+	if o.QPS <= 0 {
+		o.QPS = 10
+	}
+	if o.Burst <= 0 {
+		o.Burst = 100
+	}
+	if o.PollInterval <= 0 {
+		o.PollInterval = 3 * time.Second
+	}
 }
 
 type Controller struct {
-	dynamicClient  dynamic.Interface
-	gvr            schema.GroupVersionResource
-	queue          workqueue.RateLimitingInterface
-	indexer        cache.Indexer
-	informer       cache.Controller
-	recorder       record.EventRecorder
-	logger         *zerolog.Logger
-	externalClient ExternalClient
+	dynamicClient dynamic.Interface
+	gvr           schema.GroupVersionResource
+	namespace     string
+	sid           *shortid.Shortid
+	queue         workqueue.RateLimitingInterface
+	indexer       cache.Indexer
+	informer      cache.Controller
+	recorder      record.EventRecorder
+	logger        *zerolog.Logger
+	client        ExternalClient
+	middlewares   []Middleware
+	limiter       *rate.Limiter
+	maxRetries    atomic.Int64
+	pollInterval  atomic.Int64
+	timeouts      atomic.Pointer[TimeoutOptions]
+	maintenance   atomic.Pointer[maintenanceWindow]
+	sharder       Sharder
+	inventory     Inventory
+	orphanPolicy  OrphanPolicy
+	liveReads     bool
+	deps          *Dependencies
+	refs          *References
+
+	mu         sync.Mutex
+	tombstones map[ObjectRef]*unstructured.Unstructured
+	cleaned    map[ObjectRef]time.Time
+	// deleting are the objects with a Delete in flight, true
+	// once the informer reported their deletion.
+	deleting map[ObjectRef]bool
+	// rechecks are the events scheduled by recheckDependencies.
+	rechecks map[event]struct{}
 }
 
 // New creates a new Controller.
 func New(sid *shortid.Shortid, opts Options) *Controller {
+	opts.Retry.setDefaults()
+	opts.Timeouts.setDefaults()
+
+	// This is only for retry speed and its only the overall factor (not per item)
+	limiter := rate.NewLimiter(rate.Limit(opts.Retry.QPS), opts.Retry.Burst)
 	rateLimiter := workqueue.NewMaxOfRateLimiter(
-		workqueue.NewItemExponentialFailureRateLimiter(3*time.Second, 180*time.Second),
-		// 10 qps, 100 bucket size.  This is only for retry speed and its only the overall factor (not per item)
-		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(10), 100)},
+		workqueue.NewItemExponentialFailureRateLimiter(opts.Retry.BaseDelay, opts.Retry.MaxDelay),
+		&workqueue.BucketRateLimiter{Limiter: limiter},
 	)
 
-	queue := workqueue.NewRateLimitingQueue(rateLimiter)
+	if opts.PriorityWeights == [numPriorities]int{} {
+		opts.PriorityWeights = DefaultPriorityWeights
+	}
+	queue := newPriorityQueue(rateLimiter, opts.PriorityWeights, opts.NamespaceLimiter)
+
+	if len(opts.FieldManager) == 0 {
+		opts.FieldManager = FieldManager
+	}
+	predicates := append(DefaultPredicates(opts.FieldManager), opts.Predicates...)
+
+	if len(opts.OrphanPolicy) == 0 {
+		opts.OrphanPolicy = OrphanPolicyReport
+	}
+
+	if opts.Dependencies == nil {
+		opts.Dependencies = NewDependencies()
+	}
+
+	ctrl := &Controller{
+		dynamicClient: opts.Client,
+		gvr:           opts.GVR,
+		namespace:     opts.Namespace,
+		sid:           sid,
+		recorder:      opts.Recorder,
+		logger:        opts.Logger,
+		queue:         queue,
+		middlewares:   opts.Middlewares,
+		limiter:       limiter,
+		sharder:       opts.Sharder,
+		inventory:     opts.Inventory,
+		orphanPolicy:  opts.OrphanPolicy,
+		liveReads:     opts.LiveReads,
+		deps:          opts.Dependencies,
+		refs:          opts.References,
+		tombstones:    map[ObjectRef]*unstructured.Unstructured{},
+		cleaned:       map[ObjectRef]time.Time{},
+		deleting:      map[ObjectRef]bool{},
+		rechecks:      map[event]struct{}{},
+	}
 
 	indexer, informer := cache.NewIndexerInformer(
 		listwatcher.Create(listwatcher.CreateOptions{
@@ -70,6 +236,11 @@ func New(sid *shortid.Shortid, opts Options) *Controller {
 					opts.Logger.Warn().Msg("AddFunc: object is not an unstructured.")
 					return
 				}
+				ctrl.deps.changed(refOf(el))
+
+				if opts.Sharder != nil && !opts.Sharder.Owns(el.GetNamespace(), el.GetName()) {
+					return
+				}
 
 				id, err := sid.Generate()
 				if err != nil {
@@ -113,6 +284,20 @@ func New(sid *shortid.Shortid, opts Options) *Controller {
 					return
 				}
 
+				// Status only changes too, as readiness is one.
+				ctrl.deps.changed(refOf(newUns))
+
+				if opts.Sharder != nil && !opts.Sharder.Owns(newUns.GetNamespace(), newUns.GetName()) {
+					return
+				}
+
+				if !allowUpdate(predicates, oldUns, newUns) {
+					opts.Logger.Debug().Str("name", newUns.GetName()).
+						Str("namespace", newUns.GetNamespace()).
+						Msg("UpdateFunc: change filtered out.")
+					return
+				}
+
 				id, err := sid.Generate()
 				if err != nil {
 					opts.Logger.Error().Err(err).Msg("UpdateFunc: generating short id.")
@@ -173,47 +358,133 @@ func New(sid *shortid.Shortid, opts Options) *Controller {
 			// https://github.com/kubernetes/client-go/issues/606
 			// https://github.com/kubernetes/sample-controller/issues/50
 			DeleteFunc: func(obj interface{}) {
-				// el, ok := obj.(*unstructured.Unstructured)
-				// if !ok {
-				// 	opts.Logger.Warn().Msg("DeleteFunc: object is not an unstructured.")
-				// 	return
-				// }
-
-				// id, err := sid.Generate()
-				// if err != nil {
-				// 	opts.Logger.Error().Err(err).Msg("DeleteFunc: generating short id.")
-				// 	return
-				// }
-
-				// queue.Add(event{
-				// 	id:        id,
-				// 	eventType: Delete,
-				// 	objectRef: ObjectRef{
-				// 		APIVersion: el.GetAPIVersion(),
-				// 		Kind:       el.GetKind(),
-				// 		Name:       el.GetName(),
-				// 		Namespace:  el.GetNamespace(),
-				// 	},
-				// })
+				ctrl.onDeleted(sid, obj)
 			},
 		},
 		cache.Indexers{},
 	)
 
-	return &Controller{
-		dynamicClient:  opts.Client,
-		gvr:            opts.GVR,
-		recorder:       opts.Recorder,
-		logger:         opts.Logger,
-		informer:       informer,
-		indexer:        indexer,
-		queue:          queue,
-		externalClient: opts.ExternalClient,
+	ctrl.SetExternalClient(opts.ExternalClient)
+	ctrl.indexer = indexer
+	ctrl.informer = informer
+	ctrl.maxRetries.Store(int64(opts.Retry.MaxRetries))
+	ctrl.pollInterval.Store(int64(opts.Retry.PollInterval))
+	ctrl.timeouts.Store(&opts.Timeouts)
+	if err := ctrl.SetMaintenance(opts.Maintenance); err != nil {
+		opts.Logger.Error().Err(err).Msg("Ignoring maintenance window.")
+	}
+
+	opts.References.subscribe(ctrl.requeueReader)
+
+	if opts.Sharder != nil {
+		opts.Sharder.OnAcquire(func() {
+			ctrl.enqueueOwned(sid)
+			if ctrl.informer.HasSynced() {
+				ctrl.sweepOrphans(context.Background(), sid)
+			}
+		})
 	}
+
+	return ctrl
 }
 
+// SetExternalClient replaces the external client, decorating it
+// with the built-in and the Options middlewares.
 func (c *Controller) SetExternalClient(ec ExternalClient) {
-	c.externalClient = ec
+	if ec == nil {
+		c.client = nil
+		return
+	}
+
+	mws := append([]Middleware{
+		WithLogging(c.logger),
+		WithPolicy(),
+		WithMetrics(c.gvr),
+		WithErrorHandler(c.reportError),
+		WithStatus(c.updateStatus),
+		WithTimeouts(c.timeoutFor),
+	}, c.middlewares...)
+	c.client = Chain(ec, mws...)
+}
+
+// updateStatus writes the status of the object, keeping its
+// resourceVersion current for the later updates.
+func (c *Controller) updateStatus(ctx context.Context, el *unstructured.Unstructured) error {
+	res, err := c.dynamicClient.Resource(c.gvr).Namespace(el.GetNamespace()).
+		UpdateStatus(ctx, el, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	el.SetResourceVersion(res.GetResourceVersion())
+	return nil
+}
+
+// SetRateLimit changes the overall retry rate limit.
+// It is safe to call while the controller is running.
+func (c *Controller) SetRateLimit(qps float64, burst int) {
+	c.limiter.SetLimit(rate.Limit(qps))
+	c.limiter.SetBurst(burst)
+}
+
+// SetMaxRetries changes the number of attempts before giving up an event.
+// It is safe to call while the controller is running.
+func (c *Controller) SetMaxRetries(n int) {
+	c.maxRetries.Store(int64(n))
+}
+
+// SetPollInterval changes the delay before a Create follows an Observe
+// reporting a missing external resource, and before the Observe
+// following every Create and Update.
+// It is safe to call while the controller is running.
+func (c *Controller) SetPollInterval(d time.Duration) {
+	c.pollInterval.Store(int64(d))
+}
+
+// SetTimeouts changes the deadlines of the ExternalClient operations.
+// It is safe to call while the controller is running.
+func (c *Controller) SetTimeouts(t TimeoutOptions) {
+	t.setDefaults()
+	c.timeouts.Store(&t)
+}
+
+// enqueueOwned observes all the known objects owned by this replica.
+func (c *Controller) enqueueOwned(sid *shortid.Shortid) {
+	if !c.informer.HasSynced() {
+		// The informer initial list will enqueue them.
+		return
+	}
+
+	for _, obj := range c.indexer.List() {
+		el, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			continue
+		}
+		if !c.sharder.Owns(el.GetNamespace(), el.GetName()) {
+			continue
+		}
+
+		id, err := sid.Generate()
+		if err != nil {
+			c.logger.Error().Err(err).Msg("Generating short id.")
+			return
+		}
+
+		eventType := Observe
+		if el.GetDeletionTimestamp() != nil {
+			eventType = Delete
+		}
+
+		c.queue.Add(event{
+			id:        id,
+			eventType: eventType,
+			objectRef: ObjectRef{
+				APIVersion: el.GetAPIVersion(),
+				Kind:       el.GetKind(),
+				Name:       el.GetName(),
+				Namespace:  el.GetNamespace(),
+			},
+		})
+	}
 }
 
 // Run begins watching and syncing.
@@ -233,6 +504,8 @@ func (c *Controller) Run(ctx context.Context, numWorkers int) error {
 		return err
 	}
 
+	c.sweepOrphans(ctx, c.sid)
+
 	c.logger.Info().Int("workers", numWorkers).Msg("Starting workers.")
 	for i := 0; i < numWorkers; i++ {
 		go wait.Until(func() {
@@ -0,0 +1,73 @@
+package controller_test
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/harness"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var widgets = harness.Kind{
+	GVR:  schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1", Resource: "widgets"},
+	Kind: "Widget",
+}
+
+func TestControllerLifecycle(t *testing.T) {
+	env := harness.New(t, harness.Options{Watched: widgets})
+	rec := harness.NewRecorder()
+	env.Start(controller.Options{ExternalClient: rec})
+
+	env.Create(env.NewObject("sample", map[string]interface{}{"value": "a"}))
+
+	el := env.Eventually("sample", func(el *unstructured.Unstructured) bool {
+		return len(el.GetFinalizers()) > 0
+	})
+	assert.Equal(t, []string{"composition.krateo.io/finalizer"}, el.GetFinalizers())
+
+	env.Wait("create", func() bool {
+		return rec.Exists(harness.Namespace, "sample")
+	})
+	env.Wait("observe after create", func() bool {
+		calls := rec.Calls()
+		return calls[len(calls)-1].Op == controller.Observe
+	})
+	assert.Equal(t, controller.Observe, rec.Calls()[0].Op)
+
+	env.Update("sample", func(el *unstructured.Unstructured) {
+		el.Object["spec"] = map[string]interface{}{"value": "b"}
+	})
+	env.Wait("update", func() bool {
+		return rec.Count(controller.Update) == 1
+	})
+
+	env.Delete("sample")
+	env.Wait("delete", func() bool {
+		return !rec.Exists(harness.Namespace, "sample")
+	})
+	// The Observe queued by the finalizer update may run
+	// before the first Create too.
+	assert.LessOrEqual(t, rec.Count(controller.Create), 2)
+}
+
+func TestControllerRetriesFailedCreate(t *testing.T) {
+	env := harness.New(t, harness.Options{Watched: widgets})
+	rec := harness.NewRecorder()
+	rec.Fail(controller.Create, fmt.Errorf("boom"))
+	env.Start(controller.Options{ExternalClient: rec})
+
+	env.Create(env.NewObject("sample", nil))
+
+	env.Wait("create retries", func() bool {
+		return rec.Count(controller.Create) >= 2
+	})
+	assert.False(t, rec.Exists(harness.Namespace, "sample"))
+
+	rec.Fail(controller.Create, nil)
+	env.Wait("create", func() bool {
+		return rec.Exists(harness.Namespace, "sample")
+	})
+}
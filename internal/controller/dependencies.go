@@ -0,0 +1,343 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gobuffalo/flect"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// dependencyRecheckInterval is the delay before the dependencies of a
+// waiting object are checked again, for those not watched by any
+// controller sharing its Dependencies.
+const dependencyRecheckInterval = 30 * time.Second
+
+// Dependencies tracks the objects waiting for their dependencies to
+// requeue them when one of those changes. It can be shared by many
+// controllers, so that the changes seen by one wake up the objects
+// waiting in another. A nil Dependencies tracks nothing.
+type Dependencies struct {
+	mu sync.Mutex
+	// waiting maps each dependency to the requeue of its dependents.
+	waiting map[ObjectRef]map[ObjectRef]func()
+	// deps maps each dependent to its dependencies.
+	deps map[ObjectRef][]ObjectRef
+}
+
+// NewDependencies returns an empty Dependencies.
+func NewDependencies() *Dependencies {
+	return &Dependencies{
+		waiting: map[ObjectRef]map[ObjectRef]func(){},
+		deps:    map[ObjectRef][]ObjectRef{},
+	}
+}
+
+// wait registers the requeue of dependent, run once when
+// one of its dependencies changes.
+func (d *Dependencies) wait(dependent ObjectRef, deps []ObjectRef, requeue func()) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.forgetLocked(dependent)
+	for _, dep := range deps {
+		if d.waiting[dep] == nil {
+			d.waiting[dep] = map[ObjectRef]func(){}
+		}
+		d.waiting[dep][dependent] = requeue
+	}
+	d.deps[dependent] = deps
+}
+
+// forget removes the dependent from the waiting ones.
+func (d *Dependencies) forget(dependent ObjectRef) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.forgetLocked(dependent)
+}
+
+func (d *Dependencies) forgetLocked(dependent ObjectRef) {
+	for _, dep := range d.deps[dependent] {
+		delete(d.waiting[dep], dependent)
+		if len(d.waiting[dep]) == 0 {
+			delete(d.waiting, dep)
+		}
+	}
+	delete(d.deps, dependent)
+}
+
+// changed requeues the objects waiting for ref.
+func (d *Dependencies) changed(ref ObjectRef) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	all := make([]func(), 0, len(d.waiting[ref]))
+	for dependent, requeue := range d.waiting[ref] {
+		all = append(all, requeue)
+		d.forgetLocked(dependent)
+	}
+	d.mu.Unlock()
+
+	for _, requeue := range all {
+		requeue()
+	}
+}
+
+// DependenciesOf returns the objects the specified one depends on, listed
+// in its spec.dependsOn field and its meta.AnnotationKeyDependsOn annotation.
+// The namespace of a dependency defaults to the one of the object.
+func DependenciesOf(el *unstructured.Unstructured) ([]ObjectRef, error) {
+	var res []ObjectRef
+
+	list, _, err := unstructured.NestedSlice(el.Object, "spec", "dependsOn")
+	if err != nil {
+		return nil, fmt.Errorf("spec.dependsOn: %w", err)
+	}
+	for i, x := range list {
+		m, ok := x.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("spec.dependsOn[%d]: not an object", i)
+		}
+		ref := ObjectRef{Namespace: el.GetNamespace()}
+		ref.APIVersion, _ = m["apiVersion"].(string)
+		ref.Kind, _ = m["kind"].(string)
+		ref.Name, _ = m["name"].(string)
+		if len(ref.APIVersion) == 0 || len(ref.Kind) == 0 || len(ref.Name) == 0 {
+			return nil, fmt.Errorf("spec.dependsOn[%d]: apiVersion, kind and name are required", i)
+		}
+		if ns, ok := m["namespace"].(string); ok && len(ns) > 0 {
+			ref.Namespace = ns
+		}
+		res = append(res, ref)
+	}
+
+	for _, s := range strings.Split(el.GetAnnotations()[meta.AnnotationKeyDependsOn], ",") {
+		s = strings.TrimSpace(s)
+		if len(s) == 0 {
+			continue
+		}
+		ref, err := parseDependency(s, el.GetNamespace())
+		if err != nil {
+			return nil, fmt.Errorf("%s annotation: %w", meta.AnnotationKeyDependsOn, err)
+		}
+		res = append(res, ref)
+	}
+
+	return res, nil
+}
+
+// parseDependency parses a Kind.version.group/[namespace/]name reference
+// (Kind.version/[namespace/]name for the core group).
+func parseDependency(s, namespace string) (ObjectRef, error) {
+	kind, rest, ok := strings.Cut(s, "/")
+	if !ok || len(rest) == 0 {
+		return ObjectRef{}, fmt.Errorf("invalid reference %q: missing name", s)
+	}
+	kind, gv, ok := strings.Cut(kind, ".")
+	if !ok || len(kind) == 0 || len(gv) == 0 {
+		return ObjectRef{}, fmt.Errorf("invalid reference %q: missing version", s)
+	}
+	version, group, _ := strings.Cut(gv, ".")
+
+	ref := ObjectRef{
+		APIVersion: schema.GroupVersion{Group: group, Version: version}.String(),
+		Kind:       kind,
+		Name:       rest,
+		Namespace:  namespace,
+	}
+	if ns, name, ok := strings.Cut(rest, "/"); ok {
+		ref.Namespace, ref.Name = ns, name
+	}
+	if len(ref.Name) == 0 || len(ref.Namespace) == 0 || strings.Contains(ref.Name, "/") {
+		return ObjectRef{}, fmt.Errorf("invalid reference %q", s)
+	}
+	return ref, nil
+}
+
+// pendingDependencies returns the dependencies of the object that
+// are not Ready yet, described for the WaitingForDependencies condition.
+func (c *Controller) pendingDependencies(ctx context.Context, deps []ObjectRef) ([]string, error) {
+	var res []string
+	for _, dep := range deps {
+		el, err := c.getDependency(ctx, dep)
+		if apierrors.IsNotFound(err) {
+			res = append(res, describeDependency(dep)+" (not found)")
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !isReady(el) {
+			res = append(res, describeDependency(dep))
+		}
+	}
+	return res, nil
+}
+
+// dependencyCycle returns the path leading from the object back to
+// itself through its dependencies, or nil if it does not depend on itself.
+// The dependencies that are missing or with invalid references are skipped:
+// those are reported on their own.
+func (c *Controller) dependencyCycle(ctx context.Context, ref ObjectRef, deps []ObjectRef) ([]ObjectRef, error) {
+	seen := map[ObjectRef]bool{}
+
+	var walk func(path, deps []ObjectRef) ([]ObjectRef, error)
+	walk = func(path, deps []ObjectRef) ([]ObjectRef, error) {
+		for _, dep := range deps {
+			if dep == ref {
+				return append(path, dep), nil
+			}
+			if seen[dep] {
+				continue
+			}
+			seen[dep] = true
+
+			el, err := c.getDependency(ctx, dep)
+			if apierrors.IsNotFound(err) {
+				continue
+			}
+			if err != nil {
+				return nil, err
+			}
+			next, err := DependenciesOf(el)
+			if err != nil {
+				continue
+			}
+			if res, err := walk(append(path, dep), next); res != nil || err != nil {
+				return res, err
+			}
+		}
+		return nil, nil
+	}
+
+	return walk([]ObjectRef{ref}, deps)
+}
+
+func (c *Controller) getDependency(ctx context.Context, dep ObjectRef) (*unstructured.Unstructured, error) {
+	gv, err := schema.ParseGroupVersion(dep.APIVersion)
+	if err != nil {
+		return nil, err
+	}
+	gvr := gv.WithResource(strings.ToLower(flect.Pluralize(dep.Kind)))
+
+	return c.dynamicClient.Resource(gvr).Namespace(dep.Namespace).
+		Get(ctx, dep.Name, metav1.GetOptions{})
+}
+
+func describeCycle(cycle []ObjectRef) string {
+	all := make([]string, 0, len(cycle))
+	for _, dep := range cycle {
+		all = append(all, describeDependency(dep))
+	}
+	return "Dependency cycle: " + strings.Join(all, " -> ")
+}
+
+func describeDependency(dep ObjectRef) string {
+	return fmt.Sprintf("%s %s/%s", dep.Kind, dep.Namespace, dep.Name)
+}
+
+// isReady returns true if the object has a Ready condition set to True.
+func isReady(el *unstructured.Unstructured) bool {
+	conds, _, _ := unstructured.NestedSlice(el.Object, "status", "conditions")
+	for _, x := range conds {
+		m, ok := x.(map[string]interface{})
+		if ok && m["type"] == condition.TypeReady {
+			return m["status"] == string(metav1.ConditionTrue)
+		}
+	}
+	return false
+}
+
+// waitForDependencies returns true if the operation on the object must
+// wait for its dependencies. The object is then marked as waiting and
+// requeued when one of them changes.
+func (c *Controller) waitForDependencies(ctx context.Context, et EventType, el *unstructured.Unstructured) (bool, error) {
+	ref := refOf(el)
+
+	deps, err := DependenciesOf(el)
+	if err != nil || len(deps) == 0 {
+		c.deps.forget(ref)
+		return false, err
+	}
+
+	// Registered before checking, not to miss a change in between.
+	requeue := func() {
+		c.queue.Add(event{eventType: et, objectRef: ref})
+	}
+	c.deps.wait(ref, deps, requeue)
+
+	pending, err := c.pendingDependencies(ctx, deps)
+	if err != nil || len(pending) == 0 {
+		c.deps.forget(ref)
+		return false, err
+	}
+
+	cycle, err := c.dependencyCycle(ctx, ref, deps)
+	if err != nil {
+		c.deps.forget(ref)
+		return false, err
+	}
+	if len(cycle) > 0 {
+		// Waiting would never end: requeued by an edit of the object only.
+		c.deps.forget(ref)
+
+		msg := describeCycle(cycle)
+		c.logger.Warn().Str("objectRef", ref.String()).
+			Str("eventType", string(et)).
+			Msg(msg)
+
+		if err := c.updateCondition(ctx, el, condition.DependencyCycle(msg)); err != nil {
+			c.logger.Err(err).Msg("Updating status with dependency cycle condition.")
+		}
+		return true, nil
+	}
+
+	c.recheckDependencies(event{eventType: et, objectRef: ref})
+
+	msg := "Waiting for " + strings.Join(pending, ", ")
+	c.logger.Debug().Str("objectRef", ref.String()).
+		Str("eventType", string(et)).
+		Msg(msg)
+
+	// Unchanged, not written again: the write would wake up the
+	// objects waiting for this one.
+	if err := c.updateCondition(ctx, el, condition.WaitingForDependencies(msg)); err != nil {
+		c.logger.Err(err).Msg("Updating status with waiting for dependencies condition.")
+	}
+	return true, nil
+}
+
+// recheckDependencies queues the event after dependencyRecheckInterval,
+// unless it is already scheduled.
+func (c *Controller) recheckDependencies(evt event) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.rechecks[evt]; ok {
+		return
+	}
+	c.rechecks[evt] = struct{}{}
+
+	time.AfterFunc(dependencyRecheckInterval, func() {
+		c.mu.Lock()
+		delete(c.rechecks, evt)
+		c.mu.Unlock()
+
+		c.queue.Add(evt)
+	})
+}
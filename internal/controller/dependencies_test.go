@@ -0,0 +1,174 @@
+package controller_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/harness"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestDependenciesOf(t *testing.T) {
+	table := []struct {
+		name       string
+		spec       map[string]interface{}
+		annotation string
+		want       []controller.ObjectRef
+		fail       bool
+	}{
+		{
+			name: "none",
+		},
+		{
+			name: "spec",
+			spec: map[string]interface{}{
+				"dependsOn": []interface{}{
+					map[string]interface{}{"apiVersion": "composition.krateo.io/v1", "kind": "Widget", "name": "net"},
+					map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap", "name": "cfg", "namespace": "shared"},
+				},
+			},
+			want: []controller.ObjectRef{
+				{APIVersion: "composition.krateo.io/v1", Kind: "Widget", Name: "net", Namespace: harness.Namespace},
+				{APIVersion: "v1", Kind: "ConfigMap", Name: "cfg", Namespace: "shared"},
+			},
+		},
+		{
+			name:       "annotation",
+			annotation: "Widget.v1.composition.krateo.io/net, ConfigMap.v1/shared/cfg",
+			want: []controller.ObjectRef{
+				{APIVersion: "composition.krateo.io/v1", Kind: "Widget", Name: "net", Namespace: harness.Namespace},
+				{APIVersion: "v1", Kind: "ConfigMap", Name: "cfg", Namespace: "shared"},
+			},
+		},
+		{
+			name: "missing name",
+			spec: map[string]interface{}{
+				"dependsOn": []interface{}{
+					map[string]interface{}{"apiVersion": "v1", "kind": "ConfigMap"},
+				},
+			},
+			fail: true,
+		},
+		{
+			name:       "missing version",
+			annotation: "Widget/net",
+			fail:       true,
+		},
+		{
+			name:       "too many segments",
+			annotation: "Widget.v1/a/b/c",
+			fail:       true,
+		},
+	}
+
+	for _, tc := range table {
+		t.Run(tc.name, func(t *testing.T) {
+			el := &unstructured.Unstructured{Object: map[string]interface{}{}}
+			el.SetNamespace(harness.Namespace)
+			if tc.spec != nil {
+				el.Object["spec"] = tc.spec
+			}
+			if len(tc.annotation) > 0 {
+				el.SetAnnotations(map[string]string{meta.AnnotationKeyDependsOn: tc.annotation})
+			}
+
+			got, err := controller.DependenciesOf(el)
+			if tc.fail {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestControllerWaitsForDependencies(t *testing.T) {
+	env := harness.New(t, harness.Options{Watched: widgets})
+	rec := harness.NewRecorder()
+	env.Start(controller.Options{ExternalClient: rec})
+
+	env.Create(env.NewObject("app", map[string]interface{}{
+		"dependsOn": []interface{}{
+			map[string]interface{}{"apiVersion": "composition.krateo.io/v1", "kind": "Widget", "name": "net"},
+		},
+	}))
+
+	el := env.Eventually("app", func(el *unstructured.Unstructured) bool {
+		return readyReason(el) == condition.ReasonWaitingForDependencies
+	})
+	assert.Contains(t, readyMessage(el), "Widget default/net (not found)")
+
+	env.Create(env.NewObject("net", nil))
+	env.Wait("dependency create", func() bool {
+		return rec.Exists(harness.Namespace, "net")
+	})
+	assert.False(t, rec.Exists(harness.Namespace, "app"))
+
+	env.UpdateStatus("net", func(el *unstructured.Unstructured) {
+		unstructured.SetNestedSlice(el.Object, []interface{}{
+			map[string]interface{}{"type": "Ready", "status": "True", "reason": "Available"},
+		}, "status", "conditions")
+	})
+	env.Wait("create after the dependency is ready", func() bool {
+		return rec.Exists(harness.Namespace, "app")
+	})
+}
+
+func TestControllerReportsDependencyCycles(t *testing.T) {
+	env := harness.New(t, harness.Options{Watched: widgets})
+	rec := harness.NewRecorder()
+	env.Start(controller.Options{ExternalClient: rec})
+
+	dependsOn := func(name string) map[string]interface{} {
+		return map[string]interface{}{
+			"dependsOn": []interface{}{
+				map[string]interface{}{"apiVersion": "composition.krateo.io/v1", "kind": "Widget", "name": name},
+			},
+		}
+	}
+	env.Create(env.NewObject("a", dependsOn("b")))
+	env.Eventually("a", func(el *unstructured.Unstructured) bool {
+		return readyReason(el) == condition.ReasonWaitingForDependencies
+	})
+	env.Create(env.NewObject("b", dependsOn("a")))
+
+	for _, name := range []string{"a", "b"} {
+		el := env.Eventually(name, func(el *unstructured.Unstructured) bool {
+			return readyReason(el) == condition.ReasonDependencyCycle
+		})
+		assert.Contains(t, readyMessage(el), "Widget default/a -> Widget default/b")
+	}
+
+	// No more status writes once reported.
+	rv := env.Get("a").GetResourceVersion()
+	time.Sleep(200 * time.Millisecond)
+	assert.Equal(t, rv, env.Get("a").GetResourceVersion())
+	assert.False(t, rec.Exists(harness.Namespace, "a"))
+	assert.False(t, rec.Exists(harness.Namespace, "b"))
+}
+
+func readyReason(el *unstructured.Unstructured) string {
+	return readyField(el, "reason")
+}
+
+func readyMessage(el *unstructured.Unstructured) string {
+	return readyField(el, "message")
+}
+
+// readyField returns a field of the Ready condition.
+func readyField(el *unstructured.Unstructured, field string) string {
+	all, _, _ := unstructured.NestedSlice(el.Object, "status", "conditions")
+	for _, co := range all {
+		co, ok := co.(map[string]interface{})
+		if ok && co["type"] == condition.TypeReady {
+			res, _ := co[field].(string)
+			return res
+		}
+	}
+	return ""
+}
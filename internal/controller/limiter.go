@@ -0,0 +1,99 @@
+package controller
+
+import (
+	"sync"
+)
+
+// NamespaceLimiter caps the number of events of the same namespace
+// processed at the same time (thus the concurrent external operations),
+// across all the controllers sharing it.
+type NamespaceLimiter struct {
+	mu      sync.Mutex
+	max     int
+	limits  map[string]int
+	active  map[string]int
+	waiters []func()
+}
+
+// NewNamespaceLimiter returns a limiter allowing max concurrent events
+// per namespace, unless overridden in limits; zero means no cap.
+func NewNamespaceLimiter(max int, limits map[string]int) *NamespaceLimiter {
+	l := &NamespaceLimiter{
+		active: map[string]int{},
+	}
+	l.SetLimits(max, limits)
+	return l
+}
+
+// SetLimits replaces the caps; the events already being processed
+// are not affected.
+func (l *NamespaceLimiter) SetLimits(max int, limits map[string]int) {
+	all := make(map[string]int, len(limits))
+	for k, v := range limits {
+		all[k] = v
+	}
+
+	l.mu.Lock()
+	l.max, l.limits = max, all
+	waiters := l.waiters
+	l.mu.Unlock()
+
+	// Raised caps may unblock the waiting queues.
+	for _, fn := range waiters {
+		fn()
+	}
+}
+
+// Limit returns the cap of the specified namespace (zero means no cap).
+func (l *NamespaceLimiter) Limit(ns string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.limit(ns)
+}
+
+func (l *NamespaceLimiter) limit(ns string) int {
+	if n, ok := l.limits[ns]; ok {
+		return n
+	}
+	return l.max
+}
+
+// Active returns the number of events of the namespace being processed.
+func (l *NamespaceLimiter) Active(ns string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.active[ns]
+}
+
+func (l *NamespaceLimiter) tryAcquire(ns string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if n := l.limit(ns); n > 0 && l.active[ns] >= n {
+		return false
+	}
+	l.active[ns]++
+	return true
+}
+
+func (l *NamespaceLimiter) release(ns string) {
+	l.mu.Lock()
+	if l.active[ns] <= 1 {
+		delete(l.active, ns)
+	} else {
+		l.active[ns]--
+	}
+	waiters := l.waiters
+	l.mu.Unlock()
+
+	for _, fn := range waiters {
+		fn()
+	}
+}
+
+// subscribe registers a function invoked when a slot may have been freed.
+func (l *NamespaceLimiter) subscribe(fn func()) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.waiters = append(l.waiters, fn)
+}
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/maintenance"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// maintenanceWindow is a compiled maintenance window with its spec,
+// on top of which the annotations of the objects are applied.
+type maintenanceWindow struct {
+	spec   maintenance.Spec
+	window *maintenance.Window
+}
+
+// SetMaintenance changes the default maintenance window of the objects.
+// It is safe to call while the controller is running.
+func (c *Controller) SetMaintenance(spec maintenance.Spec) error {
+	w, err := maintenance.New(spec)
+	if err != nil {
+		return err
+	}
+	c.maintenance.Store(&maintenanceWindow{spec: spec, window: w})
+	return nil
+}
+
+// windowFor returns the maintenance window of the object: the default
+// one overridden by the meta.AnnotationKeyMaintenanceWindow annotations.
+func (c *Controller) windowFor(el *unstructured.Unstructured) (*maintenance.Window, error) {
+	def := c.maintenance.Load()
+	if def == nil {
+		def = &maintenanceWindow{}
+	}
+
+	spec, changed := def.spec, false
+	a := el.GetAnnotations()
+	if val, ok := a[meta.AnnotationKeyMaintenanceWindow]; ok {
+		if val == "none" {
+			return nil, nil
+		}
+		spec.Schedule, changed = val, true
+	}
+	if val, ok := a[meta.AnnotationKeyMaintenanceWindowPrefix+"duration"]; ok {
+		d, err := time.ParseDuration(val)
+		if err != nil {
+			return def.window, fmt.Errorf("invalid maintenance window duration: %w", err)
+		}
+		spec.Duration, changed = d, true
+	}
+	if val, ok := a[meta.AnnotationKeyMaintenanceWindowPrefix+"timezone"]; ok {
+		spec.Timezone, changed = val, true
+	}
+	if val, ok := a[meta.AnnotationKeyMaintenanceWindowPrefix+"create"]; ok {
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return def.window, fmt.Errorf("invalid maintenance window create: %w", err)
+		}
+		spec.GateCreate, changed = b, true
+	}
+	if !changed {
+		return def.window, nil
+	}
+
+	w, err := maintenance.New(spec)
+	if err != nil {
+		return def.window, err
+	}
+	return w, nil
+}
+
+// maintenanceClosed returns true if the operation on the object must
+// wait for its maintenance window, with the reason why.
+func (c *Controller) maintenanceClosed(et EventType, el *unstructured.Unstructured) (next time.Time, msg string, closed bool) {
+	w, err := c.windowFor(el)
+	if err != nil {
+		c.logger.Warn().Err(err).
+			Str("name", el.GetName()).
+			Str("namespace", el.GetNamespace()).
+			Msg("Ignoring maintenance window annotations.")
+	}
+	if et == Create && !w.GatesCreate() {
+		return time.Time{}, "", false
+	}
+
+	now := time.Now()
+	next = w.NextOpen(now)
+	if next.Equal(now) {
+		return time.Time{}, "", false
+	}
+	if next.IsZero() {
+		return next, fmt.Sprintf("%s deferred: no maintenance window ahead", et), true
+	}
+	return next, fmt.Sprintf("%s deferred to the maintenance window opening at %s", et, next.Format(time.RFC3339)), true
+}
+
+// deferToMaintenance returns true if the operation on the object must
+// wait for its maintenance window: it is then requeued at the window
+// opening, and the object is marked with the time it is deferred to
+// (unless it is the tombstone of an object already gone).
+func (c *Controller) deferToMaintenance(ctx context.Context, et EventType, el *unstructured.Unstructured, tombstone bool) bool {
+	next, msg, closed := c.maintenanceClosed(et, el)
+	if !closed {
+		return false
+	}
+
+	ref := refOf(el)
+	if !next.IsZero() {
+		c.queue.AddAfter(event{eventType: et, objectRef: ref}, time.Until(next))
+	}
+	c.logger.Debug().Str("objectRef", ref.String()).
+		Str("eventType", string(et)).
+		Msg(msg)
+
+	if tombstone {
+		return true
+	}
+	if err := c.updateCondition(ctx, el, condition.MaintenanceWindowClosed(msg)); err != nil {
+		c.logger.Err(err).Msg("Updating status with maintenance window closed condition.")
+	}
+	return true
+}
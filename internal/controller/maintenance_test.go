@@ -0,0 +1,80 @@
+package controller_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/harness"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/maintenance"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// closedWindow returns a schedule whose one minute window opens
+// in half an hour.
+func closedWindow() string {
+	return fmt.Sprintf("%d * * * *", (time.Now().UTC().Minute()+30)%60)
+}
+
+func deferred(op controller.EventType) func(el *unstructured.Unstructured) bool {
+	return func(el *unstructured.Unstructured) bool {
+		return readyReason(el) == condition.ReasonMaintenanceWindowClosed &&
+			strings.HasPrefix(readyMessage(el), string(op)+" deferred to the maintenance window opening at")
+	}
+}
+
+func TestControllerDefersToMaintenanceWindow(t *testing.T) {
+	env := harness.New(t, harness.Options{Watched: widgets})
+	rec := harness.NewRecorder()
+	env.Start(controller.Options{
+		ExternalClient: rec,
+		Maintenance: maintenance.Spec{
+			Schedule: closedWindow(),
+			Duration: time.Minute,
+		},
+	})
+
+	env.Create(env.NewObject("sample", map[string]interface{}{"value": "a"}))
+	env.Wait("create", func() bool {
+		return rec.Exists(harness.Namespace, "sample")
+	})
+
+	env.Update("sample", func(el *unstructured.Unstructured) {
+		el.Object["spec"] = map[string]interface{}{"value": "b"}
+	})
+	env.Eventually("sample", deferred(controller.Update))
+	assert.Equal(t, 0, rec.Count(controller.Update))
+
+	env.Delete("sample")
+	env.Eventually("sample", deferred(controller.Delete))
+	assert.True(t, rec.Exists(harness.Namespace, "sample"))
+
+	env.Update("sample", func(el *unstructured.Unstructured) {
+		meta.AddAnnotations(el, map[string]string{meta.AnnotationKeyMaintenanceWindow: "none"})
+	})
+	env.Wait("delete", func() bool {
+		return rec.Count(controller.Delete) == 1
+	})
+}
+
+func TestControllerDefersCreateByAnnotation(t *testing.T) {
+	env := harness.New(t, harness.Options{Watched: widgets})
+	rec := harness.NewRecorder()
+	env.Start(controller.Options{ExternalClient: rec})
+
+	el := env.NewObject("sample", nil)
+	el.SetAnnotations(map[string]string{
+		meta.AnnotationKeyMaintenanceWindow:                    closedWindow(),
+		meta.AnnotationKeyMaintenanceWindowPrefix + "duration": "1m",
+		meta.AnnotationKeyMaintenanceWindowPrefix + "create":   "true",
+	})
+	env.Create(el)
+
+	env.Eventually("sample", deferred(controller.Create))
+	assert.Equal(t, 0, rec.Count(controller.Create))
+}
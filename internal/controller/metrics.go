@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	resultSuccess = "success"
+	resultError   = "error"
+	resultTimeout = "timeout"
+	resultPending = "pending"
+)
+
+var (
+	operationDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "composition_controller",
+		Name:      "operation_duration_seconds",
+		Help:      "Duration of the external client operations by resource, operation and result (success, error, timeout or pending).",
+		Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120, 300, 600},
+	}, []string{"resource", "operation", "result"})
+
+	operationTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "composition_controller",
+		Name:      "operation_timeouts_total",
+		Help:      "Number of the external client operations that did not complete within their deadline.",
+	}, []string{"resource", "operation"})
+
+	orphans = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "composition_controller",
+		Name:      "orphans",
+		Help:      "Number of the external resources whose object was found deleted by the last inventory sweep.",
+	}, []string{"resource"})
+)
+
+func init() {
+	prometheus.MustRegister(operationDuration, operationTimeouts, orphans)
+}
+
+func observeOperation(gvr schema.GroupVersionResource, et EventType, d time.Duration, err error) {
+	resource := gvr.GroupResource().String()
+
+	result := resultSuccess
+	if IsTimeout(err) {
+		result = resultTimeout
+		operationTimeouts.WithLabelValues(resource, string(et)).Inc()
+	} else if IsRequeue(err) {
+		result = resultPending
+	} else if err != nil {
+		result = resultError
+	}
+
+	operationDuration.WithLabelValues(resource, string(et), result).Observe(d.Seconds())
+}
@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/rs/zerolog"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// A Middleware decorates an ExternalClient with a cross-cutting behaviour.
+type Middleware func(next ExternalClient) ExternalClient
+
+// Chain decorates the client with the middlewares: the first one
+// is the outermost, i.e. it runs first and returns last.
+func Chain(ec ExternalClient, mws ...Middleware) ExternalClient {
+	for i := len(mws) - 1; i >= 0; i-- {
+		ec = mws[i](ec)
+	}
+	return ec
+}
+
+// An Interceptor runs around a single ExternalClient operation;
+// call invokes the next client of the chain (for an Observe, the
+// result is returned by the outer Observe).
+type Interceptor func(ctx context.Context, op EventType, mg *unstructured.Unstructured, call func(context.Context) error) error
+
+// Intercept returns a Middleware running fn around all the operations.
+func Intercept(fn Interceptor) Middleware {
+	return func(next ExternalClient) ExternalClient {
+		return &intercepted{next: next, fn: fn}
+	}
+}
+
+var _ ExternalClient = (*intercepted)(nil)
+
+type intercepted struct {
+	next ExternalClient
+	fn   Interceptor
+}
+
+func (i *intercepted) Observe(ctx context.Context, mg *unstructured.Unstructured) (bool, error) {
+	var exists bool
+	err := i.fn(ctx, Observe, mg, func(ctx context.Context) (err error) {
+		exists, err = i.next.Observe(ctx, mg)
+		return err
+	})
+	return exists, err
+}
+
+func (i *intercepted) Create(ctx context.Context, mg *unstructured.Unstructured) error {
+	return i.fn(ctx, Create, mg, func(ctx context.Context) error {
+		return i.next.Create(ctx, mg)
+	})
+}
+
+func (i *intercepted) Update(ctx context.Context, mg *unstructured.Unstructured) error {
+	return i.fn(ctx, Update, mg, func(ctx context.Context) error {
+		return i.next.Update(ctx, mg)
+	})
+}
+
+func (i *intercepted) Delete(ctx context.Context, mg *unstructured.Unstructured) error {
+	return i.fn(ctx, Delete, mg, func(ctx context.Context) error {
+		return i.next.Delete(ctx, mg)
+	})
+}
+
+type loggingKey struct{}
+
+// WithLogging stores in the ctx a logger bound to the operation and the
+// object (get it with zerolog.Ctx) and logs the outcome. When the ctx
+// already holds one, the operation is passed through as is, so that
+// both the controller and the backends can use it.
+func WithLogging(log *zerolog.Logger) Middleware {
+	return Intercept(func(ctx context.Context, op EventType, mg *unstructured.Unstructured, call func(context.Context) error) error {
+		if ctx.Value(loggingKey{}) != nil {
+			return call(ctx)
+		}
+
+		l := log.With().
+			Str("op", string(op)).
+			Str("apiVersion", mg.GetAPIVersion()).
+			Str("kind", mg.GetKind()).
+			Str("name", mg.GetName()).
+			Str("namespace", mg.GetNamespace()).Logger()
+		ctx = context.WithValue(l.WithContext(ctx), loggingKey{}, true)
+
+		start := time.Now()
+		err := call(ctx)
+		if err != nil {
+			l.Debug().Err(err).Dur("duration", time.Since(start)).Msg("External client operation failed.")
+		} else {
+			l.Debug().Dur("duration", time.Since(start)).Msg("External client operation completed.")
+		}
+		return err
+	})
+}
+
+// WithMetrics records the duration and the result of the operations
+// (see composition_controller_operation_duration_seconds).
+func WithMetrics(gvr schema.GroupVersionResource) Middleware {
+	return Intercept(func(ctx context.Context, op EventType, mg *unstructured.Unstructured, call func(context.Context) error) error {
+		start := time.Now()
+		err := call(ctx)
+		observeOperation(gvr, op, time.Since(start), err)
+		return err
+	})
+}
+
+// WithPolicy skips the operations of the paused objects and those
+// not allowed by their management policy annotation. A skipped
+// Observe reports the external resource as existing, so that no
+// Create follows.
+func WithPolicy() Middleware {
+	return func(next ExternalClient) ExternalClient {
+		return &policyClient{next: next}
+	}
+}
+
+var _ ExternalClient = (*policyClient)(nil)
+
+type policyClient struct {
+	next ExternalClient
+}
+
+func (p *policyClient) Observe(ctx context.Context, mg *unstructured.Unstructured) (bool, error) {
+	if !p.allowed(ctx, mg, "") {
+		return true, nil
+	}
+	return p.next.Observe(ctx, mg)
+}
+
+func (p *policyClient) Create(ctx context.Context, mg *unstructured.Unstructured) error {
+	if !p.allowed(ctx, mg, meta.ActionCreate) {
+		return nil
+	}
+	return p.next.Create(ctx, mg)
+}
+
+func (p *policyClient) Update(ctx context.Context, mg *unstructured.Unstructured) error {
+	if !p.allowed(ctx, mg, meta.ActionUpdate) {
+		return nil
+	}
+	return p.next.Update(ctx, mg)
+}
+
+func (p *policyClient) Delete(ctx context.Context, mg *unstructured.Unstructured) error {
+	if !p.allowed(ctx, mg, meta.ActionDelete) {
+		return nil
+	}
+	return p.next.Delete(ctx, mg)
+}
+
+func (p *policyClient) allowed(ctx context.Context, mg *unstructured.Unstructured, action string) bool {
+	if meta.IsPaused(mg) {
+		zerolog.Ctx(ctx).Debug().Msg("Reconciliation paused, skipping.")
+		return false
+	}
+	if len(action) > 0 && !meta.IsActionAllowed(mg, action) {
+		zerolog.Ctx(ctx).Info().
+			Str("policy", mg.GetAnnotations()[meta.AnnotationKeyManagementPolicy]).
+			Msgf("Action %s not allowed by the management policy, skipping.", action)
+		return false
+	}
+	return true
+}
+
+// WithTimeouts bounds every operation with the deadline returned by fn;
+// a deadline hit is returned as a TimeoutError.
+func WithTimeouts(fn func(op EventType, mg *unstructured.Unstructured) time.Duration) Middleware {
+	return Intercept(func(ctx context.Context, op EventType, mg *unstructured.Unstructured, call func(context.Context) error) error {
+		timeout := fn(op, mg)
+
+		opCtx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		err := call(opCtx)
+		if errors.Is(opCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil {
+			if err == nil {
+				err = context.DeadlineExceeded
+			}
+			err = &TimeoutError{Op: op, Timeout: timeout, Err: err}
+		}
+		return err
+	})
+}
+
+// WithErrorHandler invokes fn with the errors of the operations,
+// e.g. to report them as conditions or events on the object; not
+// with the RequeueErrors. The error is returned unchanged.
+func WithErrorHandler(fn func(ctx context.Context, op EventType, mg *unstructured.Unstructured, err error)) Middleware {
+	return Intercept(func(ctx context.Context, op EventType, mg *unstructured.Unstructured, call func(context.Context) error) error {
+		err := call(ctx)
+		if err != nil && !IsRequeue(err) {
+			fn(ctx, op, mg, err)
+		}
+		return err
+	})
+}
+
+// WithStatus writes the status of the object with fn when the operation
+// changed it, whatever its outcome: the backends only set the status
+// (i.e. their conditions and the response fields). The objects already
+// gone are skipped. A failed write fails a successful operation.
+func WithStatus(fn func(ctx context.Context, mg *unstructured.Unstructured) error) Middleware {
+	return Intercept(func(ctx context.Context, op EventType, mg *unstructured.Unstructured, call func(context.Context) error) error {
+		before, _, _ := unstructured.NestedFieldCopy(mg.Object, "status")
+		err := call(ctx)
+		after, _, _ := unstructured.NestedFieldNoCopy(mg.Object, "status")
+		if equality.Semantic.DeepEqual(before, after) {
+			return err
+		}
+
+		e := fn(ctx, mg)
+		if e == nil || apierrors.IsNotFound(e) {
+			return err
+		}
+		if err != nil {
+			zerolog.Ctx(ctx).Err(e).Msg("Updating status.")
+			return err
+		}
+		return e
+	})
+}
+
+// WithPrecondition runs fn before every operation, failing the
+// operation with its error (e.g. for missing dependencies).
+func WithPrecondition(fn func(ctx context.Context, mg *unstructured.Unstructured) error) Middleware {
+	return Intercept(func(ctx context.Context, op EventType, mg *unstructured.Unstructured, call func(context.Context) error) error {
+		if err := fn(ctx, mg); err != nil {
+			return err
+		}
+		return call(ctx)
+	})
+}
@@ -0,0 +1,139 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// tracer returns a middleware appending its name to the trace
+// before and after every operation.
+func tracer(name string, trace *[]string) Middleware {
+	return Intercept(func(ctx context.Context, op EventType, _ *unstructured.Unstructured, call func(context.Context) error) error {
+		*trace = append(*trace, name+">"+string(op))
+		err := call(ctx)
+		*trace = append(*trace, name+"<"+string(op))
+		return err
+	})
+}
+
+func TestChainOrder(t *testing.T) {
+	trace := []string{}
+	ec := Chain(&recordingClient{}, tracer("a", &trace), tracer("b", &trace))
+
+	exists, err := ec.Observe(context.TODO(), newTestObject("sample"))
+	assert.Nil(t, err)
+	assert.True(t, exists)
+	assert.Nil(t, ec.Delete(context.TODO(), newTestObject("sample")))
+
+	assert.Equal(t, []string{
+		"a>Observe", "b>Observe", "b<Observe", "a<Observe",
+		"a>Delete", "b>Delete", "b<Delete", "a<Delete",
+	}, trace)
+}
+
+func TestWithPolicy(t *testing.T) {
+	rc := &onceClient{}
+	ec := Chain(rc, WithPolicy())
+
+	obj := newTestObject("missing")
+	obj.SetAnnotations(map[string]string{meta.AnnotationKeyManagementPolicy: meta.ManagementPolicyObserveDelete})
+	exists, err := ec.Observe(context.TODO(), obj)
+	assert.Nil(t, err)
+	assert.False(t, exists)
+	assert.Nil(t, ec.Create(context.TODO(), obj))
+	assert.Nil(t, ec.Update(context.TODO(), obj))
+	assert.Nil(t, ec.Delete(context.TODO(), obj))
+	assert.Equal(t, []string{"Delete missing"}, rc.calls)
+
+	rc.calls = nil
+	obj.SetAnnotations(map[string]string{meta.AnnotationKeyReconciliationPaused: "true"})
+	exists, err = ec.Observe(context.TODO(), obj)
+	assert.Nil(t, err)
+	// No Create must follow.
+	assert.True(t, exists)
+	assert.Nil(t, ec.Delete(context.TODO(), obj))
+	assert.Empty(t, rc.calls)
+}
+
+func TestWithTimeouts(t *testing.T) {
+	ec := Chain(hangingClient{}, WithTimeouts(func(op EventType, _ *unstructured.Unstructured) time.Duration {
+		if op == Delete {
+			return 10 * time.Millisecond
+		}
+		return time.Hour
+	}))
+
+	var te *TimeoutError
+	if assert.ErrorAs(t, ec.Delete(context.TODO(), newTestObject("sample")), &te) {
+		assert.Equal(t, Delete, te.Op)
+	}
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 10*time.Millisecond)
+	defer cancel()
+	assert.False(t, IsTimeout(ec.Create(ctx, newTestObject("sample"))))
+}
+
+func TestWithLogging(t *testing.T) {
+	buf := &bytes.Buffer{}
+	log := zerolog.New(buf).Level(zerolog.DebugLevel)
+
+	inner := Intercept(func(ctx context.Context, _ EventType, _ *unstructured.Unstructured, call func(context.Context) error) error {
+		zerolog.Ctx(ctx).Info().Msg("from backend")
+		return call(ctx)
+	})
+	// Applied twice, as the controller and a backend would do.
+	ec := Chain(&recordingClient{}, WithLogging(&log), WithLogging(&log), inner)
+	assert.Nil(t, ec.Update(context.TODO(), newTestObject("sample")))
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if assert.Equal(t, 2, len(lines)) {
+		assert.Contains(t, lines[0], `"op":"Update"`)
+		assert.Contains(t, lines[0], `"name":"sample"`)
+		assert.Contains(t, lines[0], "from backend")
+		assert.Contains(t, lines[1], "operation completed")
+	}
+}
+
+func TestWithStatus(t *testing.T) {
+	writes := 0
+	ec := Chain(&recordingClient{},
+		WithStatus(func(context.Context, *unstructured.Unstructured) error {
+			writes++
+			return nil
+		}),
+		Intercept(func(ctx context.Context, op EventType, mg *unstructured.Unstructured, call func(context.Context) error) error {
+			if op == Observe {
+				return call(ctx)
+			}
+			_ = unstructured.SetNestedField(mg.Object, string(op), "status", "phase")
+			if op == Delete {
+				return errors.New("failed")
+			}
+			return call(ctx)
+		}),
+	)
+
+	obj := newTestObject("sample")
+	_, err := ec.Observe(context.TODO(), obj)
+	assert.Nil(t, err)
+	assert.Equal(t, 0, writes)
+
+	assert.Nil(t, ec.Create(context.TODO(), obj))
+	assert.Equal(t, 1, writes)
+	// Unchanged.
+	assert.Nil(t, ec.Create(context.TODO(), obj))
+	assert.Equal(t, 1, writes)
+
+	// Written also when failing.
+	assert.EqualError(t, ec.Delete(context.TODO(), obj), "failed")
+	assert.Equal(t, 2, writes)
+}
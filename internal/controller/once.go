@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	// OutcomeSucceeded is the outcome of a reconciliation without errors.
+	OutcomeSucceeded = "Succeeded"
+	// OutcomeFailed is the outcome of a failed reconciliation.
+	OutcomeFailed = "Failed"
+	// OutcomeDeferred is the outcome of a reconciliation postponed on
+	// purpose: a closed maintenance window, dependencies not ready yet
+	// or an operation of the external system still running.
+	OutcomeDeferred = "Deferred"
+
+	// ActionNone means the external resource needed no change.
+	ActionNone EventType = "None"
+)
+
+// Result is the outcome of the one-shot reconciliation of an object.
+type Result struct {
+	Ref ObjectRef `json:"ref"`
+	// Exists reports the Observe result.
+	Exists bool `json:"exists"`
+	// Action is the operation run after the Observe.
+	Action  EventType `json:"action"`
+	Outcome string    `json:"outcome"`
+	Error   string    `json:"error,omitempty"`
+	// Reason tells why a Deferred reconciliation was postponed.
+	Reason string `json:"reason,omitempty"`
+	// Duration is the total time spent on the object, in milliseconds.
+	Duration int64 `json:"durationMs"`
+}
+
+// Summary is the outcome of the one-shot reconciliation of a resource.
+type Summary struct {
+	Resource  string   `json:"resource"`
+	Total     int      `json:"total"`
+	Succeeded int      `json:"succeeded"`
+	Failed    int      `json:"failed"`
+	Deferred  int      `json:"deferred"`
+	Error     string   `json:"error,omitempty"`
+	Results   []Result `json:"results"`
+}
+
+// RunOnce reconciles all the objects of the watched resource one time,
+// without the informer and the work queue: every object is observed and
+// then deleted, created or updated as needed. The returned error is only
+// about listing the objects; the failures and the postponed objects are
+// reported in the summary.
+func (c *Controller) RunOnce(ctx context.Context) (*Summary, error) {
+	res := &Summary{
+		Resource: c.gvr.GroupResource().String(),
+		Results:  []Result{},
+	}
+
+	all, err := c.dynamicClient.Resource(c.gvr).
+		Namespace(c.namespace).
+		List(ctx, metav1.ListOptions{})
+	if err != nil {
+		res.Error = err.Error()
+		return res, err
+	}
+
+	for i := range all.Items {
+		el := &all.Items[i]
+		if c.sharder != nil && !c.sharder.Owns(el.GetNamespace(), el.GetName()) {
+			continue
+		}
+
+		r := c.reconcileOnce(ctx, el)
+		switch r.Outcome {
+		case OutcomeFailed:
+			res.Failed++
+		case OutcomeDeferred:
+			res.Deferred++
+		default:
+			res.Succeeded++
+		}
+		res.Results = append(res.Results, r)
+	}
+	res.Total = len(res.Results)
+
+	return res, nil
+}
+
+// reconcileOnce runs the Observe and the needed action on the object,
+// following the same rules as the workers.
+func (c *Controller) reconcileOnce(ctx context.Context, el *unstructured.Unstructured) Result {
+	start := time.Now()
+	res := Result{Ref: refOf(el), Action: ActionNone, Outcome: OutcomeSucceeded}
+	defer func() {
+		res.Duration = time.Since(start).Milliseconds()
+	}()
+
+	if c.client == nil {
+		res.Outcome, res.Error = OutcomeFailed, "no external client registered"
+		return res
+	}
+
+	unstructured.RemoveNestedField(el.Object,
+		"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration")
+
+	postpone := func(reason string) Result {
+		res.Outcome, res.Reason = OutcomeDeferred, reason
+		c.logger.Info().Str("ref", res.Ref.String()).
+			Str("action", string(res.Action)).
+			Msg(reason)
+		return res
+	}
+	fail := func(err error) Result {
+		var re *RequeueError
+		if errors.As(err, &re) {
+			return postpone(re.Reason)
+		}
+		res.Outcome, res.Error = OutcomeFailed, err.Error()
+		c.logger.Err(err).Str("ref", res.Ref.String()).
+			Str("action", string(res.Action)).
+			Msg("Reconciling object.")
+		return res
+	}
+
+	if el.GetDeletionTimestamp() != nil {
+		res.Action = Delete
+		if _, msg, closed := c.maintenanceClosed(Delete, el); closed {
+			return postpone(msg)
+		}
+		err := c.client.Delete(ctx, el)
+		if err != nil {
+			return fail(err)
+		}
+		c.deleted(ctx, res.Ref, false)
+		return res
+	}
+
+	exists, err := c.client.Observe(ctx, el)
+	res.Exists = exists
+	switch {
+	case apierrors.IsNotFound(err):
+		res.Action = Update
+	case err != nil:
+		return fail(err)
+	case !res.Exists:
+		res.Action = Create
+	default:
+		c.record(ctx, el)
+		return res
+	}
+
+	if _, msg, closed := c.maintenanceClosed(res.Action, el); closed {
+		return postpone(msg)
+	}
+
+	deps, err := DependenciesOf(el)
+	if err != nil {
+		return fail(err)
+	}
+	pending, err := c.pendingDependencies(ctx, deps)
+	if err != nil {
+		return fail(err)
+	}
+	if len(pending) > 0 {
+		// A cycle never ends: failed, not deferred.
+		cycle, err := c.dependencyCycle(ctx, res.Ref, deps)
+		if err != nil {
+			return fail(err)
+		}
+		if len(cycle) > 0 {
+			return fail(errors.New(describeCycle(cycle)))
+		}
+		return postpone("Waiting for " + strings.Join(pending, ", "))
+	}
+
+	if res.Action == Create {
+		err = c.client.Create(ctx, el)
+	} else {
+		err = c.client.Update(ctx, el)
+	}
+	if err != nil {
+		return fail(err)
+	}
+	c.record(ctx, el)
+	return res
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// onceClient behaves according to the object name.
+type onceClient struct {
+	recordingClient
+	calls []string
+}
+
+func (o *onceClient) Observe(_ context.Context, mg *unstructured.Unstructured) (bool, error) {
+	switch mg.GetName() {
+	case "missing":
+		return false, nil
+	case "broken":
+		return false, fmt.Errorf("boom")
+	case "gone":
+		return false, apierrors.NewNotFound(testGVR.GroupResource(), mg.GetName())
+	case "pending":
+		return false, RequeueAfter(time.Minute, "Waiting for the operation")
+	}
+	return true, nil
+}
+
+func (o *onceClient) Create(_ context.Context, mg *unstructured.Unstructured) error {
+	o.calls = append(o.calls, "Create "+mg.GetName())
+	return nil
+}
+
+func (o *onceClient) Update(_ context.Context, mg *unstructured.Unstructured) error {
+	o.calls = append(o.calls, "Update "+mg.GetName())
+	return nil
+}
+
+func (o *onceClient) Delete(_ context.Context, mg *unstructured.Unstructured) error {
+	o.calls = append(o.calls, "Delete "+mg.GetName())
+	return nil
+}
+
+func TestRunOnce(t *testing.T) {
+	deleting := newTestObject("deleting")
+	deleting.SetDeletionTimestamp(&metav1.Time{Time: time.Now()})
+	deleting.SetFinalizers([]string{"composition.krateo.io/finalizer"})
+
+	objs := []runtime.Object{
+		newTestObject("broken"),
+		deleting,
+		newTestObject("gone"),
+		newTestObject("missing"),
+		newTestObject("ok"),
+		newTestObject("pending"),
+	}
+	c, _ := newOrphansTestController(t, nil, OrphanPolicyReport, objs...)
+	ec := &onceClient{}
+	c.SetExternalClient(ec)
+
+	res, err := c.RunOnce(context.TODO())
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, 6, res.Total)
+	assert.Equal(t, 4, res.Succeeded)
+	assert.Equal(t, 1, res.Failed)
+	assert.Equal(t, 1, res.Deferred)
+
+	got := map[string]Result{}
+	for _, el := range res.Results {
+		got[el.Ref.Name] = el
+	}
+	assert.Equal(t, OutcomeFailed, got["broken"].Outcome)
+	assert.Equal(t, "boom", got["broken"].Error)
+	assert.Equal(t, Delete, got["deleting"].Action)
+	assert.Equal(t, Update, got["gone"].Action)
+	assert.Equal(t, Create, got["missing"].Action)
+	assert.Equal(t, ActionNone, got["ok"].Action)
+	assert.True(t, got["ok"].Exists)
+	assert.Equal(t, OutcomeDeferred, got["pending"].Outcome)
+	assert.Equal(t, "Waiting for the operation", got["pending"].Reason)
+	assert.Empty(t, got["pending"].Error)
+
+	assert.ElementsMatch(t, []string{"Delete deleting", "Update gone", "Create missing"}, ec.calls)
+}
+
+func TestRunOnceWithoutClient(t *testing.T) {
+	c, _ := newOrphansTestController(t, nil, OrphanPolicyReport, newTestObject("sample"))
+	c.client = nil
+
+	res, err := c.RunOnce(context.TODO())
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, 1, res.Total)
+	assert.Equal(t, 0, res.Succeeded)
+	assert.Equal(t, 1, res.Failed)
+	if assert.Len(t, res.Results, 1) {
+		assert.Equal(t, OutcomeFailed, res.Results[0].Outcome)
+		assert.Equal(t, "no external client registered", res.Results[0].Error)
+	}
+}
@@ -0,0 +1,220 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/shortid"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// cleanedTTL is how long the deletion of an external resource is remembered
+// waiting for the informer to report the deletion of its object.
+const cleanedTTL = 10 * time.Minute
+
+// OrphanPolicy tells what to do with the external resources whose
+// object was deleted while the controller was not running.
+type OrphanPolicy string
+
+const (
+	// OrphanPolicyReport logs the orphaned external resources
+	// and exports their number as a metric.
+	OrphanPolicyReport OrphanPolicy = "report"
+	// OrphanPolicyDelete runs the ExternalClient Delete on the
+	// last known state of the deleted objects.
+	OrphanPolicyDelete OrphanPolicy = "delete"
+)
+
+// An Inventory records the last known state of the managed objects,
+// so that their external resources can be found after the objects are gone.
+type Inventory interface {
+	Record(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) error
+	Forget(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) error
+	List(ctx context.Context, gvr schema.GroupVersionResource, namespace string) ([]*unstructured.Unstructured, error)
+}
+
+func refOf(el *unstructured.Unstructured) ObjectRef {
+	return ObjectRef{
+		APIVersion: el.GetAPIVersion(),
+		Kind:       el.GetKind(),
+		Name:       el.GetName(),
+		Namespace:  el.GetNamespace(),
+	}
+}
+
+// onDeleted handles an object removed from the cluster (even if the
+// informer only got its tombstone): unless its external resource has
+// already been deleted, a Delete is queued with its last known state.
+func (c *Controller) onDeleted(sid *shortid.Shortid, obj interface{}) {
+	if tomb, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tomb.Obj
+	}
+
+	el, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		c.logger.Warn().Msg("DeleteFunc: object is not an unstructured.")
+		return
+	}
+	c.deps.changed(refOf(el))
+
+	if c.sharder != nil && !c.sharder.Owns(el.GetNamespace(), el.GetName()) {
+		return
+	}
+
+	ref := refOf(el)
+
+	c.mu.Lock()
+	_, cleaned := c.cleaned[ref]
+	delete(c.cleaned, ref)
+	// The Delete in flight may have removed the finalizer: the tombstone
+	// is only kept for the retry of a failed one.
+	_, deleting := c.deleting[ref]
+	if deleting {
+		c.deleting[ref] = true
+	}
+	if !cleaned {
+		c.tombstones[ref] = el.DeepCopy()
+	}
+	c.mu.Unlock()
+	if cleaned || deleting {
+		return
+	}
+
+	id, err := sid.Generate()
+	if err != nil {
+		c.logger.Error().Err(err).Msg("DeleteFunc: generating short id.")
+		return
+	}
+
+	c.queue.Add(event{
+		id:        id,
+		eventType: Delete,
+		objectRef: ref,
+	})
+}
+
+// tombstone returns the last known state of a deleted object.
+func (c *Controller) tombstone(ref ObjectRef) (*unstructured.Unstructured, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.tombstones[ref]
+	if !ok {
+		return nil, false
+	}
+	return el.DeepCopy(), true
+}
+
+// startDelete marks the Delete of the object as in flight.
+func (c *Controller) startDelete(ref ObjectRef) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.deleting[ref] = false
+}
+
+// endDelete marks the Delete of the object as done, returning
+// true if the informer reported the object deletion meanwhile.
+func (c *Controller) endDelete(ref ObjectRef) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	gone := c.deleting[ref]
+	delete(c.deleting, ref)
+	return gone
+}
+
+// deleted records that the external resource of the object has been deleted.
+func (c *Controller) deleted(ctx context.Context, ref ObjectRef, tombstone bool) {
+	now := time.Now()
+
+	c.mu.Lock()
+	if tombstone {
+		delete(c.tombstones, ref)
+	} else {
+		// The informer will report the object deletion later on.
+		c.cleaned[ref] = now
+	}
+	// Expired, for the deletions the informer never reports.
+	for k, at := range c.cleaned {
+		if now.Sub(at) > cleanedTTL {
+			delete(c.cleaned, k)
+		}
+	}
+	c.mu.Unlock()
+	c.refs.forget(ref)
+
+	if c.inventory == nil {
+		return
+	}
+	if err := c.inventory.Forget(ctx, c.gvr, ref.Namespace, ref.Name); err != nil {
+		c.logger.Warn().Err(err).Str("ref", ref.String()).Msg("Removing inventory record.")
+	}
+}
+
+// record stores the last known state of the object in the inventory.
+func (c *Controller) record(ctx context.Context, el *unstructured.Unstructured) {
+	if c.inventory == nil {
+		return
+	}
+	if err := c.inventory.Record(ctx, c.gvr, el); err != nil {
+		c.logger.Warn().Err(err).Str("name", el.GetName()).
+			Str("namespace", el.GetNamespace()).
+			Msg("Recording inventory state.")
+	}
+}
+
+// sweepOrphans looks for the recorded objects that no longer exist,
+// reporting their external resources or deleting them according
+// to the orphan policy.
+func (c *Controller) sweepOrphans(ctx context.Context, sid *shortid.Shortid) {
+	if c.inventory == nil {
+		return
+	}
+
+	all, err := c.inventory.List(ctx, c.gvr, c.namespace)
+	if err != nil {
+		c.logger.Err(err).Msg("Listing inventory records.")
+		return
+	}
+
+	tot := 0
+	for _, el := range all {
+		if c.sharder != nil && !c.sharder.Owns(el.GetNamespace(), el.GetName()) {
+			continue
+		}
+
+		if _, exists, _ := c.indexer.GetByKey(cacheKey(el.GetNamespace(), el.GetName())); exists {
+			continue
+		}
+
+		tot++
+		ref := refOf(el)
+		c.logger.Warn().Str("ref", ref.String()).
+			Str("policy", string(c.orphanPolicy)).
+			Msg("Found the external resource of a deleted object.")
+
+		if c.orphanPolicy != OrphanPolicyDelete {
+			continue
+		}
+
+		id, err := sid.Generate()
+		if err != nil {
+			c.logger.Error().Err(err).Msg("Generating short id.")
+			return
+		}
+
+		c.mu.Lock()
+		c.tombstones[ref] = el
+		c.mu.Unlock()
+
+		c.queue.Add(event{
+			id:        id,
+			eventType: Delete,
+			objectRef: ref,
+		})
+	}
+
+	orphans.WithLabelValues(c.gvr.GroupResource().String()).Set(float64(tot))
+}
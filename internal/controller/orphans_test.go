@@ -0,0 +1,206 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/shortid"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+var testGVR = schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1", Resource: "tests"}
+
+// recordingClient records the names of the deleted objects.
+type recordingClient struct {
+	mu      sync.Mutex
+	deleted []string
+	// onDelete, if set, runs within Delete.
+	onDelete func(mg *unstructured.Unstructured)
+}
+
+func (r *recordingClient) Observe(context.Context, *unstructured.Unstructured) (bool, error) {
+	return true, nil
+}
+
+func (r *recordingClient) Create(context.Context, *unstructured.Unstructured) error { return nil }
+
+func (r *recordingClient) Update(context.Context, *unstructured.Unstructured) error { return nil }
+
+func (r *recordingClient) Delete(_ context.Context, mg *unstructured.Unstructured) error {
+	if r.onDelete != nil {
+		r.onDelete(mg)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleted = append(r.deleted, mg.GetName())
+	return nil
+}
+
+// memInventory is an in memory Inventory.
+type memInventory struct {
+	items map[string]*unstructured.Unstructured
+}
+
+func (m *memInventory) Record(_ context.Context, _ schema.GroupVersionResource, obj *unstructured.Unstructured) error {
+	m.items[obj.GetNamespace()+"/"+obj.GetName()] = obj.DeepCopy()
+	return nil
+}
+
+func (m *memInventory) Forget(_ context.Context, _ schema.GroupVersionResource, namespace, name string) error {
+	delete(m.items, namespace+"/"+name)
+	return nil
+}
+
+func (m *memInventory) List(context.Context, schema.GroupVersionResource, string) ([]*unstructured.Unstructured, error) {
+	res := []*unstructured.Unstructured{}
+	for _, el := range m.items {
+		res = append(res, el.DeepCopy())
+	}
+	return res, nil
+}
+
+func newTestObject(name string) *unstructured.Unstructured {
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("composition.krateo.io/v1")
+	obj.SetKind("Test")
+	obj.SetName(name)
+	obj.SetNamespace("default")
+	return obj
+}
+
+func newOrphansTestController(t *testing.T, inv Inventory, policy OrphanPolicy, objs ...runtime.Object) (*Controller, *recordingClient) {
+	t.Helper()
+
+	cli := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{testGVR: "TestList"}, objs...)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, el := range objs {
+		assert.Nil(t, indexer.Add(el))
+	}
+
+	sid, err := shortid.New(1, shortid.DefaultABC, 2342)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ec := &recordingClient{}
+	log := zerolog.Nop()
+	c := &Controller{
+		dynamicClient: cli,
+		gvr:           testGVR,
+		sid:           sid,
+		logger:        &log,
+		queue:         newPriorityQueue(workqueue.DefaultControllerRateLimiter(), DefaultPriorityWeights, nil),
+		indexer:       indexer,
+		inventory:     inv,
+		orphanPolicy:  policy,
+		tombstones:    map[ObjectRef]*unstructured.Unstructured{},
+		cleaned:       map[ObjectRef]time.Time{},
+		deleting:      map[ObjectRef]bool{},
+	}
+	c.SetTimeouts(TimeoutOptions{})
+	c.SetExternalClient(ec)
+	t.Cleanup(c.queue.ShutDown)
+
+	return c, ec
+}
+
+func processNext(t *testing.T, c *Controller) {
+	t.Helper()
+
+	item, _ := c.queue.Get()
+	assert.Nil(t, c.processItem(context.TODO(), item))
+	c.queue.Done(item)
+}
+
+func TestDeleteTombstone(t *testing.T) {
+	inv := &memInventory{items: map[string]*unstructured.Unstructured{}}
+	c, ec := newOrphansTestController(t, inv, OrphanPolicyReport)
+	assert.Nil(t, inv.Record(context.TODO(), testGVR, newTestObject("gone")))
+
+	c.onDeleted(c.sid, cache.DeletedFinalStateUnknown{
+		Key: "default/gone",
+		Obj: newTestObject("gone"),
+	})
+	assert.Equal(t, 1, c.queue.Len())
+
+	processNext(t, c)
+	assert.Equal(t, []string{"gone"}, ec.deleted)
+	assert.Empty(t, c.tombstones)
+	assert.Empty(t, inv.items)
+}
+
+func TestDeleteAlreadyCleaned(t *testing.T) {
+	obj := newTestObject("deleting")
+	c, ec := newOrphansTestController(t, nil, OrphanPolicyReport, obj)
+
+	// The object is being deleted: its finalizer is still there.
+	c.queue.Add(event{eventType: Delete, objectRef: refOf(obj)})
+	processNext(t, c)
+	assert.Equal(t, []string{"deleting"}, ec.deleted)
+
+	// Once gone, the external resource is not deleted again.
+	c.onDeleted(c.sid, obj)
+	assert.Equal(t, 0, c.queue.Len())
+}
+
+func TestDeleteReportedInFlight(t *testing.T) {
+	obj := newTestObject("deleting")
+	c, ec := newOrphansTestController(t, nil, OrphanPolicyReport, obj)
+
+	// The finalizer is removed before Delete returns.
+	ec.onDelete = func(mg *unstructured.Unstructured) {
+		c.onDeleted(c.sid, mg)
+	}
+	c.queue.Add(event{eventType: Delete, objectRef: refOf(obj)})
+	processNext(t, c)
+	assert.Equal(t, []string{"deleting"}, ec.deleted)
+	assert.Equal(t, 0, c.queue.Len())
+	assert.Empty(t, c.tombstones)
+	assert.Empty(t, c.cleaned)
+	assert.Empty(t, c.deleting)
+}
+
+func TestDeleteCleanedExpire(t *testing.T) {
+	c, _ := newOrphansTestController(t, nil, OrphanPolicyReport)
+
+	old := refOf(newTestObject("old"))
+	c.cleaned[old] = time.Now().Add(-cleanedTTL - time.Second)
+	c.deleted(context.TODO(), refOf(newTestObject("new")), false)
+	assert.NotContains(t, c.cleaned, old)
+	assert.Contains(t, c.cleaned, refOf(newTestObject("new")))
+}
+
+func TestSweepOrphans(t *testing.T) {
+	ctx := context.TODO()
+
+	for _, policy := range []OrphanPolicy{OrphanPolicyReport, OrphanPolicyDelete} {
+		inv := &memInventory{items: map[string]*unstructured.Unstructured{}}
+		assert.Nil(t, inv.Record(ctx, testGVR, newTestObject("alive")))
+		assert.Nil(t, inv.Record(ctx, testGVR, newTestObject("orphan")))
+
+		c, ec := newOrphansTestController(t, inv, policy, newTestObject("alive"))
+		c.sweepOrphans(ctx, c.sid)
+
+		if policy == OrphanPolicyReport {
+			assert.Equal(t, 0, c.queue.Len())
+			assert.Equal(t, 2, len(inv.items))
+			continue
+		}
+
+		assert.Equal(t, 1, c.queue.Len())
+		processNext(t, c)
+		assert.Equal(t, []string{"orphan"}, ec.deleted)
+		assert.Equal(t, 1, len(inv.items))
+	}
+}
@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"strings"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// FieldManager is the name the controller writes with. Set it as the
+// rest.Config UserAgent so that all the API writes are attributed to it.
+const FieldManager = "composition-dynamic-controller"
+
+// A Predicate filters the informer update events: a change is
+// enqueued only if all the predicates return true.
+// The periodic resyncs (same resource version) are never filtered.
+type Predicate interface {
+	Update(old, new *unstructured.Unstructured) bool
+}
+
+// PredicateFunc adapts a function to a Predicate.
+type PredicateFunc func(old, new *unstructured.Unstructured) bool
+
+func (fn PredicateFunc) Update(old, new *unstructured.Unstructured) bool {
+	return fn(old, new)
+}
+
+// ControlAnnotations are the annotations whose changes are never ignored.
+// The keys ending with '-' are prefixes.
+var ControlAnnotations = []string{
+	meta.AnnotationKeyReconciliationPaused,
+	meta.AnnotationKeyManagementPolicy,
+	meta.AnnotationKeyConnectorVerbose,
+	meta.AnnotationKeyTimeout,
+	meta.AnnotationKeyTimeoutPrefix,
+	meta.AnnotationKeyDependsOn,
+	meta.AnnotationKeyMaintenanceWindow,
+	meta.AnnotationKeyMaintenanceWindowPrefix,
+}
+
+// DefaultPredicates returns the built-in predicates: status only,
+// field manager only and annotation only changes are ignored.
+func DefaultPredicates(manager string) []Predicate {
+	return []Predicate{
+		IgnoreStatusChanges(),
+		IgnoreManager(manager),
+		IgnoreAnnotationChanges(ControlAnnotations...),
+	}
+}
+
+// IgnoreStatusChanges filters out the changes to the status only.
+func IgnoreStatusChanges() Predicate {
+	return PredicateFunc(func(old, new *unstructured.Unstructured) bool {
+		return !equality.Semantic.DeepEqual(stripped(old), stripped(new))
+	})
+}
+
+// IgnoreManager filters out the changes made only by the specified
+// field manager, according to the object managed fields.
+func IgnoreManager(manager string) Predicate {
+	return PredicateFunc(func(old, new *unstructured.Unstructured) bool {
+		changed := 0
+		for _, el := range new.GetManagedFields() {
+			found := false
+			for _, prev := range old.GetManagedFields() {
+				if equality.Semantic.DeepEqual(el, prev) {
+					found = true
+					break
+				}
+			}
+			if found {
+				continue
+			}
+
+			changed++
+			if el.Manager != manager {
+				return true
+			}
+		}
+		// No managed fields changed: nothing to tell.
+		return changed == 0
+	})
+}
+
+// IgnoreAnnotationChanges filters out the changes to the annotations
+// only, unless one of the specified annotations (or prefixes, when
+// ending with '-') changed.
+func IgnoreAnnotationChanges(control ...string) Predicate {
+	return PredicateFunc(func(old, new *unstructured.Unstructured) bool {
+		o, n := stripped(old), stripped(new)
+		o.SetAnnotations(nil)
+		n.SetAnnotations(nil)
+		if !equality.Semantic.DeepEqual(o, n) {
+			return true
+		}
+
+		oldAnn, newAnn := old.GetAnnotations(), new.GetAnnotations()
+		for _, key := range changedKeys(oldAnn, newAnn) {
+			if isControlAnnotation(key, control) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// stripped returns a copy of the object without the fields
+// that change on every write.
+func stripped(el *unstructured.Unstructured) *unstructured.Unstructured {
+	res := el.DeepCopy()
+	delete(res.Object, "status")
+	res.SetResourceVersion("")
+	res.SetManagedFields(nil)
+	return res
+}
+
+func changedKeys(old, new map[string]string) []string {
+	res := []string{}
+	for k, v := range new {
+		if ov, ok := old[k]; !ok || ov != v {
+			res = append(res, k)
+		}
+	}
+	for k := range old {
+		if _, ok := new[k]; !ok {
+			res = append(res, k)
+		}
+	}
+	return res
+}
+
+func isControlAnnotation(key string, control []string) bool {
+	for _, el := range control {
+		if strings.HasSuffix(el, "-") && strings.HasPrefix(key, el) {
+			return true
+		}
+		if key == el {
+			return true
+		}
+	}
+	return false
+}
+
+// allowUpdate returns true if the update must be enqueued.
+func allowUpdate(predicates []Predicate, old, new *unstructured.Unstructured) bool {
+	if old.GetResourceVersion() == new.GetResourceVersion() {
+		// Resync.
+		return true
+	}
+	for _, el := range predicates {
+		if !el.Update(old, new) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newPredicateTestObject() *unstructured.Unstructured {
+	obj := newTestObject("sample")
+	obj.SetResourceVersion("1")
+	obj.SetAnnotations(map[string]string{"a": "1"})
+	obj.SetManagedFields([]metav1.ManagedFieldsEntry{{
+		Manager:   "kubectl",
+		Operation: metav1.ManagedFieldsOperationUpdate,
+		Time:      &metav1.Time{Time: time.Unix(1, 0)},
+	}})
+	_ = unstructured.SetNestedField(obj.Object, "value", "spec", "field")
+	return obj
+}
+
+// changed returns a copy of the object with a new resource version,
+// written by the specified manager.
+func changed(obj *unstructured.Unstructured, manager string) *unstructured.Unstructured {
+	res := obj.DeepCopy()
+	res.SetResourceVersion("2")
+	res.SetManagedFields(append(res.GetManagedFields(), metav1.ManagedFieldsEntry{
+		Manager:   manager,
+		Operation: metav1.ManagedFieldsOperationUpdate,
+		Time:      &metav1.Time{Time: time.Unix(2, 0)},
+	}))
+	return res
+}
+
+func TestIgnoreStatusChanges(t *testing.T) {
+	old := newPredicateTestObject()
+
+	cur := changed(old, "someone")
+	_ = unstructured.SetNestedField(cur.Object, "ready", "status", "phase")
+	assert.False(t, IgnoreStatusChanges().Update(old, cur))
+
+	_ = unstructured.SetNestedField(cur.Object, "other", "spec", "field")
+	assert.True(t, IgnoreStatusChanges().Update(old, cur))
+}
+
+func TestIgnoreManager(t *testing.T) {
+	old := newPredicateTestObject()
+
+	assert.False(t, IgnoreManager(FieldManager).Update(old, changed(old, FieldManager)))
+	assert.True(t, IgnoreManager(FieldManager).Update(old, changed(old, "kubectl-edit")))
+	assert.True(t, IgnoreManager(FieldManager).Update(old, changed(changed(old, FieldManager), "kubectl-edit")))
+	// Without managed fields there is nothing to tell.
+	assert.True(t, IgnoreManager(FieldManager).Update(old, old.DeepCopy()))
+}
+
+func TestIgnoreAnnotationChanges(t *testing.T) {
+	old := newPredicateTestObject()
+	p := IgnoreAnnotationChanges(ControlAnnotations...)
+
+	cur := changed(old, "someone")
+	cur.SetAnnotations(map[string]string{"a": "2"})
+	assert.False(t, p.Update(old, cur))
+
+	cur.SetAnnotations(map[string]string{"a": "1", meta.AnnotationKeyReconciliationPaused: "true"})
+	assert.True(t, p.Update(old, cur))
+
+	cur.SetAnnotations(map[string]string{"a": "1", meta.AnnotationKeyTimeoutPrefix + "delete": "1m"})
+	assert.True(t, p.Update(old, cur))
+
+	cur.SetAnnotations(map[string]string{"a": "2"})
+	cur.SetLabels(map[string]string{"l": "1"})
+	assert.True(t, p.Update(old, cur))
+}
+
+func TestAllowUpdate(t *testing.T) {
+	old := newPredicateTestObject()
+	all := append(DefaultPredicates(FieldManager),
+		PredicateFunc(func(_, new *unstructured.Unstructured) bool {
+			return new.GetLabels()["skip"] != "true"
+		}))
+
+	// Resyncs are never filtered.
+	assert.True(t, allowUpdate(all, old, old.DeepCopy()))
+
+	// Our own status write.
+	cur := changed(old, FieldManager)
+	_ = unstructured.SetNestedField(cur.Object, "ready", "status", "phase")
+	assert.False(t, allowUpdate(all, old, cur))
+
+	// A user edit.
+	cur = changed(old, "kubectl-edit")
+	_ = unstructured.SetNestedField(cur.Object, "other", "spec", "field")
+	assert.True(t, allowUpdate(all, old, cur))
+
+	// A user filter.
+	cur.SetLabels(map[string]string{"skip": "true"})
+	assert.False(t, allowUpdate(all, old, cur))
+}
@@ -0,0 +1,360 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"k8s.io/client-go/util/workqueue"
+)
+
+// Priority is the lane an event is queued in.
+type Priority int
+
+const (
+	// PriorityHigh is the lane of the user visible actions (Delete and Update).
+	PriorityHigh Priority = iota
+	// PriorityNormal is the lane of the Create events.
+	PriorityNormal
+	// PriorityLow is the lane of the periodic Observe events.
+	PriorityLow
+
+	numPriorities = 3
+)
+
+// DefaultPriorityWeights are the weights of the lanes.
+// Lanes are served in strict priority order, except that a waiting lane
+// is served after it has been skipped (sum of the weights of the higher
+// lanes / its weight) times: with the defaults a Create waits at most 2
+// picks and an Observe at most 12, so that Observes still progress under
+// a constant stream of edits.
+var DefaultPriorityWeights = [numPriorities]int{8, 4, 1}
+
+// PriorityOf returns the lane of the specified event type.
+func PriorityOf(et EventType) Priority {
+	switch et {
+	case Delete, Update:
+		return PriorityHigh
+	case Create:
+		return PriorityNormal
+	default:
+		return PriorityLow
+	}
+}
+
+func priorityOfItem(item interface{}) Priority {
+	if evt, ok := item.(event); ok {
+		return PriorityOf(evt.eventType)
+	}
+	return PriorityLow
+}
+
+func namespaceOfItem(item interface{}) string {
+	if evt, ok := item.(event); ok {
+		return evt.objectRef.Namespace
+	}
+	return ""
+}
+
+// lane holds a FIFO of items per namespace; the namespaces
+// are served round robin, so that a namespace with many queued
+// items does not delay the others.
+type lane struct {
+	items map[string][]interface{}
+	// ring is the serving order of the namespaces with queued items.
+	ring []string
+	size int
+}
+
+func (l *lane) push(ns string, item interface{}) {
+	if l.items == nil {
+		l.items = map[string][]interface{}{}
+	}
+	if len(l.items[ns]) == 0 {
+		l.ring = append(l.ring, ns)
+	}
+	l.items[ns] = append(l.items[ns], item)
+	l.size++
+}
+
+// pop removes the first item of the next namespace accepted by admit.
+func (l *lane) pop(admit func(ns string) bool) (interface{}, bool) {
+	for i, ns := range l.ring {
+		if !admit(ns) {
+			continue
+		}
+
+		all := l.items[ns]
+		item := all[0]
+		all[0] = nil
+		l.items[ns] = all[1:]
+		l.size--
+
+		l.ring = append(l.ring[:i], l.ring[i+1:]...)
+		if len(l.items[ns]) > 0 {
+			// Back of the line.
+			l.ring = append(l.ring, ns)
+		} else {
+			delete(l.items, ns)
+		}
+		return item, true
+	}
+	return nil, false
+}
+
+var _ workqueue.RateLimitingInterface = (*priorityQueue)(nil)
+
+// priorityQueue is a rate limiting work queue with separate lanes
+// served in priority order with starvation protection. Within a lane the
+// namespaces are served round robin and, with a limiter, the namespaces
+// at their cap are skipped. Like workqueue.Type, an item is never
+// processed concurrently and is queued at most once.
+type priorityQueue struct {
+	cond *sync.Cond
+
+	lanes      [numPriorities]lane
+	maxSkips   [numPriorities]int
+	skipped    [numPriorities]int
+	dirty      map[interface{}]struct{}
+	processing map[interface{}]struct{}
+
+	shuttingDown bool
+	drain        bool
+
+	rateLimiter workqueue.RateLimiter
+	limiter     *NamespaceLimiter
+	stopCh      chan struct{}
+	stopOnce    sync.Once
+}
+
+func newPriorityQueue(rl workqueue.RateLimiter, weights [numPriorities]int, limiter *NamespaceLimiter) *priorityQueue {
+	for i := range weights {
+		if weights[i] < 1 {
+			weights[i] = 1
+		}
+	}
+
+	maxSkips := [numPriorities]int{}
+	for i := 1; i < numPriorities; i++ {
+		higher := 0
+		for j := 0; j < i; j++ {
+			higher += weights[j]
+		}
+		maxSkips[i] = higher / weights[i]
+		if maxSkips[i] < 1 {
+			maxSkips[i] = 1
+		}
+	}
+
+	q := &priorityQueue{
+		cond:        sync.NewCond(&sync.Mutex{}),
+		maxSkips:    maxSkips,
+		dirty:       map[interface{}]struct{}{},
+		processing:  map[interface{}]struct{}{},
+		rateLimiter: rl,
+		limiter:     limiter,
+		stopCh:      make(chan struct{}),
+	}
+	if limiter != nil {
+		// A slot freed by another queue may unblock this one.
+		limiter.subscribe(q.wake)
+	}
+	return q
+}
+
+func (q *priorityQueue) wake() {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	q.cond.Broadcast()
+}
+
+func (q *priorityQueue) Add(item interface{}) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	if q.shuttingDown {
+		return
+	}
+	if _, ok := q.dirty[item]; ok {
+		return
+	}
+
+	q.dirty[item] = struct{}{}
+	if _, ok := q.processing[item]; ok {
+		// Queued again by Done.
+		return
+	}
+
+	q.push(item)
+	q.cond.Signal()
+}
+
+func (q *priorityQueue) push(item interface{}) {
+	q.lanes[priorityOfItem(item)].push(namespaceOfItem(item), item)
+}
+
+func (q *priorityQueue) Len() int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	tot := 0
+	for _, el := range q.lanes {
+		tot += el.size
+	}
+	return tot
+}
+
+// LenOf returns the number of the items queued in the specified lane.
+func (q *priorityQueue) LenOf(p Priority) int {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.lanes[p].size
+}
+
+func (q *priorityQueue) Get() (interface{}, bool) {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	for {
+		if item, ok := q.next(); ok {
+			q.processing[item] = struct{}{}
+			delete(q.dirty, item)
+			return item, false
+		}
+		if q.shuttingDown {
+			return nil, true
+		}
+		// Empty or all the queued namespaces are at their cap.
+		q.cond.Wait()
+	}
+}
+
+// next pops an item from the highest priority lane that can be served,
+// unless a lower one has been skipped too many times.
+func (q *priorityQueue) next() (interface{}, bool) {
+	order := make([]int, 0, numPriorities*2)
+	for i := numPriorities - 1; i > 0; i-- {
+		if q.lanes[i].size > 0 && q.skipped[i] >= q.maxSkips[i] {
+			order = append(order, i)
+		}
+	}
+	for i := 0; i < numPriorities; i++ {
+		order = append(order, i)
+	}
+
+	for _, pick := range order {
+		if q.lanes[pick].size == 0 {
+			continue
+		}
+		item, ok := q.lanes[pick].pop(q.admit)
+		if !ok {
+			continue
+		}
+
+		q.skipped[pick] = 0
+		for i := pick + 1; i < numPriorities; i++ {
+			if q.lanes[i].size > 0 {
+				q.skipped[i]++
+			}
+		}
+		return item, true
+	}
+
+	return nil, false
+}
+
+// admit takes a processing slot for the namespace, if any is free.
+func (q *priorityQueue) admit(ns string) bool {
+	if q.limiter == nil {
+		return true
+	}
+	return q.limiter.tryAcquire(ns)
+}
+
+func (q *priorityQueue) Done(item interface{}) {
+	q.cond.L.Lock()
+	if _, ok := q.processing[item]; !ok {
+		q.cond.L.Unlock()
+		return
+	}
+	delete(q.processing, item)
+	if _, ok := q.dirty[item]; ok {
+		q.push(item)
+		q.cond.Signal()
+	} else if len(q.processing) == 0 {
+		q.cond.Broadcast()
+	}
+	q.cond.L.Unlock()
+
+	// Outside of the queue lock: the release wakes up all
+	// the queues sharing the limiter, this one included.
+	if q.limiter != nil {
+		q.limiter.release(namespaceOfItem(item))
+	}
+}
+
+func (q *priorityQueue) ShutDown() {
+	q.stopOnce.Do(func() { close(q.stopCh) })
+
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	q.shuttingDown = true
+	q.drain = false
+	q.cond.Broadcast()
+}
+
+// ShutDownWithDrain stops accepting new items and waits
+// for the ones being processed to be done.
+func (q *priorityQueue) ShutDownWithDrain() {
+	q.stopOnce.Do(func() { close(q.stopCh) })
+
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+
+	q.shuttingDown = true
+	q.drain = true
+	q.cond.Broadcast()
+
+	for len(q.processing) != 0 && q.drain {
+		q.cond.Wait()
+	}
+}
+
+func (q *priorityQueue) ShuttingDown() bool {
+	q.cond.L.Lock()
+	defer q.cond.L.Unlock()
+	return q.shuttingDown
+}
+
+func (q *priorityQueue) AddAfter(item interface{}, duration time.Duration) {
+	if q.ShuttingDown() {
+		return
+	}
+	if duration <= 0 {
+		q.Add(item)
+		return
+	}
+
+	go func() {
+		t := time.NewTimer(duration)
+		defer t.Stop()
+
+		select {
+		case <-q.stopCh:
+		case <-t.C:
+			q.Add(item)
+		}
+	}()
+}
+
+func (q *priorityQueue) AddRateLimited(item interface{}) {
+	q.AddAfter(item, q.rateLimiter.When(item))
+}
+
+func (q *priorityQueue) Forget(item interface{}) {
+	q.rateLimiter.Forget(item)
+}
+
+func (q *priorityQueue) NumRequeues(item interface{}) int {
+	return q.rateLimiter.NumRequeues(item)
+}
@@ -0,0 +1,168 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/client-go/util/workqueue"
+)
+
+func newTestEvent(et EventType, name string) event {
+	return event{
+		id:        fmt.Sprintf("%s-%s", et, name),
+		eventType: et,
+		objectRef: ObjectRef{Name: name, Namespace: "default"},
+	}
+}
+
+func TestPriorityQueueOrder(t *testing.T) {
+	q := newPriorityQueue(workqueue.DefaultControllerRateLimiter(), DefaultPriorityWeights, nil)
+	defer q.ShutDown()
+
+	q.Add(newTestEvent(Observe, "a"))
+	q.Add(newTestEvent(Create, "b"))
+	q.Add(newTestEvent(Delete, "c"))
+	q.Add(newTestEvent(Update, "d"))
+
+	got := []EventType{}
+	for q.Len() > 0 {
+		item, _ := q.Get()
+		got = append(got, item.(event).eventType)
+		q.Done(item)
+	}
+
+	assert.Equal(t, []EventType{Delete, Update, Create, Observe}, got)
+}
+
+func TestPriorityQueueNoStarvation(t *testing.T) {
+	q := newPriorityQueue(workqueue.DefaultControllerRateLimiter(), DefaultPriorityWeights, nil)
+	defer q.ShutDown()
+
+	for i := 0; i < 100; i++ {
+		q.Add(newTestEvent(Update, fmt.Sprintf("u%d", i)))
+		q.Add(newTestEvent(Observe, fmt.Sprintf("o%d", i)))
+	}
+
+	observed := []int{}
+	for i := 1; i <= 40; i++ {
+		item, _ := q.Get()
+		if item.(event).eventType == Observe {
+			observed = append(observed, i)
+		}
+		q.Done(item)
+	}
+
+	// An Observe is served after being skipped (8+4)/1 times.
+	assert.Equal(t, []int{13, 26, 39}, observed)
+}
+
+func TestPriorityQueueDedup(t *testing.T) {
+	q := newPriorityQueue(workqueue.DefaultControllerRateLimiter(), DefaultPriorityWeights, nil)
+	defer q.ShutDown()
+
+	evt := newTestEvent(Observe, "a")
+	q.Add(evt)
+	q.Add(evt)
+	assert.Equal(t, 1, q.Len())
+
+	item, _ := q.Get()
+	// Added while processing: queued again only once done.
+	q.Add(evt)
+	assert.Equal(t, 0, q.Len())
+	q.Done(item)
+	assert.Equal(t, 1, q.LenOf(PriorityLow))
+}
+
+func TestPriorityQueueAddAfterAndShutDown(t *testing.T) {
+	q := newPriorityQueue(workqueue.DefaultControllerRateLimiter(), DefaultPriorityWeights, nil)
+
+	q.AddAfter(newTestEvent(Create, "a"), 10*time.Millisecond)
+	item, shutdown := q.Get()
+	assert.False(t, shutdown)
+	assert.Equal(t, Create, item.(event).eventType)
+	q.Done(item)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.ShutDown()
+	}()
+	_, shutdown = q.Get()
+	assert.True(t, shutdown)
+}
+
+func newNamespacedTestEvent(et EventType, namespace, name string) event {
+	evt := newTestEvent(et, name)
+	evt.objectRef.Namespace = namespace
+	return evt
+}
+
+func TestPriorityQueueNamespaceFairness(t *testing.T) {
+	q := newPriorityQueue(workqueue.DefaultControllerRateLimiter(), DefaultPriorityWeights, nil)
+	defer q.ShutDown()
+
+	for i := 0; i < 5; i++ {
+		q.Add(newNamespacedTestEvent(Update, "team-a", fmt.Sprintf("a%d", i)))
+	}
+	q.Add(newNamespacedTestEvent(Update, "team-b", "b0"))
+	q.Add(newNamespacedTestEvent(Update, "team-c", "c0"))
+
+	got := []string{}
+	for q.Len() > 0 {
+		item, _ := q.Get()
+		got = append(got, item.(event).objectRef.Name)
+		q.Done(item)
+	}
+
+	assert.Equal(t, []string{"a0", "b0", "c0", "a1", "a2", "a3", "a4"}, got)
+}
+
+func TestPriorityQueueNamespaceLimit(t *testing.T) {
+	lim := NewNamespaceLimiter(0, map[string]int{"team-a": 1})
+	q1 := newPriorityQueue(workqueue.DefaultControllerRateLimiter(), DefaultPriorityWeights, lim)
+	defer q1.ShutDown()
+	q2 := newPriorityQueue(workqueue.DefaultControllerRateLimiter(), DefaultPriorityWeights, lim)
+	defer q2.ShutDown()
+
+	q1.Add(newNamespacedTestEvent(Update, "team-a", "a0"))
+	q1.Add(newNamespacedTestEvent(Update, "team-a", "a1"))
+	q1.Add(newNamespacedTestEvent(Observe, "team-b", "b0"))
+	q2.Add(newNamespacedTestEvent(Update, "team-a", "x0"))
+
+	a0, _ := q1.Get()
+	assert.Equal(t, "a0", a0.(event).objectRef.Name)
+	// team-a is at its cap: a lower priority event is served.
+	b0, _ := q1.Get()
+	assert.Equal(t, "b0", b0.(event).objectRef.Name)
+	q1.Done(b0)
+	assert.Equal(t, 1, lim.Active("team-a"))
+
+	// The cap is shared across the queues.
+	got := make(chan interface{})
+	go func() {
+		item, _ := q2.Get()
+		got <- item
+	}()
+	select {
+	case <-got:
+		t.Fatal("expected team-a to be at its cap")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	q1.Done(a0)
+	select {
+	case item := <-got:
+		assert.Equal(t, "x0", item.(event).objectRef.Name)
+		q2.Done(item)
+	case <-time.After(time.Second):
+		t.Fatal("expected a slot to be freed")
+	}
+
+	// Raising the cap unblocks the waiting events.
+	lim.SetLimits(0, nil)
+	a1, _ := q1.Get()
+	assert.Equal(t, "a1", a1.(event).objectRef.Name)
+	q1.Done(a1)
+	assert.Equal(t, 0, lim.Active("team-a"))
+}
@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/listwatcher"
+	"github.com/rs/zerolog"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+)
+
+// References tracks the objects read by the backends while reconciling
+// an object (i.e. the Secrets holding the REST credentials) to observe
+// it again when one of those changes. It can be shared by many
+// controllers and backends. A nil References tracks nothing.
+type References struct {
+	mu sync.Mutex
+	// readers maps each referenced object to the objects reading it.
+	readers map[ObjectRef]map[ObjectRef]struct{}
+	// refs maps each reader to the objects it reads.
+	refs map[ObjectRef][]ObjectRef
+	// subs are the requeues of the controllers sharing References.
+	subs []func(ObjectRef)
+	// watches are the running Watch restricted to a namespace.
+	watches []*namespacedWatch
+}
+
+// namespacedWatch is a Watch restricted to a namespace, extended
+// to the other namespaces of the referenced objects.
+type namespacedWatch struct {
+	ctx  context.Context
+	opts WatchOptions
+	// namespaces are the watched ones, guarded by References.mu.
+	namespaces map[string]bool
+}
+
+// NewReferences returns an empty References.
+func NewReferences() *References {
+	return &References{
+		readers: map[ObjectRef]map[ObjectRef]struct{}{},
+		refs:    map[ObjectRef][]ObjectRef{},
+	}
+}
+
+// Set replaces the objects read by reader.
+func (r *References) Set(reader ObjectRef, refs []ObjectRef) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.forgetLocked(reader)
+	if len(refs) == 0 {
+		return
+	}
+	for _, ref := range refs {
+		if r.readers[ref] == nil {
+			r.readers[ref] = map[ObjectRef]struct{}{}
+		}
+		r.readers[ref][reader] = struct{}{}
+		for _, w := range r.watches {
+			r.extendLocked(w, ref.Namespace)
+		}
+	}
+	r.refs[reader] = refs
+}
+
+// Readers returns the objects reading ref.
+func (r *References) Readers(ref ObjectRef) []ObjectRef {
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := make([]ObjectRef, 0, len(r.readers[ref]))
+	for reader := range r.readers[ref] {
+		res = append(res, reader)
+	}
+	return res
+}
+
+// Changed requeues the objects reading ref in the controllers serving them.
+func (r *References) Changed(ref ObjectRef) {
+	if r == nil {
+		return
+	}
+	readers := r.Readers(ref)
+
+	r.mu.Lock()
+	subs := append([]func(ObjectRef){}, r.subs...)
+	r.mu.Unlock()
+
+	for _, reader := range readers {
+		for _, requeue := range subs {
+			requeue(reader)
+		}
+	}
+}
+
+// forget removes the objects read by reader.
+func (r *References) forget(reader ObjectRef) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.forgetLocked(reader)
+}
+
+func (r *References) forgetLocked(reader ObjectRef) {
+	for _, ref := range r.refs[reader] {
+		delete(r.readers[ref], reader)
+		if len(r.readers[ref]) == 0 {
+			delete(r.readers, ref)
+		}
+	}
+	delete(r.refs, reader)
+}
+
+func (r *References) subscribe(requeue func(ObjectRef)) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.subs = append(r.subs, requeue)
+}
+
+// WatchOptions selects the objects watched by References.Watch.
+type WatchOptions struct {
+	Client         dynamic.Interface
+	GVR            schema.GroupVersionResource
+	Namespace      string
+	ResyncInterval time.Duration
+	Logger         *zerolog.Logger
+}
+
+// Watch calls Changed for the objects of the specified resource
+// updated or deleted, until the context is done. When restricted to
+// a namespace, the other namespaces of the referenced objects (i.e.
+// a Secret in another namespace) are watched too, once referenced.
+func (r *References) Watch(ctx context.Context, opts WatchOptions) {
+	if len(opts.Namespace) == 0 {
+		r.watch(ctx, opts)
+		return
+	}
+
+	w := &namespacedWatch{ctx: ctx, opts: opts, namespaces: map[string]bool{opts.Namespace: true}}
+	r.mu.Lock()
+	r.watches = append(r.watches, w)
+	for ref := range r.readers {
+		r.extendLocked(w, ref.Namespace)
+	}
+	r.mu.Unlock()
+
+	defer func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for i, el := range r.watches {
+			if el == w {
+				r.watches = append(r.watches[:i], r.watches[i+1:]...)
+				break
+			}
+		}
+	}()
+
+	r.watch(ctx, opts)
+}
+
+// extendLocked starts watching the namespace, if not yet.
+func (r *References) extendLocked(w *namespacedWatch, namespace string) {
+	if len(namespace) == 0 || w.namespaces[namespace] || w.ctx.Err() != nil {
+		return
+	}
+	w.namespaces[namespace] = true
+
+	opts := w.opts
+	opts.Namespace = namespace
+	opts.Logger.Info().Str("namespace", namespace).
+		Str("resource", opts.GVR.Resource).
+		Msg("Watching referenced objects in another namespace.")
+	go r.watch(w.ctx, opts)
+}
+
+// watch runs the informer of Watch.
+func (r *References) watch(ctx context.Context, opts WatchOptions) {
+	changed := func(obj interface{}) {
+		if d, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+			obj = d.Obj
+		}
+		el, ok := obj.(*unstructured.Unstructured)
+		if !ok {
+			return
+		}
+		ref := refOf(el)
+		if readers := r.Readers(ref); len(readers) > 0 {
+			opts.Logger.Debug().Str("objectRef", ref.String()).
+				Int("readers", len(readers)).
+				Msg("Referenced object changed.")
+			r.Changed(ref)
+		}
+	}
+
+	_, informer := cache.NewInformer(
+		listwatcher.Create(listwatcher.CreateOptions{
+			Client:    opts.Client,
+			GVR:       opts.GVR,
+			Namespace: opts.Namespace,
+		}),
+		&unstructured.Unstructured{},
+		opts.ResyncInterval,
+		cache.ResourceEventHandlerFuncs{
+			UpdateFunc: func(old, new interface{}) {
+				o, ok1 := old.(*unstructured.Unstructured)
+				n, ok2 := new.(*unstructured.Unstructured)
+				// Skip the resyncs.
+				if ok1 && ok2 && o.GetResourceVersion() == n.GetResourceVersion() {
+					return
+				}
+				changed(new)
+			},
+			DeleteFunc: changed,
+		},
+	)
+	informer.Run(ctx.Done())
+}
+
+// requeueReader observes the reader again if served by this controller.
+func (c *Controller) requeueReader(ref ObjectRef) {
+	el := c.cached(ref)
+	if el == nil || el.GetAPIVersion() != ref.APIVersion || el.GetKind() != ref.Kind {
+		return
+	}
+	if c.sharder != nil && !c.sharder.Owns(ref.Namespace, ref.Name) {
+		return
+	}
+	c.queue.Add(event{eventType: Observe, objectRef: ref})
+}
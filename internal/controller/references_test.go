@@ -0,0 +1,128 @@
+package controller_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/harness"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var secrets = harness.Kind{
+	GVR:  schema.GroupVersionResource{Version: "v1", Resource: "secrets"},
+	Kind: "Secret",
+}
+
+func TestReferences(t *testing.T) {
+	a := controller.ObjectRef{APIVersion: "composition.krateo.io/v1", Kind: "Widget", Name: "a", Namespace: "default"}
+	b := controller.ObjectRef{APIVersion: "composition.krateo.io/v1", Kind: "Widget", Name: "b", Namespace: "default"}
+	s1 := controller.ObjectRef{APIVersion: "v1", Kind: "Secret", Name: "s1", Namespace: "default"}
+	s2 := controller.ObjectRef{APIVersion: "v1", Kind: "Secret", Name: "s2", Namespace: "default"}
+
+	refs := controller.NewReferences()
+	refs.Set(a, []controller.ObjectRef{s1})
+	refs.Set(b, []controller.ObjectRef{s1})
+	assert.ElementsMatch(t, []controller.ObjectRef{a, b}, refs.Readers(s1))
+
+	// Replaced.
+	refs.Set(a, []controller.ObjectRef{s2})
+	assert.Equal(t, []controller.ObjectRef{b}, refs.Readers(s1))
+	assert.Equal(t, []controller.ObjectRef{a}, refs.Readers(s2))
+
+	refs.Set(b, nil)
+	assert.Empty(t, refs.Readers(s1))
+
+	var none *controller.References
+	none.Set(a, []controller.ObjectRef{s1})
+	none.Changed(s1)
+	assert.Empty(t, none.Readers(s1))
+}
+
+func TestControllerObservesOnSecretChange(t *testing.T) {
+	testObservesOnSecretChange(t, harness.Namespace)
+}
+
+func TestControllerObservesOnSecretChangeInOtherNamespace(t *testing.T) {
+	testObservesOnSecretChange(t, "vault")
+}
+
+// testObservesOnSecretChange watches the Secrets of the harness namespace
+// and rotates a referenced one of the specified namespace.
+func testObservesOnSecretChange(t *testing.T, namespace string) {
+	sec := &unstructured.Unstructured{}
+	sec.SetAPIVersion("v1")
+	sec.SetKind("Secret")
+	sec.SetName("credentials")
+	sec.SetNamespace(namespace)
+	sec.Object["data"] = map[string]interface{}{"token": "b2xk"}
+
+	env := harness.New(t, harness.Options{
+		Watched: widgets,
+		Kinds:   []harness.Kind{secrets},
+		Objects: []runtime.Object{sec},
+	})
+	rec := harness.NewRecorder()
+	refs := controller.NewReferences()
+	env.Start(controller.Options{ExternalClient: rec, References: refs})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		log := zerolog.Nop()
+		refs.Watch(ctx, controller.WatchOptions{
+			Client:    env.Dynamic,
+			GVR:       secrets.GVR,
+			Namespace: harness.Namespace,
+			Logger:    &log,
+		})
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	el := env.Create(env.NewObject("sample", nil))
+	env.Wait("create", func() bool {
+		return rec.Exists(harness.Namespace, "sample")
+	})
+	// The Observe following the Create (the first one found it missing).
+	env.Wait("observe after create", func() bool {
+		return rec.Count(controller.Observe) > 1
+	})
+
+	// As recorded by the REST getter.
+	refs.Set(controller.ObjectRef{
+		APIVersion: el.GetAPIVersion(),
+		Kind:       el.GetKind(),
+		Name:       el.GetName(),
+		Namespace:  el.GetNamespace(),
+	}, []controller.ObjectRef{
+		{APIVersion: "v1", Kind: "Secret", Name: "credentials", Namespace: namespace},
+	})
+	observed := rec.Count(controller.Observe)
+
+	// Rotated, until the watch has started.
+	rotations := 0
+	env.Wait("observe", func() bool {
+		if rec.Count(controller.Observe) > observed {
+			return true
+		}
+		cur, err := env.Dynamic.Resource(secrets.GVR).Namespace(namespace).
+			Get(ctx, "credentials", metav1.GetOptions{})
+		if err == nil {
+			rotations++
+			cur.Object["data"] = map[string]interface{}{"token": fmt.Sprintf("bmV3%d", rotations)}
+			env.Dynamic.Resource(secrets.GVR).Namespace(namespace).
+				Update(ctx, cur, metav1.UpdateOptions{})
+		}
+		return false
+	})
+}
@@ -0,0 +1,45 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// RequeueError is returned by an ExternalClient to have the event
+// processed again after a while, without counting it as a failure:
+// e.g. while an asynchronous operation of the external system runs.
+type RequeueError struct {
+	After  time.Duration
+	Reason string
+}
+
+func (e *RequeueError) Error() string {
+	return fmt.Sprintf("requeue after %s: %s", e.After, e.Reason)
+}
+
+// RequeueAfter returns a RequeueError.
+func RequeueAfter(d time.Duration, reason string) error {
+	return &RequeueError{After: d, Reason: reason}
+}
+
+// IsRequeue returns true if err is (or wraps) a RequeueError.
+func IsRequeue(err error) bool {
+	var re *RequeueError
+	return errors.As(err, &re)
+}
+
+// requeue queues the event again if err is a RequeueError.
+func (c *Controller) requeue(err error, obj interface{}) bool {
+	var re *RequeueError
+	if !errors.As(err, &re) {
+		return false
+	}
+
+	c.logger.Debug().Str("obj", fmt.Sprintf("%v", obj)).
+		Dur("after", re.After).
+		Msg(re.Reason)
+	c.queue.Forget(obj)
+	c.queue.AddAfter(obj, re.After)
+	return true
+}
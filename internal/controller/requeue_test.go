@@ -0,0 +1,34 @@
+package controller_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/harness"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequeueIsNotARetry(t *testing.T) {
+	env := harness.New(t, harness.Options{Watched: widgets})
+	rec := harness.NewRecorder()
+	rec.Fail(controller.Observe, controller.RequeueAfter(10*time.Millisecond, "waiting for the operation"))
+	env.Start(controller.Options{ExternalClient: rec})
+
+	env.Create(env.NewObject("sample", nil))
+
+	// Far more than the retries of a failure.
+	env.Wait("observe", func() bool {
+		return rec.Count(controller.Observe) > 10
+	})
+	assert.Equal(t, 0, rec.Count(controller.Create))
+}
+
+func TestIsRequeue(t *testing.T) {
+	err := controller.RequeueAfter(time.Second, "waiting")
+	assert.True(t, controller.IsRequeue(err))
+	assert.True(t, controller.IsRequeue(fmt.Errorf("observe: %w", err)))
+	assert.False(t, controller.IsRequeue(fmt.Errorf("failed")))
+	assert.Equal(t, "requeue after 1s: waiting", err.Error())
+}
@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// TimeoutOptions are the deadlines of the ExternalClient operations.
+// Zero values are replaced by the defaults; the resources can override
+// them with the meta.AnnotationKeyTimeout annotations.
+type TimeoutOptions struct {
+	Observe time.Duration
+	Create  time.Duration
+	Update  time.Duration
+	Delete  time.Duration
+}
+
+func (o *TimeoutOptions) setDefaults() {
+	if o.Observe <= 0 {
+		o.Observe = 2 * time.Minute
+	}
+	if o.Create <= 0 {
+		o.Create = 5 * time.Minute
+	}
+	if o.Update <= 0 {
+		o.Update = 5 * time.Minute
+	}
+	if o.Delete <= 0 {
+		o.Delete = 5 * time.Minute
+	}
+}
+
+// For returns the deadline of the specified operation.
+func (o TimeoutOptions) For(et EventType) time.Duration {
+	switch et {
+	case Create:
+		return o.Create
+	case Update:
+		return o.Update
+	case Delete:
+		return o.Delete
+	default:
+		return o.Observe
+	}
+}
+
+// TimeoutError is returned when an ExternalClient operation
+// did not complete within its deadline.
+type TimeoutError struct {
+	Op      EventType
+	Timeout time.Duration
+	Err     error
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%s timed out after %s: %v", e.Op, e.Timeout, e.Err)
+}
+
+func (e *TimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// IsTimeout returns true if err is (or wraps) a TimeoutError.
+func IsTimeout(err error) bool {
+	var te *TimeoutError
+	return errors.As(err, &te)
+}
+
+// timeoutFor returns the deadline of the operation on the specified object.
+func (c *Controller) timeoutFor(et EventType, el *unstructured.Unstructured) time.Duration {
+	d, err := meta.GetTimeout(el, string(et))
+	if err != nil {
+		c.logger.Warn().Err(err).
+			Str("name", el.GetName()).
+			Str("namespace", el.GetNamespace()).
+			Msg("Ignoring timeout annotation.")
+	}
+	if d > 0 {
+		return d
+	}
+	return c.timeouts.Load().For(et)
+}
+
+// reportError reports the timeouts with a TimedOut condition on the object.
+func (c *Controller) reportError(ctx context.Context, _ EventType, el *unstructured.Unstructured, err error) {
+	if !IsTimeout(err) {
+		return
+	}
+
+	c.logger.Warn().Err(err).
+		Str("name", el.GetName()).
+		Str("namespace", el.GetNamespace()).
+		Msg("External client operation timed out.")
+
+	if e := c.setCondition(ctx, el, condition.TimedOut(err.Error())); e != nil {
+		c.logger.Err(e).Msg("Updating status with timed out condition.")
+	}
+}
+
+// setCondition reports the (not Ready) condition with a condition
+// and an event on the object.
+func (c *Controller) setCondition(ctx context.Context, el *unstructured.Unstructured, cond metav1.Condition) error {
+	return c.putCondition(ctx, el, cond, false)
+}
+
+// updateCondition is like setCondition, but writes nothing when the
+// Ready condition of the object has already the same reason and message.
+func (c *Controller) updateCondition(ctx context.Context, el *unstructured.Unstructured, cond metav1.Condition) error {
+	return c.putCondition(ctx, el, cond, true)
+}
+
+func (c *Controller) putCondition(ctx context.Context, el *unstructured.Unstructured, cond metav1.Condition, onChange bool) error {
+	cli := c.dynamicClient.Resource(c.gvr).Namespace(el.GetNamespace())
+	res, err := cli.Get(ctx, el.GetName(), metav1.GetOptions{})
+	if err != nil {
+		return err
+	}
+
+	co, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&cond)
+	if err != nil {
+		return err
+	}
+
+	conds, _, _ := unstructured.NestedSlice(res.Object, "status", "conditions")
+	found := false
+	for i, el := range conds {
+		m, ok := el.(map[string]interface{})
+		if !ok || !strings.EqualFold(fmt.Sprint(m["type"]), condition.TypeReady) {
+			continue
+		}
+		reason, _ := m["reason"].(string)
+		message, _ := m["message"].(string)
+		if onChange && reason == cond.Reason && message == cond.Message {
+			return nil
+		}
+		conds[i] = co
+		found = true
+	}
+	if !found {
+		conds = append(conds, co)
+	}
+
+	if c.recorder != nil {
+		c.recorder.Event(el, corev1.EventTypeWarning, cond.Reason, cond.Message)
+	}
+
+	err = unstructured.SetNestedSlice(res.Object, conds, "status", "conditions")
+	if err != nil {
+		return err
+	}
+
+	_, err = cli.UpdateStatus(ctx, res, metav1.UpdateOptions{})
+	return err
+}
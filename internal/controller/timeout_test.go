@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/meta"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/tools/cache"
+)
+
+// hangingClient blocks every operation until the ctx is done.
+type hangingClient struct{}
+
+func (hangingClient) Observe(ctx context.Context, _ *unstructured.Unstructured) (bool, error) {
+	<-ctx.Done()
+	return false, ctx.Err()
+}
+
+func (hangingClient) Create(ctx context.Context, _ *unstructured.Unstructured) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (hangingClient) Update(ctx context.Context, _ *unstructured.Unstructured) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func (hangingClient) Delete(ctx context.Context, _ *unstructured.Unstructured) error {
+	<-ctx.Done()
+	return ctx.Err()
+}
+
+func newTimeoutTestController(t *testing.T, annotations map[string]string) (*Controller, ObjectRef) {
+	t.Helper()
+
+	gvr := schema.GroupVersionResource{Group: "composition.krateo.io", Version: "v1", Resource: "tests"}
+
+	obj := &unstructured.Unstructured{}
+	obj.SetAPIVersion("composition.krateo.io/v1")
+	obj.SetKind("Test")
+	obj.SetName("sample")
+	obj.SetNamespace("default")
+	obj.SetAnnotations(annotations)
+
+	cli := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvr: "TestList"}, obj)
+
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	if err := indexer.Add(obj); err != nil {
+		t.Fatal(err)
+	}
+
+	log := zerolog.Nop()
+	c := &Controller{
+		dynamicClient: cli,
+		gvr:           gvr,
+		indexer:       indexer,
+		logger:        &log,
+	}
+	c.SetTimeouts(TimeoutOptions{Create: 20 * time.Millisecond})
+	c.SetExternalClient(hangingClient{})
+
+	return c, ObjectRef{APIVersion: "composition.krateo.io/v1", Kind: "Test", Name: "sample", Namespace: "default"}
+}
+
+func TestCreateTimeout(t *testing.T) {
+	c, ref := newTimeoutTestController(t, nil)
+
+	start := time.Now()
+	err := c.handleCreate(context.TODO(), ref)
+	assert.True(t, IsTimeout(err))
+	assert.Less(t, time.Since(start), time.Second)
+
+	res, err := c.dynamicClient.Resource(c.gvr).Namespace(ref.Namespace).
+		Get(context.TODO(), ref.Name, metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conds, _, _ := unstructured.NestedSlice(res.Object, "status", "conditions")
+	if assert.Equal(t, 1, len(conds)) {
+		co := conds[0].(map[string]interface{})
+		assert.Equal(t, condition.TypeReady, co["type"])
+		assert.Equal(t, condition.ReasonTimedOut, co["reason"])
+	}
+}
+
+func TestTimeoutAnnotationOverride(t *testing.T) {
+	c, ref := newTimeoutTestController(t, map[string]string{
+		meta.AnnotationKeyTimeoutPrefix + "observe": "10ms",
+	})
+
+	err := c.handleObserve(context.TODO(), ref)
+
+	var te *TimeoutError
+	if assert.ErrorAs(t, err, &te) {
+		assert.Equal(t, Observe, te.Op)
+		assert.Equal(t, 10*time.Millisecond, te.Timeout)
+	}
+}
+
+func TestCanceledIsNotTimeout(t *testing.T) {
+	c, ref := newTimeoutTestController(t, nil)
+
+	ctx, cancel := context.WithTimeout(context.TODO(), 5*time.Millisecond)
+	defer cancel()
+
+	err := c.handleUpdateEvent(ctx, ref)
+	assert.NotNil(t, err)
+	assert.False(t, IsTimeout(err))
+}
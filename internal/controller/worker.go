@@ -12,7 +12,7 @@ import (
 )
 
 const (
-	maxRetries = 5
+	defaultMaxRetries = 5
 )
 
 func (c *Controller) runWorker(ctx context.Context) {
@@ -21,10 +21,10 @@ func (c *Controller) runWorker(ctx context.Context) {
 		if shutdown {
 			break
 		}
-		defer c.queue.Done(obj)
 
 		err := c.processItem(ctx, obj)
 		c.handleErr(err, obj)
+		c.queue.Done(obj)
 	}
 }
 
@@ -33,8 +33,11 @@ func (c *Controller) handleErr(err error, obj interface{}) {
 		c.queue.Forget(obj)
 		return
 	}
+	if c.requeue(err, obj) {
+		return
+	}
 
-	if retries := c.queue.NumRequeues(obj); retries < maxRetries {
+	if retries := c.queue.NumRequeues(obj); retries < int(c.maxRetries.Load()) {
 		c.logger.Warn().Int("retries", retries).
 			Str("obj", fmt.Sprintf("%v", obj)).
 			Msgf("error processing event: %v, retrying", err)
@@ -54,6 +57,18 @@ func (c *Controller) processItem(ctx context.Context, obj interface{}) error {
 		return nil
 	}
 
+	if c.sharder != nil {
+		shardCtx, done, ok := c.sharder.Track(ctx, evt.objectRef.Namespace, evt.objectRef.Name)
+		if !ok {
+			c.logger.Debug().Str("event", string(evt.eventType)).
+				Str("ref", evt.objectRef.String()).
+				Msg("object not in a shard held by this replica, skipping")
+			return nil
+		}
+		defer done()
+		ctx = shardCtx
+	}
+
 	c.logger.Debug().Str("event", string(evt.eventType)).Str("ref", evt.objectRef.String()).Msg("processing")
 	switch evt.eventType {
 	case Create:
@@ -68,7 +83,7 @@ func (c *Controller) processItem(ctx context.Context, obj interface{}) error {
 }
 
 func (c *Controller) handleObserve(ctx context.Context, ref ObjectRef) error {
-	if c.externalClient == nil {
+	if c.client == nil {
 		c.logger.Warn().
 			Str("eventType", string(Observe)).
 			Msg("No event handler registered.")
@@ -83,7 +98,7 @@ func (c *Controller) handleObserve(ctx context.Context, ref ObjectRef) error {
 		return err
 	}
 
-	exists, err := c.externalClient.Observe(ctx, el)
+	exists, err := c.client.Observe(ctx, el)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			c.queue.Add(event{
@@ -95,20 +110,24 @@ func (c *Controller) handleObserve(ctx context.Context, ref ObjectRef) error {
 		return err
 	}
 
+	if exists {
+		c.record(ctx, el)
+	}
+
 	if !exists {
 		// fmt.Println("Create: ", ref.String())
 		//return c.externalClient.Create(ctx, el)
 		c.queue.AddAfter(event{
 			eventType: Create,
 			objectRef: ref,
-		}, time.Second*3)
+		}, time.Duration(c.pollInterval.Load()))
 	}
 
 	return nil
 }
 
 func (c *Controller) handleCreate(ctx context.Context, ref ObjectRef) error {
-	if c.externalClient == nil {
+	if c.client == nil {
 		c.logger.Warn().
 			Str("eventType", string(Create)).
 			Msg("No event handler registered.")
@@ -123,11 +142,25 @@ func (c *Controller) handleCreate(ctx context.Context, ref ObjectRef) error {
 		return err
 	}
 
-	return c.externalClient.Create(ctx, el)
+	if c.deferToMaintenance(ctx, Create, el, false) {
+		return nil
+	}
+	if wait, err := c.waitForDependencies(ctx, Create, el); wait || err != nil {
+		return err
+	}
+
+	err = c.client.Create(ctx, el)
+	if err != nil {
+		return err
+	}
+
+	c.record(ctx, el)
+	c.observeLater(ref)
+	return nil
 }
 
 func (c *Controller) handleUpdateEvent(ctx context.Context, ref ObjectRef) error {
-	if c.externalClient == nil {
+	if c.client == nil {
 		c.logger.Warn().
 			Str("eventType", string(Update)).
 			Msg("No event handler registered.")
@@ -142,11 +175,25 @@ func (c *Controller) handleUpdateEvent(ctx context.Context, ref ObjectRef) error
 		return err
 	}
 
-	return c.externalClient.Update(ctx, el)
+	if c.deferToMaintenance(ctx, Update, el, false) {
+		return nil
+	}
+	if wait, err := c.waitForDependencies(ctx, Update, el); wait || err != nil {
+		return err
+	}
+
+	err = c.client.Update(ctx, el)
+	if err != nil {
+		return err
+	}
+
+	c.record(ctx, el)
+	c.observeLater(ref)
+	return nil
 }
 
 func (c *Controller) handleDeleteEvent(ctx context.Context, ref ObjectRef) error {
-	if c.externalClient == nil {
+	if c.client == nil {
 		c.logger.Warn().
 			Str("eventType", string(Delete)).
 			Msg("No event handler registered.")
@@ -154,6 +201,17 @@ func (c *Controller) handleDeleteEvent(ctx context.Context, ref ObjectRef) error
 	}
 
 	el, err := c.fetch(ctx, ref, true)
+	tombstone := false
+	if apierrors.IsNotFound(err) {
+		// Deleted without our finalizer or while we were down:
+		// use its last known state.
+		el, tombstone = c.tombstone(ref)
+		if !tombstone {
+			c.logger.Debug().Str("objectRef", ref.String()).Msg("Object already gone.")
+			return nil
+		}
+		err = nil
+	}
 	if err != nil {
 		c.logger.Err(err).
 			Str("objectRef", ref.String()).
@@ -161,21 +219,77 @@ func (c *Controller) handleDeleteEvent(ctx context.Context, ref ObjectRef) error
 		return err
 	}
 
-	return c.externalClient.Delete(ctx, el)
+	if c.deferToMaintenance(ctx, Delete, el, tombstone) {
+		return nil
+	}
+
+	if !tombstone {
+		c.startDelete(ref)
+	}
+	err = c.client.Delete(ctx, el)
+	gone := !tombstone && c.endDelete(ref)
+	if err != nil {
+		return err
+	}
+
+	c.deleted(ctx, ref, tombstone || gone)
+	return nil
 }
 
+// observeLater queues an Observe after the poll interval: the
+// writes of the external client do not trigger one (see Predicate).
+func (c *Controller) observeLater(ref ObjectRef) {
+	c.queue.AddAfter(event{
+		eventType: Observe,
+		objectRef: ref,
+	}, time.Duration(c.pollInterval.Load()))
+}
+
+// fetch returns a copy of the object from the informer cache, or from
+// the API server if live reads are enabled or the cache misses it.
+// When clean is true, the last applied configuration annotation is removed.
 func (c *Controller) fetch(ctx context.Context, ref ObjectRef, clean bool) (*unstructured.Unstructured, error) {
-	res, err := c.dynamicClient.Resource(c.gvr).
-		Namespace(ref.Namespace).
-		Get(ctx, ref.Name, metav1.GetOptions{})
-	if err == nil {
-		if clean && res != nil {
-			unstructured.RemoveNestedField(res.Object,
-				"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration")
-			unstructured.RemoveNestedField(res.Object, "metadata", "creationTimestamp")
-			unstructured.RemoveNestedField(res.Object, "metadata", "generation")
-			unstructured.RemoveNestedField(res.Object, "metadata", "uid")
+	var res *unstructured.Unstructured
+	if !c.liveReads {
+		res = c.cached(ref)
+	}
+
+	if res == nil {
+		var err error
+		res, err = c.dynamicClient.Resource(c.gvr).
+			Namespace(ref.Namespace).
+			Get(ctx, ref.Name, metav1.GetOptions{})
+		if err != nil {
+			return res, err
 		}
 	}
-	return res, err
+
+	if clean {
+		unstructured.RemoveNestedField(res.Object,
+			"metadata", "annotations", "kubectl.kubernetes.io/last-applied-configuration")
+	}
+	return res, nil
+}
+
+// cached returns a copy of the object in the informer cache, if any.
+func (c *Controller) cached(ref ObjectRef) *unstructured.Unstructured {
+	obj, exists, err := c.indexer.GetByKey(cacheKey(ref.Namespace, ref.Name))
+	if err != nil || !exists {
+		return nil
+	}
+
+	el, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil
+	}
+	// Never modify the objects in the cache.
+	return el.DeepCopy()
+}
+
+// cacheKey returns the informer cache key of the object.
+func cacheKey(namespace, name string) string {
+	if len(namespace) == 0 {
+		return name
+	}
+	return namespace + "/" + name
 }
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/maintenance"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured/condition"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func TestFetch(t *testing.T) {
+	live := newTestObject("sample")
+	live.SetUID(types.UID("1234"))
+	live.SetGeneration(2)
+	live.SetAnnotations(map[string]string{
+		"kubectl.kubernetes.io/last-applied-configuration": "{}",
+	})
+
+	c, _ := newOrphansTestController(t, nil, OrphanPolicyReport, live)
+
+	// The cache holds an older state.
+	old := live.DeepCopy()
+	old.SetGeneration(1)
+	assert.Nil(t, c.indexer.Update(old))
+
+	el, err := c.fetch(context.TODO(), refOf(live), true)
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(1), el.GetGeneration())
+		assert.Equal(t, types.UID("1234"), el.GetUID())
+		assert.Empty(t, el.GetAnnotations())
+	}
+
+	// The cached object is never modified.
+	el.SetGeneration(3)
+	obj, _, _ := c.indexer.GetByKey("default/sample")
+	cached := obj.(*unstructured.Unstructured)
+	assert.Equal(t, int64(1), cached.GetGeneration())
+	assert.Equal(t, 1, len(cached.GetAnnotations()))
+
+	c.liveReads = true
+	el, err = c.fetch(context.TODO(), refOf(live), false)
+	if assert.Nil(t, err) {
+		assert.Equal(t, int64(2), el.GetGeneration())
+		assert.Equal(t, 1, len(el.GetAnnotations()))
+	}
+}
+
+func TestFetchCacheMiss(t *testing.T) {
+	live := newTestObject("sample")
+	c, _ := newOrphansTestController(t, nil, OrphanPolicyReport, live)
+	assert.Nil(t, c.indexer.Delete(live))
+
+	el, err := c.fetch(context.TODO(), refOf(live), true)
+	if assert.Nil(t, err) {
+		assert.Equal(t, "sample", el.GetName())
+	}
+
+	_, err = c.fetch(context.TODO(), ObjectRef{Name: "missing", Namespace: "default"}, true)
+	assert.NotNil(t, err)
+}
+
+func TestDeferToMaintenance(t *testing.T) {
+	c, _ := newOrphansTestController(t, nil, OrphanPolicyReport, newTestObject("sample"))
+	assert.Nil(t, c.SetMaintenance(maintenance.Spec{
+		Schedule: fmt.Sprintf("%d * * * *", (time.Now().UTC().Minute()+30)%60),
+		Duration: time.Minute,
+	}))
+
+	cli := c.dynamicClient.Resource(testGVR).Namespace("default")
+	get := func() *unstructured.Unstructured {
+		el, err := cli.Get(context.TODO(), "sample", metav1.GetOptions{})
+		assert.Nil(t, err)
+		return el
+	}
+
+	// A tombstone is not marked.
+	assert.True(t, c.deferToMaintenance(context.TODO(), Delete, newTestObject("sample"), true))
+	_, found, _ := unstructured.NestedSlice(get().Object, "status", "conditions")
+	assert.False(t, found)
+
+	assert.True(t, c.deferToMaintenance(context.TODO(), Delete, get(), false))
+	el := get()
+	conds, _, _ := unstructured.NestedSlice(el.Object, "status", "conditions")
+	if assert.Len(t, conds, 1) {
+		assert.Equal(t, condition.ReasonMaintenanceWindowClosed, conds[0].(map[string]interface{})["reason"])
+	}
+
+	// Unchanged, not written again.
+	writes := func() (n int) {
+		for _, a := range c.dynamicClient.(*fake.FakeDynamicClient).Actions() {
+			if a.GetVerb() == "update" && a.GetSubresource() == "status" {
+				n++
+			}
+		}
+		return n
+	}
+	assert.Equal(t, 1, writes())
+	assert.True(t, c.deferToMaintenance(context.TODO(), Delete, el, false))
+	assert.Equal(t, 1, writes())
+}
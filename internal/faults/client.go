@@ -0,0 +1,50 @@
+package faults
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/rs/zerolog"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Middleware injects the faults in the ExternalClient operations.
+// The AnnotationKey annotation of a resource overrides the injector
+// spec and is passed on to the Transport through the ctx.
+func Middleware(in *Injector) controller.Middleware {
+	return controller.Intercept(func(ctx context.Context, op controller.EventType, mg *unstructured.Unstructured, call func(context.Context) error) error {
+		var spec *Spec
+		if val, ok := mg.GetAnnotations()[AnnotationKey]; ok {
+			s, err := ParseSpec(val)
+			if err != nil {
+				zerolog.Ctx(ctx).Warn().Err(err).Msg("Ignoring fault injection annotation.")
+			} else {
+				spec = &s
+				ctx = WithSpec(ctx, s)
+			}
+		}
+
+		kind, latency := in.Draw(string(op), spec)
+		if err := sleep(ctx, latency); err != nil {
+			return err
+		}
+		if kind != None {
+			zerolog.Ctx(ctx).Debug().Str("fault", string(kind)).Msg("Injecting fault.")
+		}
+
+		switch kind {
+		case Error:
+			return fmt.Errorf("%s: %w", op, ErrInjected)
+		case Timeout:
+			<-ctx.Done()
+			return ctx.Err()
+		case Partial:
+			if err := call(ctx); err != nil {
+				return err
+			}
+			return fmt.Errorf("%s (partial): %w", op, ErrInjected)
+		}
+		return call(ctx)
+	})
+}
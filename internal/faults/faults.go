@@ -0,0 +1,235 @@
+// Package faults injects latency, errors, timeouts and partial failures
+// in the external client operations and in the http calls, to exercise
+// the controller retry, backoff and condition handling.
+// It must never be enabled in production.
+package faults
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// AnnotationKey is the key in the annotations map of a resource
+	// holding a Spec that overrides the injector one for that resource
+	// (e.g. "error=1,ops=delete"). It is honored only when fault
+	// injection is enabled.
+	AnnotationKey = "krateo.io/inject-faults"
+)
+
+// ErrInjected is the error returned by the injected failures.
+var ErrInjected = errors.New("injected fault")
+
+// Kind is the kind of an injected fault.
+type Kind string
+
+const (
+	// None means the operation runs normally (possibly with latency).
+	None Kind = ""
+	// Error fails the operation without running it.
+	Error Kind = "error"
+	// Timeout blocks the operation until its ctx is done.
+	Timeout Kind = "timeout"
+	// Partial runs the operation and then fails it, as if its
+	// response had been lost.
+	Partial Kind = "partial"
+)
+
+// Spec tells which faults to inject and how often.
+type Spec struct {
+	// Error is the probability [0,1] of an Error fault.
+	Error float64
+	// Timeout is the probability [0,1] of a Timeout fault.
+	Timeout float64
+	// Partial is the probability [0,1] of a Partial fault.
+	Partial float64
+	// Latency is added to every operation.
+	Latency time.Duration
+	// Jitter is the maximum random latency added to Latency.
+	Jitter time.Duration
+	// Ops restricts the faults to these operations (observe, create,
+	// update or delete); empty means all.
+	Ops []string
+	// Seed makes the drawn faults reproducible (zero means random).
+	Seed int64
+}
+
+// ParseSpec parses a comma separated list of 'key=value', where key is
+// one of error, timeout, partial (probabilities), latency, jitter
+// (durations), ops (operations separated by '+') and seed,
+// e.g. "error=0.2,latency=500ms,ops=create+update".
+func ParseSpec(s string) (Spec, error) {
+	res := Spec{}
+	for _, el := range strings.Split(s, ",") {
+		el = strings.TrimSpace(el)
+		if len(el) == 0 {
+			continue
+		}
+
+		key, val, ok := strings.Cut(el, "=")
+		if !ok {
+			return res, fmt.Errorf("invalid fault %q (expected 'key=value')", el)
+		}
+		key, val = strings.ToLower(strings.TrimSpace(key)), strings.TrimSpace(val)
+
+		var err error
+		switch key {
+		case "error":
+			res.Error, err = parseRate(val)
+		case "timeout":
+			res.Timeout, err = parseRate(val)
+		case "partial":
+			res.Partial, err = parseRate(val)
+		case "latency":
+			res.Latency, err = time.ParseDuration(val)
+		case "jitter":
+			res.Jitter, err = time.ParseDuration(val)
+		case "seed":
+			res.Seed, err = strconv.ParseInt(val, 10, 64)
+		case "ops":
+			for _, op := range strings.Split(val, "+") {
+				op = strings.ToLower(strings.TrimSpace(op))
+				switch op {
+				case "observe", "create", "update", "delete":
+					res.Ops = append(res.Ops, op)
+				default:
+					err = fmt.Errorf("unknown operation %q", op)
+				}
+			}
+		default:
+			err = fmt.Errorf("unknown key")
+		}
+		if err != nil {
+			return res, fmt.Errorf("invalid fault %q: %w", el, err)
+		}
+	}
+
+	if res.Error+res.Timeout+res.Partial > 1 {
+		return res, fmt.Errorf("the sum of the fault probabilities must not exceed 1")
+	}
+	if res.Latency < 0 || res.Jitter < 0 {
+		return res, fmt.Errorf("latency and jitter must not be negative")
+	}
+	return res, nil
+}
+
+func parseRate(s string) (float64, error) {
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if f < 0 || f > 1 {
+		return 0, fmt.Errorf("probability must be between 0 and 1")
+	}
+	return f, nil
+}
+
+// applies returns true if the spec covers the operation.
+func (s Spec) applies(op string) bool {
+	if len(s.Ops) == 0 {
+		return true
+	}
+	op = strings.ToLower(op)
+	for _, el := range s.Ops {
+		if el == op {
+			return true
+		}
+	}
+	return false
+}
+
+// Injector draws the faults of a Spec.
+type Injector struct {
+	spec Spec
+
+	mu  sync.Mutex
+	rnd *rand.Rand
+}
+
+// New returns an Injector for the spec; the same spec seed gives
+// the same sequence of faults.
+func New(spec Spec) *Injector {
+	seed := spec.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	return &Injector{
+		spec: spec,
+		rnd:  rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Spec returns the injector spec.
+func (in *Injector) Spec() Spec {
+	return in.spec
+}
+
+// Draw returns the fault and the latency to inject in the operation
+// according to the spec (or the injector one if nil).
+func (in *Injector) Draw(op string, spec *Spec) (Kind, time.Duration) {
+	if spec == nil {
+		spec = &in.spec
+	}
+	if !spec.applies(op) {
+		return None, 0
+	}
+
+	in.mu.Lock()
+	p := in.rnd.Float64()
+	var jitter time.Duration
+	if spec.Jitter > 0 {
+		jitter = time.Duration(in.rnd.Int63n(int64(spec.Jitter) + 1))
+	}
+	in.mu.Unlock()
+
+	latency := spec.Latency + jitter
+	switch {
+	case p < spec.Error:
+		return Error, latency
+	case p < spec.Error+spec.Timeout:
+		return Timeout, latency
+	case p < spec.Error+spec.Timeout+spec.Partial:
+		return Partial, latency
+	}
+	return None, latency
+}
+
+// sleep waits for d or until the ctx is done.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+type specKey struct{}
+
+// WithSpec returns a ctx carrying the spec of the current resource,
+// used by the Transport in place of its own.
+func WithSpec(ctx context.Context, spec Spec) context.Context {
+	return context.WithValue(ctx, specKey{}, spec)
+}
+
+// SpecFrom returns the spec carried by the ctx, if any.
+func SpecFrom(ctx context.Context) (*Spec, bool) {
+	spec, ok := ctx.Value(specKey{}).(Spec)
+	if !ok {
+		return nil, false
+	}
+	return &spec, true
+}
@@ -0,0 +1,140 @@
+package faults
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func TestParseSpec(t *testing.T) {
+	spec, err := ParseSpec("error=0.2, timeout=0.1,partial=0.3,latency=1s,jitter=10ms,ops=create+Delete,seed=7")
+	if assert.Nil(t, err) {
+		assert.Equal(t, Spec{
+			Error:   0.2,
+			Timeout: 0.1,
+			Partial: 0.3,
+			Latency: time.Second,
+			Jitter:  10 * time.Millisecond,
+			Ops:     []string{"create", "delete"},
+			Seed:    7,
+		}, spec)
+	}
+
+	spec, err = ParseSpec("")
+	assert.Nil(t, err)
+	assert.Equal(t, Spec{}, spec)
+
+	for _, el := range []string{"error", "error=2", "error=0.6,timeout=0.6", "ops=list", "latency=-1s", "foo=1"} {
+		_, err := ParseSpec(el)
+		assert.NotNil(t, err, el)
+	}
+}
+
+func TestDraw(t *testing.T) {
+	in := New(Spec{Error: 1, Ops: []string{"create"}})
+
+	kind, _ := in.Draw("Create", nil)
+	assert.Equal(t, Error, kind)
+	kind, _ = in.Draw("Observe", nil)
+	assert.Equal(t, None, kind)
+
+	// The spec argument takes precedence.
+	kind, latency := in.Draw("Create", &Spec{Latency: time.Second})
+	assert.Equal(t, None, kind)
+	assert.Equal(t, time.Second, latency)
+
+	// Same seed, same faults.
+	a, b := New(Spec{Error: 0.5, Seed: 42}), New(Spec{Error: 0.5, Seed: 42})
+	for i := 0; i < 20; i++ {
+		ka, _ := a.Draw("observe", nil)
+		kb, _ := b.Draw("observe", nil)
+		assert.Equal(t, ka, kb)
+	}
+}
+
+// countingClient counts the operations that reached it.
+type countingClient struct {
+	mu    sync.Mutex
+	calls int
+}
+
+func (c *countingClient) inc() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.calls++
+}
+
+func (c *countingClient) Observe(context.Context, *unstructured.Unstructured) (bool, error) {
+	c.inc()
+	return true, nil
+}
+
+func (c *countingClient) Create(context.Context, *unstructured.Unstructured) error {
+	c.inc()
+	return nil
+}
+
+func (c *countingClient) Update(context.Context, *unstructured.Unstructured) error {
+	c.inc()
+	return nil
+}
+
+func (c *countingClient) Delete(context.Context, *unstructured.Unstructured) error {
+	c.inc()
+	return nil
+}
+
+func TestMiddleware(t *testing.T) {
+	obj := &unstructured.Unstructured{}
+	obj.SetName("sample")
+
+	tests := []struct {
+		spec  Spec
+		calls int
+		err   error
+	}{
+		{spec: Spec{}, calls: 1},
+		{spec: Spec{Error: 1}, calls: 0, err: ErrInjected},
+		{spec: Spec{Partial: 1}, calls: 1, err: ErrInjected},
+		{spec: Spec{Timeout: 1}, calls: 0, err: context.DeadlineExceeded},
+	}
+
+	for _, tc := range tests {
+		cc := &countingClient{}
+		ec := controller.Chain(cc, Middleware(New(tc.spec)))
+
+		ctx, cancel := context.WithTimeout(context.TODO(), 20*time.Millisecond)
+		err := ec.Create(ctx, obj)
+		cancel()
+
+		assert.Equal(t, tc.calls, cc.calls, tc.spec)
+		if tc.err == nil {
+			assert.Nil(t, err, tc.spec)
+		} else {
+			assert.True(t, errors.Is(err, tc.err), tc.spec)
+		}
+	}
+}
+
+func TestMiddlewareAnnotation(t *testing.T) {
+	cc := &countingClient{}
+	ec := controller.Chain(cc, Middleware(New(Spec{})))
+
+	obj := &unstructured.Unstructured{}
+	obj.SetName("sample")
+	obj.SetAnnotations(map[string]string{AnnotationKey: "error=1,ops=delete"})
+
+	assert.Nil(t, ec.Update(context.TODO(), obj))
+	assert.True(t, errors.Is(ec.Delete(context.TODO(), obj), ErrInjected))
+	assert.Equal(t, 1, cc.calls)
+
+	// An invalid annotation is ignored.
+	obj.SetAnnotations(map[string]string{AnnotationKey: "error=2"})
+	assert.Nil(t, ec.Delete(context.TODO(), obj))
+}
@@ -0,0 +1,89 @@
+package faults
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+var _ http.RoundTripper = (*Transport)(nil)
+
+// Transport is an http.RoundTripper injecting the faults in the requests.
+// The operation of a request is derived from its method (GET and HEAD
+// are observe, POST is create, PUT and PATCH are update, DELETE is
+// delete). An Error fault is a 503 Service Unavailable response.
+type Transport struct {
+	// Base is the wrapped transport (defaults to http.DefaultTransport).
+	Base http.RoundTripper
+	// Injector draws the faults; the spec carried by the request
+	// context (see WithSpec) takes precedence over its own.
+	Injector *Injector
+}
+
+// NewTransport returns a Transport wrapping base.
+func NewTransport(base http.RoundTripper, in *Injector) *Transport {
+	return &Transport{Base: base, Injector: in}
+}
+
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	ctx := req.Context()
+	spec, _ := SpecFrom(ctx)
+	kind, latency := t.Injector.Draw(operationOf(req.Method), spec)
+	if err := sleep(ctx, latency); err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case Error:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		return &http.Response{
+			Status:        fmt.Sprintf("%d %s", http.StatusServiceUnavailable, http.StatusText(http.StatusServiceUnavailable)),
+			StatusCode:    http.StatusServiceUnavailable,
+			Proto:         "HTTP/1.1",
+			ProtoMajor:    1,
+			ProtoMinor:    1,
+			Header:        http.Header{"Content-Type": []string{"text/plain"}},
+			Body:          io.NopCloser(strings.NewReader(ErrInjected.Error())),
+			ContentLength: int64(len(ErrInjected.Error())),
+			Request:       req,
+		}, nil
+	case Timeout:
+		if req.Body != nil {
+			req.Body.Close()
+		}
+		<-ctx.Done()
+		return nil, ctx.Err()
+	case Partial:
+		res, err := base.RoundTrip(req)
+		if err != nil {
+			return nil, err
+		}
+		// The request went through, the response is lost.
+		io.Copy(io.Discard, res.Body)
+		res.Body.Close()
+		return nil, fmt.Errorf("%s %s (partial): %w", req.Method, req.URL.Path, ErrInjected)
+	}
+
+	return base.RoundTrip(req)
+}
+
+func operationOf(method string) string {
+	switch method {
+	case http.MethodPost:
+		return "create"
+	case http.MethodPut, http.MethodPatch:
+		return "update"
+	case http.MethodDelete:
+		return "delete"
+	default:
+		return "observe"
+	}
+}
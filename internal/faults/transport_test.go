@@ -0,0 +1,52 @@
+package faults
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransport(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer srv.Close()
+
+	cli := &http.Client{Transport: NewTransport(nil, New(Spec{Error: 1, Ops: []string{"delete"}}))}
+
+	res, err := cli.Get(srv.URL)
+	if assert.Nil(t, err) {
+		res.Body.Close()
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+	}
+
+	req, _ := http.NewRequest(http.MethodDelete, srv.URL, nil)
+	res, err = cli.Do(req)
+	if assert.Nil(t, err) {
+		res.Body.Close()
+		assert.Equal(t, http.StatusServiceUnavailable, res.StatusCode)
+	}
+	assert.Equal(t, int32(1), hits.Load())
+
+	// The spec in the ctx takes precedence.
+	ctx := WithSpec(context.TODO(), Spec{Partial: 1})
+	req, _ = http.NewRequestWithContext(ctx, http.MethodPost, srv.URL, nil)
+	_, err = cli.Do(req)
+	assert.True(t, errors.Is(err, ErrInjected))
+	assert.Equal(t, int32(2), hits.Load())
+
+	ctx, cancel := context.WithTimeout(WithSpec(context.TODO(), Spec{Timeout: 1}), 20*time.Millisecond)
+	defer cancel()
+	req, _ = http.NewRequestWithContext(ctx, http.MethodGet, srv.URL, nil)
+	_, err = cli.Do(req)
+	assert.True(t, errors.Is(err, context.DeadlineExceeded))
+	assert.Equal(t, int32(2), hits.Load())
+}
@@ -0,0 +1,126 @@
+package harness
+
+import (
+	"fmt"
+	"strconv"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// withAPIServerSemantics makes the writes of the fake client behave as
+// on the API server, which the plain object tracker does not:
+//   - the updates with a stale resource version fail with a Conflict;
+//   - the resource version changes only when the object does, and the
+//     generation only when its spec does;
+//   - the status is written only through the status subresource;
+//   - the objects with finalizers are marked deleted instead of removed,
+//     and removed when their last finalizer is.
+func withAPIServerSemantics(cli *fake.FakeDynamicClient) {
+	tracker := cli.Tracker()
+
+	cli.PrependReactor("create", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		obj, ok := action.(clienttesting.CreateAction).GetObject().(*unstructured.Unstructured)
+		if !ok || len(action.GetSubresource()) > 0 {
+			return false, nil, nil
+		}
+		obj.SetResourceVersion("1")
+		obj.SetGeneration(1)
+		return false, nil, nil
+	})
+
+	cli.PrependReactor("update", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		obj, ok := action.(clienttesting.UpdateAction).GetObject().(*unstructured.Unstructured)
+		if !ok {
+			return false, nil, nil
+		}
+		gvr, ns := action.GetResource(), action.GetNamespace()
+
+		cur, err := get(tracker, action, obj.GetName())
+		if err != nil {
+			return true, nil, err
+		}
+		if rv := obj.GetResourceVersion(); len(rv) > 0 && rv != cur.GetResourceVersion() {
+			return true, nil, apierrors.NewConflict(gvr.GroupResource(), obj.GetName(),
+				fmt.Errorf("the object has been modified; please apply your changes to the latest version and try again"))
+		}
+
+		res := obj.DeepCopy()
+		if action.GetSubresource() == "status" {
+			res = cur.DeepCopy()
+			setStatus(res, obj)
+		} else {
+			setStatus(res, cur)
+			// Only the API server sets them.
+			res.SetGeneration(cur.GetGeneration())
+			res.SetDeletionTimestamp(cur.GetDeletionTimestamp())
+		}
+		res.SetResourceVersion(cur.GetResourceVersion())
+
+		if equality.Semantic.DeepEqual(res, cur) {
+			return true, res, nil
+		}
+		if !equality.Semantic.DeepEqual(res.Object["spec"], cur.Object["spec"]) {
+			res.SetGeneration(cur.GetGeneration() + 1)
+		}
+		res.SetResourceVersion(nextVersion(cur.GetResourceVersion()))
+
+		if res.GetDeletionTimestamp() != nil && len(res.GetFinalizers()) == 0 {
+			return true, res, tracker.Delete(gvr, ns, res.GetName())
+		}
+		return true, res, tracker.Update(gvr, res, ns)
+	})
+
+	cli.PrependReactor("delete", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		name := action.(clienttesting.DeleteAction).GetName()
+		cur, err := get(tracker, action, name)
+		if err != nil {
+			return true, nil, err
+		}
+		if len(cur.GetFinalizers()) == 0 {
+			return false, nil, nil
+		}
+		if cur.GetDeletionTimestamp() != nil {
+			return true, cur, nil
+		}
+
+		res := cur.DeepCopy()
+		now := metav1.Now()
+		res.SetDeletionTimestamp(&now)
+		res.SetResourceVersion(nextVersion(cur.GetResourceVersion()))
+		return true, res, tracker.Update(action.GetResource(), res, action.GetNamespace())
+	})
+}
+
+// get returns the object of the action from the tracker.
+func get(tracker clienttesting.ObjectTracker, action clienttesting.Action, name string) (*unstructured.Unstructured, error) {
+	obj, err := tracker.Get(action.GetResource(), action.GetNamespace(), name)
+	if err != nil {
+		return nil, err
+	}
+	res, ok := obj.(*unstructured.Unstructured)
+	if !ok {
+		return nil, fmt.Errorf("unexpected object type %T", obj)
+	}
+	return res, nil
+}
+
+// setStatus replaces the status of dst with the one of src.
+func setStatus(dst, src *unstructured.Unstructured) {
+	status, ok := src.Object["status"]
+	if !ok {
+		delete(dst.Object, "status")
+		return
+	}
+	dst.Object["status"] = runtime.DeepCopyJSONValue(status)
+}
+
+func nextVersion(rv string) string {
+	n, _ := strconv.Atoi(rv)
+	return strconv.Itoa(n + 1)
+}
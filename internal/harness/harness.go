@@ -0,0 +1,355 @@
+// Package harness runs the controller against a fake cluster, to test
+// the whole AddFunc → worker → handler → status flow offline.
+//
+// An Env holds a fake dynamic client seeded with the CRD and the objects
+// of the test, writing as the API server does, and a fake discovery
+// knowing their kinds. The external
+// side is faked by a Recorder, an OpenAPIServer (REST backend) or a
+// FakeHelm (helm backend).
+package harness
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/shortid"
+	"github.com/rs/zerolog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	fakediscovery "k8s.io/client-go/discovery/fake"
+	"k8s.io/client-go/dynamic/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+)
+
+const (
+	// Namespace is the namespace of the objects built by the Env.
+	Namespace = "default"
+
+	defaultTimeout = 10 * time.Second
+	pollInterval   = 10 * time.Millisecond
+)
+
+var crdGVR = schema.GroupVersionResource{
+	Group:    "apiextensions.k8s.io",
+	Version:  "v1",
+	Resource: "customresourcedefinitions",
+}
+
+// Kind is a resource known to the fake cluster.
+type Kind struct {
+	GVR  schema.GroupVersionResource
+	Kind string
+	// ClusterScoped is true for the resources without namespace.
+	ClusterScoped bool
+}
+
+// Options are the Env settings.
+type Options struct {
+	// Watched is the resource handled by the controller;
+	// its CRD is added to the fake cluster.
+	Watched Kind
+	// Kinds are the other resources known to the fake cluster
+	// (e.g. the ones rendered by a helm chart).
+	Kinds []Kind
+	// Objects are the initial objects of the fake cluster.
+	Objects []runtime.Object
+	// Timeout bounds the waits. Defaults to 10s.
+	Timeout time.Duration
+}
+
+// Env is a fake cluster running a controller.
+type Env struct {
+	Dynamic   *fake.FakeDynamicClient
+	Discovery *fakediscovery.FakeDiscovery
+	Recorder  *record.FakeRecorder
+
+	t       testing.TB
+	watched Kind
+	timeout time.Duration
+}
+
+// New returns an Env for the options. The controllers started
+// by the Env are stopped when the test ends.
+func New(t testing.TB, opts Options) *Env {
+	t.Helper()
+
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultTimeout
+	}
+
+	kinds := append([]Kind{opts.Watched}, opts.Kinds...)
+	listKinds := map[schema.GroupVersionResource]string{
+		crdGVR: "CustomResourceDefinitionList",
+	}
+	for _, el := range kinds {
+		listKinds[el.GVR] = el.Kind + "List"
+	}
+
+	objs := append([]runtime.Object{CRD(opts.Watched)}, opts.Objects...)
+	dyn := fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), listKinds, objs...)
+	withAPIServerSemantics(dyn)
+
+	return &Env{
+		Dynamic: dyn,
+		Discovery: &fakediscovery.FakeDiscovery{
+			Fake: &clienttesting.Fake{Resources: apiResources(kinds)},
+		},
+		Recorder: record.NewFakeRecorder(1024),
+		t:        t,
+		watched:  opts.Watched,
+		timeout:  opts.Timeout,
+	}
+}
+
+// Start runs a controller watching the Env resource. The zero fields of
+// the options are set to the Env clients, a no-op logger and short
+// retry delays.
+func (e *Env) Start(opts controller.Options) *controller.Controller {
+	e.t.Helper()
+
+	if opts.Client == nil {
+		opts.Client = e.Dynamic
+	}
+	if opts.GVR.Empty() {
+		opts.GVR = e.watched.GVR
+	}
+	if opts.Recorder == nil {
+		opts.Recorder = e.Recorder
+	}
+	if opts.Logger == nil {
+		log := zerolog.Nop()
+		opts.Logger = &log
+	}
+	if opts.Retry.BaseDelay <= 0 {
+		opts.Retry.BaseDelay = 10 * time.Millisecond
+	}
+	if opts.Retry.MaxDelay <= 0 {
+		opts.Retry.MaxDelay = 100 * time.Millisecond
+	}
+	if opts.Retry.PollInterval <= 0 {
+		opts.Retry.PollInterval = 20 * time.Millisecond
+	}
+
+	sid, err := shortid.New(1, shortid.DefaultABC, 2342)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+
+	ctrl := controller.New(sid, opts)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ctrl.Run(ctx, 2)
+	}()
+	e.t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	return ctrl
+}
+
+// NewObject returns an object of the watched resource.
+func (e *Env) NewObject(name string, spec map[string]interface{}) *unstructured.Unstructured {
+	res := &unstructured.Unstructured{}
+	res.SetAPIVersion(e.watched.GVR.GroupVersion().String())
+	res.SetKind(e.watched.Kind)
+	res.SetName(name)
+	res.SetNamespace(Namespace)
+	if spec != nil {
+		res.Object["spec"] = spec
+	}
+	return res
+}
+
+// Create adds the object of the watched resource to the fake cluster.
+func (e *Env) Create(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	e.t.Helper()
+
+	res, err := e.Dynamic.Resource(e.watched.GVR).Namespace(obj.GetNamespace()).
+		Create(context.Background(), obj, metav1.CreateOptions{})
+	if err != nil {
+		e.t.Fatalf("creating %s: %v", obj.GetName(), err)
+	}
+	return res
+}
+
+// Get returns the object of the watched resource, or nil if missing.
+func (e *Env) Get(name string) *unstructured.Unstructured {
+	res, err := e.Dynamic.Resource(e.watched.GVR).Namespace(Namespace).
+		Get(context.Background(), name, metav1.GetOptions{})
+	if err != nil {
+		return nil
+	}
+	return res
+}
+
+// Update changes the object of the watched resource with fn,
+// retrying on conflicts with the controller writes.
+func (e *Env) Update(name string, fn func(el *unstructured.Unstructured)) {
+	e.t.Helper()
+	e.update(name, fn, false)
+}
+
+// UpdateStatus is Update for the status subresource.
+func (e *Env) UpdateStatus(name string, fn func(el *unstructured.Unstructured)) {
+	e.t.Helper()
+	e.update(name, fn, true)
+}
+
+func (e *Env) update(name string, fn func(el *unstructured.Unstructured), status bool) {
+	e.t.Helper()
+
+	cli := e.Dynamic.Resource(e.watched.GVR).Namespace(Namespace)
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		el, err := cli.Get(context.Background(), name, metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		fn(el)
+
+		if status {
+			_, err = cli.UpdateStatus(context.Background(), el, metav1.UpdateOptions{})
+		} else {
+			_, err = cli.Update(context.Background(), el, metav1.UpdateOptions{})
+		}
+		return err
+	})
+	if err != nil {
+		e.t.Fatalf("updating %s: %v", name, err)
+	}
+}
+
+// Delete deletes the object of the watched resource; as on the API
+// server, it is only marked deleted while it has finalizers.
+func (e *Env) Delete(name string) {
+	e.t.Helper()
+
+	err := e.Dynamic.Resource(e.watched.GVR).Namespace(Namespace).
+		Delete(context.Background(), name, metav1.DeleteOptions{})
+	if err != nil {
+		e.t.Fatalf("deleting %s: %v", name, err)
+	}
+}
+
+// Gone waits until the object of the watched resource is removed;
+// the test fails on timeout.
+func (e *Env) Gone(name string) {
+	e.t.Helper()
+
+	e.Wait("removal of "+name, func() bool {
+		return e.Get(name) == nil
+	})
+}
+
+// Eventually waits until cond holds for the object of the watched
+// resource and returns it; the test fails on timeout.
+func (e *Env) Eventually(name string, cond func(el *unstructured.Unstructured) bool) *unstructured.Unstructured {
+	e.t.Helper()
+
+	var res *unstructured.Unstructured
+	e.Wait("object "+name, func() bool {
+		res = e.Get(name)
+		return res != nil && cond(res)
+	})
+	return res
+}
+
+// Wait waits until cond holds; the test fails on timeout.
+func (e *Env) Wait(what string, cond func() bool) {
+	e.t.Helper()
+
+	deadline := time.Now().Add(e.timeout)
+	for !cond() {
+		if time.Now().After(deadline) {
+			e.t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(pollInterval)
+	}
+}
+
+// CRD returns the definition of the custom resource,
+// served and stored in its single version.
+func CRD(k Kind) *unstructured.Unstructured {
+	scope := "Namespaced"
+	if k.ClusterScoped {
+		scope = "Cluster"
+	}
+
+	res := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"spec": map[string]interface{}{
+				"group": k.GVR.Group,
+				"scope": scope,
+				"names": map[string]interface{}{
+					"kind":     k.Kind,
+					"listKind": k.Kind + "List",
+					"plural":   k.GVR.Resource,
+					"singular": strings.ToLower(k.Kind),
+				},
+				"versions": []interface{}{
+					map[string]interface{}{
+						"name":    k.GVR.Version,
+						"served":  true,
+						"storage": true,
+						"subresources": map[string]interface{}{
+							"status": map[string]interface{}{},
+						},
+						"schema": map[string]interface{}{
+							"openAPIV3Schema": map[string]interface{}{
+								"type":                                 "object",
+								"x-kubernetes-preserve-unknown-fields": true,
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+	res.SetAPIVersion(crdGVR.GroupVersion().String())
+	res.SetKind("CustomResourceDefinition")
+	res.SetName(k.GVR.Resource + "." + k.GVR.Group)
+	return res
+}
+
+// apiResources returns the discovery documents of the kinds.
+func apiResources(kinds []Kind) []*metav1.APIResourceList {
+	verbs := metav1.Verbs{"create", "delete", "get", "list", "patch", "update", "watch"}
+
+	byGroupVersion := map[string]*metav1.APIResourceList{}
+	res := []*metav1.APIResourceList{}
+	for _, el := range kinds {
+		gv := el.GVR.GroupVersion().String()
+		list, ok := byGroupVersion[gv]
+		if !ok {
+			list = &metav1.APIResourceList{GroupVersion: gv}
+			byGroupVersion[gv] = list
+			res = append(res, list)
+		}
+
+		list.APIResources = append(list.APIResources,
+			metav1.APIResource{
+				Name:       el.GVR.Resource,
+				Kind:       el.Kind,
+				Namespaced: !el.ClusterScoped,
+				Verbs:      verbs,
+			},
+			metav1.APIResource{
+				Name:       el.GVR.Resource + "/status",
+				Kind:       el.Kind,
+				Namespaced: !el.ClusterScoped,
+				Verbs:      metav1.Verbs{"get", "patch", "update"},
+			},
+		)
+	}
+	return res
+}
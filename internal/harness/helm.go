@@ -0,0 +1,122 @@
+package harness
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/helmclient"
+	mockhelmclient "github.com/krateoplatformops/composition-dynamic-controller/internal/client/helmclient/mock"
+	"helm.sh/helm/v3/pkg/release"
+)
+
+// FakeHelm is a helm client built on the gomock MockClient, keeping
+// the releases in memory. The expectations of the methods it does not
+// fake can be set on the mock.
+type FakeHelm struct {
+	*mockhelmclient.MockClient
+
+	mu       sync.Mutex
+	releases map[string]*release.Release
+	manifest string
+	specs    []helmclient.ChartSpec
+}
+
+// NewFakeHelm returns a FakeHelm rendering the manifest (a multi
+// document YAML) for every chart.
+func NewFakeHelm(t testing.TB, manifest string) *FakeHelm {
+	h := &FakeHelm{
+		MockClient: mockhelmclient.NewMockClient(gomock.NewController(t)),
+		releases:   map[string]*release.Release{},
+		manifest:   manifest,
+	}
+
+	rec := h.EXPECT()
+	rec.SetDebugLog(gomock.Any()).AnyTimes()
+	rec.ListDeployedReleases().DoAndReturn(h.list).AnyTimes()
+	rec.InstallOrUpgradeChart(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(h.install).AnyTimes()
+	rec.UpgradeChart(gomock.Any(), gomock.Any(), gomock.Any()).DoAndReturn(h.upgrade).AnyTimes()
+	rec.UninstallRelease(gomock.Any()).DoAndReturn(h.uninstall).AnyTimes()
+	rec.TemplateChart(gomock.Any(), gomock.Any()).DoAndReturn(h.template).AnyTimes()
+
+	return h
+}
+
+// Factory returns a helm client factory always returning h.
+func (h *FakeHelm) Factory() func(*helmclient.Options) (helmclient.Client, error) {
+	return func(*helmclient.Options) (helmclient.Client, error) {
+		return h, nil
+	}
+}
+
+// Release returns the deployed release, or nil if missing.
+func (h *FakeHelm) Release(name string) *release.Release {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.releases[name]
+}
+
+// Specs returns the chart specs received by the install, upgrade and
+// uninstall calls, in order.
+func (h *FakeHelm) Specs() []helmclient.ChartSpec {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return append([]helmclient.ChartSpec{}, h.specs...)
+}
+
+func (h *FakeHelm) list() ([]*release.Release, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	names := make([]string, 0, len(h.releases))
+	for name := range h.releases {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	res := make([]*release.Release, 0, len(names))
+	for _, name := range names {
+		res = append(res, h.releases[name])
+	}
+	return res, nil
+}
+
+func (h *FakeHelm) install(_ context.Context, spec *helmclient.ChartSpec, _ *helmclient.GenericHelmOptions) (*release.Release, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.specs = append(h.specs, *spec)
+
+	version := 1
+	if prev, ok := h.releases[spec.ReleaseName]; ok {
+		version = prev.Version + 1
+	}
+	rel := &release.Release{
+		Name:      spec.ReleaseName,
+		Namespace: spec.Namespace,
+		Version:   version,
+		Manifest:  h.manifest,
+		Info:      &release.Info{Status: release.StatusDeployed},
+	}
+	h.releases[spec.ReleaseName] = rel
+	return rel, nil
+}
+
+func (h *FakeHelm) upgrade(ctx context.Context, spec *helmclient.ChartSpec, opts *helmclient.GenericHelmOptions) (*release.Release, error) {
+	return h.install(ctx, spec, opts)
+}
+
+func (h *FakeHelm) uninstall(spec *helmclient.ChartSpec) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.specs = append(h.specs, *spec)
+	delete(h.releases, spec.ReleaseName)
+	return nil
+}
+
+func (h *FakeHelm) template(*helmclient.ChartSpec, *helmclient.HelmTemplateOptions) ([]byte, error) {
+	return []byte(h.manifest), nil
+}
@@ -0,0 +1,273 @@
+package harness
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	getter "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/restclient"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// openAPIDoc describes the API served by the OpenAPIServer; the %s
+// verb is replaced by the server url.
+const openAPIDoc = `openapi: 3.0.0
+info:
+  title: harness
+  version: "1.0"
+servers:
+  - url: %s
+paths:
+  /resources:
+    get:
+      parameters:
+        - name: name
+          in: query
+          schema:
+            type: string
+      responses:
+        "200":
+          description: The resources.
+    post:
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/Resource"
+      responses:
+        "201":
+          description: The created resource.
+  /resources/{id}:
+    get:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        "200":
+          description: The resource.
+    patch:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      requestBody:
+        content:
+          application/json:
+            schema:
+              $ref: "#/components/schemas/Resource"
+      responses:
+        "200":
+          description: The updated resource.
+    delete:
+      parameters:
+        - name: id
+          in: path
+          required: true
+          schema:
+            type: string
+      responses:
+        "200":
+          description: The resource was deleted.
+components:
+  schemas:
+    Resource:
+      type: object
+      properties:
+        name:
+          type: string
+        value:
+          type: string
+`
+
+// OpenAPIServer is an http server exposing an OpenAPI document and an
+// in memory implementation of it: the resources have a name and a
+// value, and are identified by an id assigned on creation.
+type OpenAPIServer struct {
+	*httptest.Server
+
+	mu          sync.Mutex
+	items       map[string]map[string]interface{}
+	lastID      int
+	requests    []string
+	deleteError int
+}
+
+// NewOpenAPIServer returns a started OpenAPIServer, closed when
+// the test ends.
+func NewOpenAPIServer(t testing.TB) *OpenAPIServer {
+	s := &OpenAPIServer{
+		items: map[string]map[string]interface{}{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+// DocURL returns the url of the OpenAPI document.
+func (s *OpenAPIServer) DocURL() string {
+	return s.URL + "/openapi.yaml"
+}
+
+// Info returns the REST client info binding the kind to the API.
+func (s *OpenAPIServer) Info(kind string) *getter.Info {
+	return &getter.Info{
+		URL: s.DocURL(),
+		Resource: getter.Resource{
+			Kind:        kind,
+			Identifiers: []string{"id"},
+			VerbsDescription: []getter.VerbsDescription{
+				{Action: "create", Method: "POST", Path: "/resources"},
+				{Action: "findby", Method: "GET", Path: "/resources"},
+				{Action: "get", Method: "GET", Path: "/resources/{id}"},
+				{Action: "update", Method: "PATCH", Path: "/resources/{id}"},
+				{Action: "delete", Method: "DELETE", Path: "/resources/{id}"},
+			},
+		},
+	}
+}
+
+// Getter returns a getter always returning the Info of the kind.
+func (s *OpenAPIServer) Getter(kind string) getter.Getter {
+	return staticInfo{info: s.Info(kind)}
+}
+
+// Items returns the stored resources, sorted by id.
+func (s *OpenAPIServer) Items() []map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	ids := make([]string, 0, len(s.items))
+	for id := range s.items {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	res := make([]map[string]interface{}, 0, len(ids))
+	for _, id := range ids {
+		res = append(res, copyItem(s.items[id]))
+	}
+	return res
+}
+
+// FailDeletes makes the deletes fail with the status code,
+// until called with zero.
+func (s *OpenAPIServer) FailDeletes(code int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.deleteError = code
+}
+
+// Requests returns the received API requests as "METHOD path".
+func (s *OpenAPIServer) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *OpenAPIServer) serve(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/openapi.yaml" {
+		w.Header().Set("Content-Type", "application/yaml")
+		fmt.Fprintf(w, openAPIDoc, s.URL)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.requests = append(s.requests, r.Method+" "+r.URL.Path)
+
+	id, isItem := strings.CutPrefix(r.URL.Path, "/resources/")
+	switch {
+	case r.URL.Path == "/resources" && r.Method == http.MethodGet:
+		all := []interface{}{}
+		for _, el := range s.items {
+			all = append(all, copyItem(el))
+		}
+		writeJSON(w, http.StatusOK, map[string]interface{}{"items": all})
+
+	case r.URL.Path == "/resources" && r.Method == http.MethodPost:
+		el := map[string]interface{}{}
+		if err := json.NewDecoder(r.Body).Decode(&el); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		s.lastID++
+		el["id"] = fmt.Sprintf("%d", s.lastID)
+		s.items[el["id"].(string)] = el
+		writeJSON(w, http.StatusCreated, el)
+
+	case isItem:
+		el, ok := s.items[id]
+		if !ok {
+			writeError(w, http.StatusNotFound, "resource not found")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, el)
+		case http.MethodPatch:
+			patch := map[string]interface{}{}
+			if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			for k, v := range patch {
+				el[k] = v
+			}
+			el["id"] = id
+			writeJSON(w, http.StatusOK, el)
+		case http.MethodDelete:
+			if s.deleteError != 0 {
+				writeError(w, s.deleteError, "delete failed")
+				return
+			}
+			delete(s.items, id)
+			writeJSON(w, http.StatusOK, map[string]interface{}{})
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+
+	default:
+		writeError(w, http.StatusNotFound, "path not found")
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]interface{}{"message": msg})
+}
+
+func copyItem(el map[string]interface{}) map[string]interface{} {
+	res := make(map[string]interface{}, len(el))
+	for k, v := range el {
+		res[k] = v
+	}
+	return res
+}
+
+var _ getter.Getter = staticInfo{}
+
+type staticInfo struct {
+	info *getter.Info
+}
+
+func (g staticInfo) Get(*unstructured.Unstructured) (*getter.Info, error) {
+	res := *g.info
+	return &res, nil
+}
@@ -0,0 +1,123 @@
+package harness
+
+import (
+	"context"
+	"sync"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+var _ controller.ExternalClient = (*Recorder)(nil)
+
+// Call is an operation received by a Recorder.
+type Call struct {
+	Op        controller.EventType
+	Namespace string
+	Name      string
+}
+
+// Recorder is an ExternalClient recording its calls and keeping track
+// of the external resources: Create makes one exist, Delete removes it.
+type Recorder struct {
+	mu       sync.Mutex
+	calls    []Call
+	existing map[string]bool
+	errs     map[controller.EventType]error
+}
+
+// NewRecorder returns a Recorder without external resources.
+func NewRecorder() *Recorder {
+	return &Recorder{
+		existing: map[string]bool{},
+		errs:     map[controller.EventType]error{},
+	}
+}
+
+// Fail makes the operation return err (nil restores it).
+func (r *Recorder) Fail(op controller.EventType, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.errs[op] = err
+}
+
+// Calls returns the received calls, in order.
+func (r *Recorder) Calls() []Call {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]Call{}, r.calls...)
+}
+
+// Count returns the number of calls of the operation.
+func (r *Recorder) Count(op controller.EventType) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := 0
+	for _, el := range r.calls {
+		if el.Op == op {
+			res++
+		}
+	}
+	return res
+}
+
+// Exists returns true if the external resource of the object exists.
+func (r *Recorder) Exists(namespace, name string) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.existing[namespace+"/"+name]
+}
+
+func (r *Recorder) Observe(_ context.Context, mg *unstructured.Unstructured) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.record(controller.Observe, mg); err != nil {
+		return false, err
+	}
+	return r.existing[keyOf(mg)], nil
+}
+
+func (r *Recorder) Create(_ context.Context, mg *unstructured.Unstructured) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.record(controller.Create, mg); err != nil {
+		return err
+	}
+	r.existing[keyOf(mg)] = true
+	return nil
+}
+
+func (r *Recorder) Update(_ context.Context, mg *unstructured.Unstructured) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.record(controller.Update, mg)
+}
+
+func (r *Recorder) Delete(_ context.Context, mg *unstructured.Unstructured) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.record(controller.Delete, mg); err != nil {
+		return err
+	}
+	delete(r.existing, keyOf(mg))
+	return nil
+}
+
+// record appends the call and returns the error of the operation.
+func (r *Recorder) record(op controller.EventType, mg *unstructured.Unstructured) error {
+	r.calls = append(r.calls, Call{
+		Op:        op,
+		Namespace: mg.GetNamespace(),
+		Name:      mg.GetName(),
+	})
+	return r.errs[op]
+}
+
+func keyOf(mg *unstructured.Unstructured) string {
+	return mg.GetNamespace() + "/" + mg.GetName()
+}
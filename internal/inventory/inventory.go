@@ -0,0 +1,208 @@
+// Package inventory records the last known state of the managed objects
+// in ConfigMaps, so that their external resources can still be found after
+// the objects have been deleted while the controller was not running.
+package inventory
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"sync"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+)
+
+const (
+	LabelKeyGroup    = "inventory.krateo.io/group"
+	LabelKeyResource = "inventory.krateo.io/resource"
+	LabelKeyName     = "inventory.krateo.io/name"
+
+	keyObject = "object"
+)
+
+var gvrForConfigMaps = schema.GroupVersionResource{
+	Version:  "v1",
+	Resource: "configmaps",
+}
+
+type Options struct {
+	Client dynamic.Interface
+	// Prefix of the ConfigMaps name (defaults to "composition-inventory").
+	Prefix string
+}
+
+// Inventory stores one ConfigMap per object, in the object namespace.
+// Only the fields needed to delete the external resource are kept:
+// metadata name, namespace, labels and annotations, the spec and the
+// status without the conditions.
+type Inventory struct {
+	client dynamic.Interface
+	prefix string
+
+	mu      sync.Mutex
+	written map[string]string
+}
+
+func New(opts Options) *Inventory {
+	if len(opts.Prefix) == 0 {
+		opts.Prefix = "composition-inventory"
+	}
+
+	return &Inventory{
+		client:  opts.Client,
+		prefix:  opts.Prefix,
+		written: map[string]string{},
+	}
+}
+
+// Record stores the state of the object, writing only if it changed.
+func (i *Inventory) Record(ctx context.Context, gvr schema.GroupVersionResource, obj *unstructured.Unstructured) error {
+	dat, err := json.Marshal(trim(obj).Object)
+	if err != nil {
+		return err
+	}
+
+	name := i.configMapName(gvr, obj.GetName())
+	key := obj.GetNamespace() + "/" + name
+
+	i.mu.Lock()
+	last, ok := i.written[key]
+	i.mu.Unlock()
+	if ok && last == string(dat) {
+		return nil
+	}
+
+	cli := i.client.Resource(gvrForConfigMaps).Namespace(obj.GetNamespace())
+
+	cm, err := cli.Get(ctx, name, metav1.GetOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+	if apierrors.IsNotFound(err) {
+		cm = &unstructured.Unstructured{}
+		cm.SetAPIVersion("v1")
+		cm.SetKind("ConfigMap")
+		cm.SetName(name)
+		cm.SetNamespace(obj.GetNamespace())
+		cm.SetLabels(map[string]string{
+			LabelKeyGroup:    gvr.Group,
+			LabelKeyResource: gvr.Resource,
+			LabelKeyName:     labelValue(obj.GetName()),
+		})
+		if err := unstructured.SetNestedField(cm.Object, string(dat), "data", keyObject); err != nil {
+			return err
+		}
+		_, err = cli.Create(ctx, cm, metav1.CreateOptions{})
+	} else {
+		cur, _, _ := unstructured.NestedString(cm.Object, "data", keyObject)
+		if cur != string(dat) {
+			if err := unstructured.SetNestedField(cm.Object, string(dat), "data", keyObject); err != nil {
+				return err
+			}
+			_, err = cli.Update(ctx, cm, metav1.UpdateOptions{})
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	i.written[key] = string(dat)
+	i.mu.Unlock()
+
+	return nil
+}
+
+// Forget removes the record of the object, if any.
+func (i *Inventory) Forget(ctx context.Context, gvr schema.GroupVersionResource, namespace, name string) error {
+	cmName := i.configMapName(gvr, name)
+
+	err := i.client.Resource(gvrForConfigMaps).Namespace(namespace).
+		Delete(ctx, cmName, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	i.mu.Lock()
+	delete(i.written, namespace+"/"+cmName)
+	i.mu.Unlock()
+
+	return nil
+}
+
+// List returns the recorded objects of the resource in the
+// specified namespace (empty means all namespaces).
+func (i *Inventory) List(ctx context.Context, gvr schema.GroupVersionResource, namespace string) ([]*unstructured.Unstructured, error) {
+	sel := labels.SelectorFromSet(labels.Set{
+		LabelKeyGroup:    gvr.Group,
+		LabelKeyResource: gvr.Resource,
+	})
+
+	all, err := i.client.Resource(gvrForConfigMaps).Namespace(namespace).
+		List(ctx, metav1.ListOptions{LabelSelector: sel.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*unstructured.Unstructured, 0, len(all.Items))
+	for _, cm := range all.Items {
+		dat, _, _ := unstructured.NestedString(cm.Object, "data", keyObject)
+		if len(dat) == 0 {
+			continue
+		}
+
+		obj := &unstructured.Unstructured{}
+		if err := json.Unmarshal([]byte(dat), &obj.Object); err != nil {
+			return nil, fmt.Errorf("decoding inventory record %s/%s: %w", cm.GetNamespace(), cm.GetName(), err)
+		}
+		res = append(res, obj)
+	}
+
+	return res, nil
+}
+
+func (i *Inventory) configMapName(gvr schema.GroupVersionResource, name string) string {
+	h := fnv.New32a()
+	h.Write([]byte(gvr.GroupResource().String() + "/" + name))
+	return fmt.Sprintf("%s-%08x", i.prefix, h.Sum32())
+}
+
+// trim returns a copy of the object with only the recorded fields.
+func trim(obj *unstructured.Unstructured) *unstructured.Unstructured {
+	res := &unstructured.Unstructured{Object: map[string]interface{}{}}
+	res.SetAPIVersion(obj.GetAPIVersion())
+	res.SetKind(obj.GetKind())
+	res.SetName(obj.GetName())
+	res.SetNamespace(obj.GetNamespace())
+	res.SetLabels(obj.GetLabels())
+	res.SetAnnotations(obj.GetAnnotations())
+
+	if spec, ok, _ := unstructured.NestedFieldCopy(obj.Object, "spec"); ok {
+		res.Object["spec"] = spec
+	}
+	if status, ok, _ := unstructured.NestedMap(obj.Object, "status"); ok {
+		delete(status, "conditions")
+		if len(status) > 0 {
+			res.Object["status"] = status
+		}
+	}
+
+	return res
+}
+
+// labelValue returns name if it is a valid label value,
+// its hash otherwise (names can be longer than 63 characters).
+func labelValue(name string) string {
+	if len(name) <= 63 {
+		return name
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	return fmt.Sprintf("%08x", h.Sum32())
+}
@@ -0,0 +1,108 @@
+package inventory
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+var gvr = schema.GroupVersionResource{Group: "github.krateo.io", Version: "v1alpha1", Resource: "repoes"}
+
+func newTestObject(name string) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "github.krateo.io/v1alpha1",
+		"kind":       "Repo",
+		"metadata": map[string]interface{}{
+			"name":      name,
+			"namespace": "default",
+			"uid":       "1234",
+		},
+		"spec": map[string]interface{}{"org": "krateoplatformops"},
+		"status": map[string]interface{}{
+			"id":         "42",
+			"conditions": []interface{}{map[string]interface{}{"type": "Ready"}},
+		},
+	}}
+}
+
+func newTestClient() *fake.FakeDynamicClient {
+	return fake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(),
+		map[schema.GroupVersionResource]string{gvrForConfigMaps: "ConfigMapList"})
+}
+
+func TestRecordAndList(t *testing.T) {
+	ctx := context.TODO()
+	cli := newTestClient()
+	inv := New(Options{Client: cli})
+
+	assert.Nil(t, inv.Record(ctx, gvr, newTestObject("a")))
+	assert.Nil(t, inv.Record(ctx, gvr, newTestObject("b")))
+
+	all, err := inv.List(ctx, gvr, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 2, len(all))
+
+	for _, el := range all {
+		assert.Equal(t, "Repo", el.GetKind())
+		assert.Empty(t, el.GetUID())
+		id, _, _ := unstructured.NestedString(el.Object, "status", "id")
+		assert.Equal(t, "42", id)
+		_, ok, _ := unstructured.NestedSlice(el.Object, "status", "conditions")
+		assert.False(t, ok)
+	}
+
+	other, err := inv.List(ctx, schema.GroupVersionResource{Group: "g", Version: "v1", Resource: "others"}, "")
+	assert.Nil(t, err)
+	assert.Empty(t, other)
+}
+
+func TestRecordWritesOnlyChanges(t *testing.T) {
+	ctx := context.TODO()
+	cli := newTestClient()
+	inv := New(Options{Client: cli})
+
+	obj := newTestObject("a")
+	assert.Nil(t, inv.Record(ctx, gvr, obj))
+	cli.ClearActions()
+
+	// Conditions are not recorded.
+	unstructured.SetNestedSlice(obj.Object, []interface{}{}, "status", "conditions")
+	assert.Nil(t, inv.Record(ctx, gvr, obj))
+	assert.Empty(t, cli.Actions())
+
+	unstructured.SetNestedField(obj.Object, "43", "status", "id")
+	assert.Nil(t, inv.Record(ctx, gvr, obj))
+	assert.True(t, hasAction(cli.Actions(), "update"))
+}
+
+func TestForget(t *testing.T) {
+	ctx := context.TODO()
+	cli := newTestClient()
+	inv := New(Options{Client: cli})
+
+	assert.Nil(t, inv.Record(ctx, gvr, newTestObject("a")))
+	assert.Nil(t, inv.Forget(ctx, gvr, "default", "a"))
+	// Forgetting twice is fine.
+	assert.Nil(t, inv.Forget(ctx, gvr, "default", "a"))
+
+	all, err := inv.List(ctx, gvr, "default")
+	assert.Nil(t, err)
+	assert.Empty(t, all)
+}
+
+func hasAction(all []k8stesting.Action, verb string) bool {
+	for _, el := range all {
+		if el.GetVerb() == verb {
+			return true
+		}
+	}
+	return false
+}
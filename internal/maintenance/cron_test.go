@@ -0,0 +1,55 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleNext(t *testing.T) {
+	// A saturday.
+	from := time.Date(2024, time.March, 2, 10, 30, 15, 0, time.UTC)
+
+	table := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2024, time.March, 2, 10, 31, 0, 0, time.UTC)},
+		{"0 22 * * *", time.Date(2024, time.March, 2, 22, 0, 0, 0, time.UTC)},
+		{"0 22 * * mon-fri", time.Date(2024, time.March, 4, 22, 0, 0, 0, time.UTC)},
+		{"*/20 10 * * *", time.Date(2024, time.March, 2, 10, 40, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 feb *", time.Date(2028, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 3 * * 7", time.Date(2024, time.March, 3, 3, 0, 0, 0, time.UTC)},
+		// Either day field matches when both are restricted.
+		{"0 0 15 * sun", time.Date(2024, time.March, 3, 0, 0, 0, 0, time.UTC)},
+		{"15,45 9-11 * * *", time.Date(2024, time.March, 2, 10, 45, 0, 0, time.UTC)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+
+	for _, tc := range table {
+		t.Run(tc.expr, func(t *testing.T) {
+			s, err := ParseSchedule(tc.expr)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.want, s.Next(from))
+			}
+		})
+	}
+}
+
+func TestParseScheduleErrors(t *testing.T) {
+	for _, expr := range []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * foo *",
+		"5-1 * * * *",
+		"*/0 * * * *",
+	} {
+		_, err := ParseSchedule(expr)
+		assert.Error(t, err, expr)
+	}
+}
@@ -0,0 +1,82 @@
+package maintenance
+
+import (
+	"fmt"
+	"time"
+)
+
+// Spec is the definition of a maintenance window: it opens at every
+// time matching Schedule and stays open for Duration.
+type Spec struct {
+	// Schedule is a cron expression (empty means no window, i.e. always open).
+	Schedule string
+	// Duration is how long the window stays open.
+	Duration time.Duration
+	// Timezone is the IANA name of the location the schedule is
+	// evaluated in (defaults to UTC).
+	Timezone string
+	// GateCreate makes the creations wait for the window too.
+	GateCreate bool
+}
+
+// A Window tells when the mutating operations are allowed.
+// A nil Window is always open.
+type Window struct {
+	schedule   *Schedule
+	duration   time.Duration
+	location   *time.Location
+	gateCreate bool
+}
+
+// New compiles the spec; it returns nil if the spec has no schedule.
+func New(spec Spec) (*Window, error) {
+	if len(spec.Schedule) == 0 {
+		return nil, nil
+	}
+
+	schedule, err := ParseSchedule(spec.Schedule)
+	if err != nil {
+		return nil, err
+	}
+	if spec.Duration <= 0 {
+		return nil, fmt.Errorf("maintenance window duration must be positive")
+	}
+	loc := time.UTC
+	if len(spec.Timezone) > 0 {
+		loc, err = time.LoadLocation(spec.Timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window timezone: %w", err)
+		}
+	}
+
+	return &Window{
+		schedule:   schedule,
+		duration:   spec.Duration,
+		location:   loc,
+		gateCreate: spec.GateCreate,
+	}, nil
+}
+
+// GatesCreate returns true if the creations wait for the window too.
+func (w *Window) GatesCreate() bool {
+	return w != nil && w.gateCreate
+}
+
+// Open returns true if the window is open at t.
+func (w *Window) Open(t time.Time) bool {
+	if w == nil {
+		return true
+	}
+	// Opened by a match in (t-duration, t].
+	start := w.schedule.Next(t.In(w.location).Add(-w.duration))
+	return !start.IsZero() && !start.After(t)
+}
+
+// NextOpen returns t if the window is open at t, otherwise the time
+// it opens next (the zero time if never).
+func (w *Window) NextOpen(t time.Time) time.Time {
+	if w.Open(t) {
+		return t
+	}
+	return w.schedule.Next(t.In(w.location))
+}
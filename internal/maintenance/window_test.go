@@ -0,0 +1,53 @@
+package maintenance
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWindow(t *testing.T) {
+	w, err := New(Spec{
+		Schedule: "0 22 * * mon-fri",
+		Duration: 4 * time.Hour,
+		Timezone: "Europe/Rome",
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	rome, _ := time.LoadLocation("Europe/Rome")
+
+	// Monday 22:00 in Rome is 21:00 UTC.
+	opens := time.Date(2024, time.March, 4, 21, 0, 0, 0, time.UTC)
+
+	assert.False(t, w.Open(opens.Add(-time.Minute)))
+	assert.True(t, w.Open(opens))
+	assert.True(t, w.Open(opens.Add(4*time.Hour-time.Second)))
+	assert.False(t, w.Open(opens.Add(4*time.Hour)))
+
+	assert.Equal(t, opens, w.NextOpen(opens.Add(-time.Hour)).UTC())
+	now := opens.Add(time.Hour)
+	assert.Equal(t, now, w.NextOpen(now))
+	// Saturday: next opening on monday.
+	sat := time.Date(2024, time.March, 9, 12, 0, 0, 0, rome)
+	assert.Equal(t, time.Date(2024, time.March, 11, 22, 0, 0, 0, rome), w.NextOpen(sat))
+
+	assert.False(t, w.GatesCreate())
+}
+
+func TestWindowNil(t *testing.T) {
+	w, err := New(Spec{})
+	assert.NoError(t, err)
+	assert.Nil(t, w)
+	assert.True(t, w.Open(time.Now()))
+	assert.False(t, w.GatesCreate())
+}
+
+func TestWindowErrors(t *testing.T) {
+	_, err := New(Spec{Schedule: "0 22 * * *"})
+	assert.Error(t, err)
+
+	_, err = New(Spec{Schedule: "0 22 * * *", Duration: time.Hour, Timezone: "Nowhere/Else"})
+	assert.Error(t, err)
+}
@@ -2,6 +2,8 @@
 package meta
 
 import (
+	"fmt"
+	"strings"
 	"time"
 
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
@@ -55,6 +57,34 @@ const (
 	// observe: The provider can only observe the resource.
 	//          This maps to the read-only scenario where the resource is fully controlled by third party application.
 	AnnotationKeyManagementPolicy = "krateo.io/management-policy"
+
+	// AnnotationKeyTimeout is the key in the annotations map of a resource
+	// that overrides the deadline of all the external client operations.
+	// Its value must be a duration (e.g. 90s or 5m).
+	AnnotationKeyTimeout = "krateo.io/timeout"
+
+	// AnnotationKeyTimeoutPrefix is the prefix of the keys in the annotations
+	// map of a resource that override the deadline of a single external client
+	// operation (e.g. krateo.io/timeout-delete). They take precedence over
+	// AnnotationKeyTimeout.
+	AnnotationKeyTimeoutPrefix = "krateo.io/timeout-"
+
+	// AnnotationKeyDependsOn is the key in the annotations map of a resource
+	// listing, comma separated, the resources that must be Ready before it is
+	// created or updated (e.g. Widget.v1.composition.krateo.io/other or
+	// ConfigMap.v1/namespace/name).
+	AnnotationKeyDependsOn = "krateo.io/depends-on"
+
+	// AnnotationKeyMaintenanceWindow is the key in the annotations map of a
+	// resource overriding the cron schedule of its maintenance window, out of
+	// which it is not updated nor deleted. The value none disables the window.
+	AnnotationKeyMaintenanceWindow = "krateo.io/maintenance-window"
+
+	// AnnotationKeyMaintenanceWindowPrefix is the prefix of the keys in the
+	// annotations map of a resource overriding the other settings of its
+	// maintenance window: krateo.io/maintenance-window-duration,
+	// krateo.io/maintenance-window-timezone and krateo.io/maintenance-window-create.
+	AnnotationKeyMaintenanceWindowPrefix = "krateo.io/maintenance-window-"
 )
 
 const (
@@ -293,3 +323,25 @@ func IsActionAllowed(o metav1.Object, action string) bool {
 	// ObjectActionDelete
 	return p == ManagementPolicyDefault || p == ManagementPolicyObserveDelete
 }
+
+// GetTimeout returns the deadline of the specified operation (observe, create,
+// update or delete) set by the timeout annotations, or zero if none is set.
+func GetTimeout(o metav1.Object, op string) (time.Duration, error) {
+	a := o.GetAnnotations()
+	val, ok := a[AnnotationKeyTimeoutPrefix+strings.ToLower(op)]
+	if !ok {
+		val, ok = a[AnnotationKeyTimeout]
+	}
+	if !ok {
+		return 0, nil
+	}
+
+	d, err := time.ParseDuration(val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timeout annotation: %w", err)
+	}
+	if d <= 0 {
+		return 0, fmt.Errorf("invalid timeout annotation: %s must be positive", val)
+	}
+	return d, nil
+}
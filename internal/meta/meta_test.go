@@ -817,3 +817,53 @@ func TestFinalizerExists(t *testing.T) {
 		})
 	}
 }
+
+func TestGetTimeout(t *testing.T) {
+	cases := map[string]struct {
+		annotations map[string]string
+		op          string
+		want        time.Duration
+		wantErr     bool
+	}{
+		"NoAnnotations": {
+			op:   "create",
+			want: 0,
+		},
+		"AllOperations": {
+			annotations: map[string]string{AnnotationKeyTimeout: "90s"},
+			op:          "observe",
+			want:        90 * time.Second,
+		},
+		"SingleOperation": {
+			annotations: map[string]string{
+				AnnotationKeyTimeout:                  "90s",
+				AnnotationKeyTimeoutPrefix + "delete": "10m",
+			},
+			op:   "Delete",
+			want: 10 * time.Minute,
+		},
+		"Invalid": {
+			annotations: map[string]string{AnnotationKeyTimeout: "soon"},
+			op:          "update",
+			wantErr:     true,
+		},
+		"NotPositive": {
+			annotations: map[string]string{AnnotationKeyTimeout: "0s"},
+			op:          "update",
+			wantErr:     true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			o := &corev1.Pod{ObjectMeta: metav1.ObjectMeta{Annotations: tc.annotations}}
+			got, err := GetTimeout(o, tc.op)
+			if (err != nil) != tc.wantErr {
+				t.Fatalf("GetTimeout(...): unexpected error: %v", err)
+			}
+			if diff := cmp.Diff(tc.want, got); diff != "" {
+				t.Errorf("GetTimeout(...): -want, +got:\n%s", diff)
+			}
+		})
+	}
+}
@@ -0,0 +1,548 @@
+// Package sharding splits the watched objects across the controller replicas.
+//
+// Every object is assigned to one of a fixed number of shards by hashing
+// its namespace/name. Each shard is claimed by a replica through a
+// coordination.k8s.io Lease; replicas advertise themselves with a member
+// Lease so that every one of them claims at most ceil(shards/members)
+// shards, rebalancing when replicas come or go.
+//
+// A shard is handed over only after the previous holder stopped enqueuing
+// its objects and all the in-flight ones have been processed, or after its
+// lease expired: a replica that fails to renew a shard lease stops processing
+// it before the lease expires, so that an object is never processed twice.
+// Losing a shard cancels the context of its in-flight objects, so that the
+// operations already running stop as well.
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+)
+
+const (
+	labelKeyGroup  = "sharding.krateo.io/group"
+	labelKeyRole   = "sharding.krateo.io/role"
+	labelKeyShard  = "sharding.krateo.io/shard"
+	roleMember     = "member"
+	roleShard      = "shard"
+	defaultLease   = 15 * time.Second
+	defaultRenew   = 10 * time.Second
+	defaultRetry   = 2 * time.Second
+	drainPollDelay = 100 * time.Millisecond
+)
+
+type Options struct {
+	// Client is used to manage the leases.
+	Client kubernetes.Interface
+	// Namespace of the leases.
+	Namespace string
+	// Name is the prefix of the leases name, replicas sharing the
+	// same name and namespace share the same set of shards.
+	Name string
+	// Identity uniquely identifies this replica (i.e. the pod name).
+	Identity string
+	// Shards is the total number of shards.
+	Shards int
+	// LeaseDuration is how long a lease is valid without renewal.
+	LeaseDuration time.Duration
+	// RenewDeadline is how long this replica keeps processing a shard
+	// without a successful renewal. Must be less than LeaseDuration.
+	RenewDeadline time.Duration
+	// RetryPeriod is how often leases are renewed and shards rebalanced.
+	RetryPeriod time.Duration
+	// Logger is used to report shards ownership changes.
+	Logger *zerolog.Logger
+}
+
+type shardState struct {
+	lease     *coordinationv1.Lease
+	renewed   time.Time
+	releasing bool
+	inflight  int
+	// ctx is canceled when the shard is no longer held.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+func newShardState(lease *coordinationv1.Lease, now time.Time) *shardState {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &shardState{lease: lease, renewed: now, ctx: ctx, cancel: cancel}
+}
+
+// Sharder claims shards for this replica and tells which objects it owns.
+type Sharder struct {
+	opts Options
+
+	mu        sync.Mutex
+	owned     map[int]*shardState
+	onAcquire []func()
+}
+
+// New creates a new Sharder.
+func New(opts Options) (*Sharder, error) {
+	if opts.Client == nil {
+		return nil, fmt.Errorf("sharding: kubernetes client must be specified")
+	}
+	if opts.Shards < 1 {
+		return nil, fmt.Errorf("sharding: shards must be greater than zero")
+	}
+	if len(opts.Name) == 0 || len(opts.Identity) == 0 {
+		return nil, fmt.Errorf("sharding: name and identity must be specified")
+	}
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = defaultLease
+	}
+	if opts.RenewDeadline <= 0 {
+		opts.RenewDeadline = defaultRenew
+	}
+	if opts.RetryPeriod <= 0 {
+		opts.RetryPeriod = defaultRetry
+	}
+	if opts.RenewDeadline >= opts.LeaseDuration {
+		return nil, fmt.Errorf("sharding: renew deadline must be less than the lease duration")
+	}
+	if opts.Logger == nil {
+		nop := zerolog.Nop()
+		opts.Logger = &nop
+	}
+
+	return &Sharder{
+		opts:  opts,
+		owned: map[int]*shardState{},
+	}, nil
+}
+
+// ShardFor returns the shard of the object with the specified namespace and name.
+func (s *Sharder) ShardFor(namespace, name string) int {
+	h := fnv.New32a()
+	h.Write([]byte(namespace))
+	h.Write([]byte("/"))
+	h.Write([]byte(name))
+	return int(h.Sum32() % uint32(s.opts.Shards))
+}
+
+// Owns returns true if the object belongs to a shard held by this replica.
+func (s *Sharder) Owns(namespace, name string) bool {
+	shard := s.ShardFor(namespace, name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.owned[shard]
+	return ok && !st.releasing
+}
+
+// Track marks the object as in-flight; the shard is not handed over until
+// the returned done function is called. The returned context is derived
+// from ctx and canceled as soon as the shard is lost or dropped, the object
+// must be processed with it. ok is false if the object does not belong to
+// a shard held by this replica.
+func (s *Sharder) Track(ctx context.Context, namespace, name string) (context.Context, func(), bool) {
+	shard := s.ShardFor(namespace, name)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.owned[shard]
+	if !ok || st.releasing {
+		return ctx, func() {}, false
+	}
+	st.inflight++
+
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(st.ctx, cancel)
+
+	var once sync.Once
+	return ctx, func() {
+		once.Do(func() {
+			stop()
+			cancel()
+			s.mu.Lock()
+			st.inflight--
+			s.mu.Unlock()
+		})
+	}, true
+}
+
+// OnAcquire registers a function invoked every time a shard is acquired,
+// so that the objects already known can be enqueued.
+func (s *Sharder) OnAcquire(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onAcquire = append(s.onAcquire, fn)
+}
+
+// Owned returns the sorted list of the shards held by this replica.
+func (s *Sharder) Owned() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]int, 0, len(s.owned))
+	for k, st := range s.owned {
+		if !st.releasing {
+			res = append(res, k)
+		}
+	}
+	sort.Ints(res)
+	return res
+}
+
+// Run claims and renews the shards until the context is done,
+// then releases all the held shards.
+func (s *Sharder) Run(ctx context.Context) {
+	wait.UntilWithContext(ctx, func(ctx context.Context) {
+		if err := s.sync(ctx); err != nil {
+			s.opts.Logger.Warn().Err(err).Msg("Synchronizing shards.")
+		}
+	}, s.opts.RetryPeriod)
+
+	ctx, cancel := context.WithTimeout(context.Background(), s.opts.RenewDeadline)
+	defer cancel()
+	s.releaseAll(ctx)
+}
+
+func (s *Sharder) sync(ctx context.Context) error {
+	now := time.Now()
+
+	if err := s.renewMember(ctx, now); err != nil {
+		return err
+	}
+
+	all, err := s.opts.Client.CoordinationV1().Leases(s.opts.Namespace).
+		List(ctx, metav1.ListOptions{
+			LabelSelector: labels.SelectorFromSet(labels.Set{labelKeyGroup: s.opts.Name}).String(),
+		})
+	if err != nil {
+		return err
+	}
+
+	members := 0
+	shards := map[int]*coordinationv1.Lease{}
+	for i := range all.Items {
+		el := &all.Items[i]
+		switch el.Labels[labelKeyRole] {
+		case roleMember:
+			if !s.expired(el, now) {
+				members++
+			}
+		case roleShard:
+			idx, err := strconv.Atoi(el.Labels[labelKeyShard])
+			if err == nil {
+				shards[idx] = el
+			}
+		}
+	}
+	if members == 0 {
+		members = 1
+	}
+	target := (s.opts.Shards + members - 1) / members
+
+	// Renew the held shards, dropping the ones we failed
+	// to renew within the deadline.
+	for _, idx := range s.heldShards() {
+		if err := s.renewShard(ctx, idx, now); err != nil {
+			s.opts.Logger.Warn().Err(err).Int("shard", idx).Msg("Renewing shard lease.")
+		}
+	}
+	s.dropStale(now)
+
+	// Give away the shards exceeding our fair share.
+	held := s.Owned()
+	for i := len(held) - 1; i >= target; i-- {
+		if st := s.stopEnqueuing(held[i]); st != nil {
+			go s.release(ctx, held[i], st)
+		}
+	}
+
+	// Claim free or expired shards up to our fair share.
+	count := len(s.Owned())
+	for idx := 0; idx < s.opts.Shards && count < target; idx++ {
+		if s.isHeld(idx) {
+			continue
+		}
+		lease, ok := shards[idx]
+		if ok && len(holder(lease)) > 0 && holder(lease) != s.opts.Identity && !s.expired(lease, now) {
+			continue
+		}
+		if err := s.acquire(ctx, idx, lease, now); err != nil {
+			s.opts.Logger.Debug().Err(err).Int("shard", idx).Msg("Acquiring shard lease.")
+			continue
+		}
+		count++
+	}
+
+	return nil
+}
+
+func (s *Sharder) renewMember(ctx context.Context, now time.Time) error {
+	name := fmt.Sprintf("%s-member-%s", s.opts.Name, s.opts.Identity)
+	leases := s.opts.Client.CoordinationV1().Leases(s.opts.Namespace)
+
+	cur, err := leases.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		_, err = leases.Create(ctx, s.newLease(name, map[string]string{
+			labelKeyGroup: s.opts.Name,
+			labelKeyRole:  roleMember,
+		}, now), metav1.CreateOptions{})
+		return err
+	}
+	if err != nil {
+		return err
+	}
+
+	cur.Spec.HolderIdentity = &s.opts.Identity
+	cur.Spec.RenewTime = &metav1.MicroTime{Time: now}
+	_, err = leases.Update(ctx, cur, metav1.UpdateOptions{})
+	return err
+}
+
+func (s *Sharder) acquire(ctx context.Context, idx int, cur *coordinationv1.Lease, now time.Time) error {
+	leases := s.opts.Client.CoordinationV1().Leases(s.opts.Namespace)
+
+	var (
+		res *coordinationv1.Lease
+		err error
+	)
+	if cur == nil {
+		res, err = leases.Create(ctx, s.newLease(s.shardLeaseName(idx), map[string]string{
+			labelKeyGroup: s.opts.Name,
+			labelKeyRole:  roleShard,
+			labelKeyShard: strconv.Itoa(idx),
+		}, now), metav1.CreateOptions{})
+	} else {
+		upd := cur.DeepCopy()
+		transitions := int32(0)
+		if upd.Spec.LeaseTransitions != nil {
+			transitions = *upd.Spec.LeaseTransitions
+		}
+		transitions++
+		upd.Spec.HolderIdentity = &s.opts.Identity
+		upd.Spec.AcquireTime = &metav1.MicroTime{Time: now}
+		upd.Spec.RenewTime = &metav1.MicroTime{Time: now}
+		upd.Spec.LeaseDurationSeconds = s.leaseDurationSeconds()
+		upd.Spec.LeaseTransitions = &transitions
+		// The update fails with a conflict if someone else got it in the meantime.
+		res, err = leases.Update(ctx, upd, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	s.owned[idx] = newShardState(res, now)
+	handlers := append([]func(){}, s.onAcquire...)
+	s.mu.Unlock()
+
+	s.opts.Logger.Info().Int("shard", idx).Str("identity", s.opts.Identity).Msg("Shard acquired.")
+
+	for _, fn := range handlers {
+		fn()
+	}
+
+	return nil
+}
+
+func (s *Sharder) renewShard(ctx context.Context, idx int, now time.Time) error {
+	s.mu.Lock()
+	st, ok := s.owned[idx]
+	if !ok {
+		s.mu.Unlock()
+		return nil
+	}
+	upd := st.lease.DeepCopy()
+	s.mu.Unlock()
+
+	upd.Spec.RenewTime = &metav1.MicroTime{Time: now}
+	res, err := s.opts.Client.CoordinationV1().Leases(s.opts.Namespace).
+		Update(ctx, upd, metav1.UpdateOptions{})
+	if err != nil {
+		if apierrors.IsConflict(err) || apierrors.IsNotFound(err) {
+			// Someone else holds it now: stop processing immediately.
+			s.mu.Lock()
+			if cur, ok := s.owned[idx]; ok {
+				cur.cancel()
+				delete(s.owned, idx)
+			}
+			s.mu.Unlock()
+			s.opts.Logger.Warn().Int("shard", idx).Msg("Shard lost.")
+		}
+		return err
+	}
+
+	s.mu.Lock()
+	if st, ok := s.owned[idx]; ok {
+		st.lease = res
+		st.renewed = now
+	}
+	s.mu.Unlock()
+
+	return nil
+}
+
+// dropStale stops processing the shards not renewed within the deadline,
+// before their lease expires and someone else can take them over.
+func (s *Sharder) dropStale(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for idx, st := range s.owned {
+		if now.Sub(st.renewed) > s.opts.RenewDeadline {
+			st.cancel()
+			delete(s.owned, idx)
+			s.opts.Logger.Warn().Int("shard", idx).Msg("Shard renew deadline exceeded, dropping it.")
+		}
+	}
+}
+
+// stopEnqueuing marks the shard as releasing, so that its objects are
+// no longer owned. It returns nil if the shard is not held or it is
+// already being released.
+func (s *Sharder) stopEnqueuing(idx int) *shardState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	st, ok := s.owned[idx]
+	if !ok || st.releasing {
+		return nil
+	}
+	st.releasing = true
+	return st
+}
+
+// release waits for the in-flight objects of a shard marked as releasing
+// and then frees the lease so that another replica can claim it.
+func (s *Sharder) release(ctx context.Context, idx int, st *shardState) {
+	err := wait.PollUntilContextTimeout(ctx, drainPollDelay, s.opts.RenewDeadline, true,
+		func(context.Context) (bool, error) {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			return st.inflight == 0, nil
+		})
+	if err != nil {
+		// Still busy: keep the shard, we'll try again on next sync.
+		s.mu.Lock()
+		st.releasing = false
+		s.mu.Unlock()
+		return
+	}
+
+	s.mu.Lock()
+	if s.owned[idx] != st {
+		// Lost in the meantime.
+		s.mu.Unlock()
+		return
+	}
+	upd := st.lease.DeepCopy()
+	st.cancel()
+	delete(s.owned, idx)
+	s.mu.Unlock()
+
+	empty := ""
+	upd.Spec.HolderIdentity = &empty
+	_, err = s.opts.Client.CoordinationV1().Leases(s.opts.Namespace).
+		Update(ctx, upd, metav1.UpdateOptions{})
+	if err != nil {
+		// The lease will expire anyway.
+		s.opts.Logger.Warn().Err(err).Int("shard", idx).Msg("Releasing shard lease.")
+		return
+	}
+
+	s.opts.Logger.Info().Int("shard", idx).Str("identity", s.opts.Identity).Msg("Shard released.")
+}
+
+func (s *Sharder) releaseAll(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, idx := range s.heldShards() {
+		st := s.stopEnqueuing(idx)
+		if st == nil {
+			continue
+		}
+		wg.Add(1)
+		go func(idx int) {
+			defer wg.Done()
+			s.release(ctx, idx, st)
+		}(idx)
+	}
+	wg.Wait()
+
+	_ = s.opts.Client.CoordinationV1().Leases(s.opts.Namespace).
+		Delete(ctx, fmt.Sprintf("%s-member-%s", s.opts.Name, s.opts.Identity), metav1.DeleteOptions{})
+}
+
+func (s *Sharder) heldShards() []int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]int, 0, len(s.owned))
+	for k := range s.owned {
+		res = append(res, k)
+	}
+	sort.Ints(res)
+	return res
+}
+
+func (s *Sharder) isHeld(idx int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.owned[idx]
+	return ok
+}
+
+func (s *Sharder) expired(lease *coordinationv1.Lease, now time.Time) bool {
+	if lease.Spec.RenewTime == nil {
+		return true
+	}
+	dur := s.opts.LeaseDuration
+	if lease.Spec.LeaseDurationSeconds != nil {
+		dur = time.Duration(*lease.Spec.LeaseDurationSeconds) * time.Second
+	}
+	return lease.Spec.RenewTime.Add(dur).Before(now)
+}
+
+func (s *Sharder) shardLeaseName(idx int) string {
+	return fmt.Sprintf("%s-shard-%d", s.opts.Name, idx)
+}
+
+func (s *Sharder) leaseDurationSeconds() *int32 {
+	secs := int32(s.opts.LeaseDuration / time.Second)
+	if secs < 1 {
+		secs = 1
+	}
+	return &secs
+}
+
+func (s *Sharder) newLease(name string, lbls map[string]string, now time.Time) *coordinationv1.Lease {
+	return &coordinationv1.Lease{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: s.opts.Namespace,
+			Labels:    lbls,
+		},
+		Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &s.opts.Identity,
+			LeaseDurationSeconds: s.leaseDurationSeconds(),
+			AcquireTime:          &metav1.MicroTime{Time: now},
+			RenewTime:            &metav1.MicroTime{Time: now},
+		},
+	}
+}
+
+func holder(lease *coordinationv1.Lease) string {
+	if lease.Spec.HolderIdentity == nil {
+		return ""
+	}
+	return *lease.Spec.HolderIdentity
+}
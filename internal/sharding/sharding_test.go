@@ -0,0 +1,165 @@
+package sharding
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func newTestSharder(t *testing.T, cs *fake.Clientset, identity string) *Sharder {
+	t.Helper()
+
+	s, err := New(Options{
+		Client:        cs,
+		Namespace:     "default",
+		Name:          "test",
+		Identity:      identity,
+		Shards:        4,
+		LeaseDuration: 3 * time.Second,
+		RenewDeadline: 2 * time.Second,
+		RetryPeriod:   10 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestShardFor(t *testing.T) {
+	s := newTestSharder(t, fake.NewSimpleClientset(), "a")
+
+	seen := map[int]bool{}
+	for i := 0; i < 100; i++ {
+		shard := s.ShardFor("default", fmt.Sprintf("obj-%d", i))
+		assert.True(t, shard >= 0 && shard < 4)
+		assert.Equal(t, shard, s.ShardFor("default", fmt.Sprintf("obj-%d", i)))
+		seen[shard] = true
+	}
+	assert.Equal(t, 4, len(seen))
+}
+
+func TestSingleReplicaOwnsAll(t *testing.T) {
+	s := newTestSharder(t, fake.NewSimpleClientset(), "a")
+
+	acquired := 0
+	s.OnAcquire(func() { acquired++ })
+
+	assert.Nil(t, s.sync(context.TODO()))
+	assert.Equal(t, []int{0, 1, 2, 3}, s.Owned())
+	assert.Equal(t, 4, acquired)
+	assert.True(t, s.Owns("default", "anything"))
+}
+
+func TestRebalanceWithoutDoubleProcessing(t *testing.T) {
+	ctx := context.TODO()
+	cs := fake.NewSimpleClientset()
+
+	a := newTestSharder(t, cs, "a")
+	assert.Nil(t, a.sync(ctx))
+	assert.Equal(t, 4, len(a.Owned()))
+
+	// An object of shard 3 is being processed by 'a'.
+	name := ""
+	for i := 0; len(name) == 0; i++ {
+		if a.ShardFor("default", fmt.Sprintf("obj-%d", i)) == 3 {
+			name = fmt.Sprintf("obj-%d", i)
+		}
+	}
+	_, done, ok := a.Track(ctx, "default", name)
+	assert.True(t, ok)
+
+	// 'b' joins: nothing is free yet.
+	b := newTestSharder(t, cs, "b")
+	assert.Nil(t, b.sync(ctx))
+	assert.Empty(t, b.Owned())
+
+	// 'a' gives away half of the shards, but shard 3 is still busy.
+	assert.Nil(t, a.sync(ctx))
+	assert.Eventually(t, func() bool {
+		return !a.isHeld(2)
+	}, time.Second, 10*time.Millisecond)
+	assert.True(t, a.isHeld(3))
+	assert.False(t, a.Owns("default", name))
+
+	assert.Nil(t, b.sync(ctx))
+	assert.Equal(t, []int{2}, b.Owned())
+	assert.False(t, b.Owns("default", name))
+
+	// Once processed, shard 3 can be handed over.
+	done()
+	assert.Eventually(t, func() bool {
+		return !a.isHeld(3)
+	}, time.Second, 10*time.Millisecond)
+
+	assert.Nil(t, b.sync(ctx))
+	assert.Equal(t, []int{2, 3}, b.Owned())
+	assert.Equal(t, []int{0, 1}, a.Owned())
+	assert.True(t, b.Owns("default", name))
+
+	_, _, ok = a.Track(ctx, "default", name)
+	assert.False(t, ok)
+}
+
+func TestDropStale(t *testing.T) {
+	s := newTestSharder(t, fake.NewSimpleClientset(), "a")
+	assert.Nil(t, s.sync(context.TODO()))
+
+	s.dropStale(time.Now().Add(5 * time.Second))
+	assert.Empty(t, s.Owned())
+}
+
+func TestLostShardCancelsInflight(t *testing.T) {
+	ctx := context.TODO()
+	cs := fake.NewSimpleClientset()
+
+	a := newTestSharder(t, cs, "a")
+	assert.Nil(t, a.sync(ctx))
+
+	// An operation of 'a' is running on shard 0.
+	name := ""
+	for i := 0; len(name) == 0; i++ {
+		if a.ShardFor("default", fmt.Sprintf("obj-%d", i)) == 0 {
+			name = fmt.Sprintf("obj-%d", i)
+		}
+	}
+	opCtx, done, ok := a.Track(ctx, "default", name)
+	assert.True(t, ok)
+	defer done()
+
+	// 'b' took the lease over: 'a' fails to renew it.
+	cs.PrependReactor("update", "leases", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, apierrors.NewConflict(coordinationv1.Resource("leases"), a.shardLeaseName(0), fmt.Errorf("held by b"))
+	})
+
+	assert.NotNil(t, a.renewShard(ctx, 0, time.Now()))
+	assert.False(t, a.isHeld(0))
+
+	select {
+	case <-opCtx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("in-flight operation not canceled")
+	}
+}
+
+func TestDroppedShardCancelsInflight(t *testing.T) {
+	ctx := context.TODO()
+	s := newTestSharder(t, fake.NewSimpleClientset(), "a")
+	assert.Nil(t, s.sync(ctx))
+
+	opCtx, done, ok := s.Track(ctx, "default", "obj")
+	assert.True(t, ok)
+	defer done()
+
+	s.dropStale(time.Now().Add(5 * time.Second))
+	assert.Eventually(t, func() bool {
+		return opCtx.Err() != nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -25,3 +25,14 @@ func SetupSignalHandler() (stopCh <-chan struct{}) {
 
 	return stop
 }
+
+// SetupReloadHandler registers for the reload signals (SIGHUP on posix).
+// The returned channel receives a value every time one of these signals
+// is caught.
+func SetupReloadHandler() <-chan os.Signal {
+	c := make(chan os.Signal, 1)
+	if len(reloadSignals) > 0 {
+		signal.Notify(c, reloadSignals...)
+	}
+	return c
+}
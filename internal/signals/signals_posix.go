@@ -9,3 +9,5 @@ import (
 )
 
 var shutdownSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+var reloadSignals = []os.Signal{syscall.SIGHUP}
@@ -5,3 +5,5 @@ import (
 )
 
 var shutdownSignals = []os.Signal{os.Interrupt}
+
+var reloadSignals = []os.Signal{}
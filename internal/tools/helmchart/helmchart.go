@@ -114,7 +114,7 @@ func RenderTemplate(ctx context.Context, opts RenderTemplateOptions) ([]controll
 
 type CheckResourceOptions struct {
 	DynamicClient   dynamic.Interface
-	DiscoveryClient *discovery.DiscoveryClient
+	DiscoveryClient discovery.DiscoveryInterface
 }
 
 func CheckResource(ctx context.Context, ref controller.ObjectRef, opts CheckResourceOptions) (*controller.ObjectRef, error) {
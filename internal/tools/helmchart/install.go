@@ -21,6 +21,7 @@ func Install(ctx context.Context, opts InstallOptions) (*release.Release, int64,
 		ChartName:       opts.ChartName,
 		CreateNamespace: true,
 		UpgradeCRDs:     true,
+		Timeout:         timeout(ctx),
 		Wait:            false,
 	}
 
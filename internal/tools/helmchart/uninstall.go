@@ -0,0 +1,54 @@
+package helmchart
+
+import (
+	"context"
+	"time"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/helmclient"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// defaultTimeout bounds the helm operations whose ctx has no deadline.
+const defaultTimeout = 3 * time.Minute
+
+type UninstallOptions struct {
+	HelmClient helmclient.Client
+	ChartName  string
+	Version    string
+	Resource   *unstructured.Unstructured
+}
+
+// Uninstall removes the release, waiting for its resources to be deleted
+// until the ctx deadline.
+func Uninstall(ctx context.Context, opts UninstallOptions) error {
+	chartSpec := helmclient.ChartSpec{
+		ReleaseName: opts.Resource.GetName(),
+		Namespace:   opts.Resource.GetNamespace(),
+		ChartName:   opts.ChartName,
+		Version:     opts.Version,
+		Wait:        true,
+		Timeout:     timeout(ctx),
+	}
+
+	// The helm uninstall action does not accept a ctx.
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- opts.HelmClient.UninstallRelease(&chartSpec)
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// timeout returns the time left before the ctx deadline.
+func timeout(ctx context.Context) time.Duration {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return defaultTimeout
+	}
+	return time.Until(deadline)
+}
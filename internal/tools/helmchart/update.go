@@ -22,6 +22,7 @@ func Update(ctx context.Context, opts UpdateOptions) error {
 		Version:         opts.Version,
 		CreateNamespace: true,
 		UpgradeCRDs:     true,
+		Timeout:         timeout(ctx),
 		Replace:         true,
 	}
 
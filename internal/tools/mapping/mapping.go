@@ -0,0 +1,160 @@
+package mapping
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jmespath/go-jmespath"
+	"k8s.io/client-go/util/jsonpath"
+)
+
+// The expression languages.
+const (
+	// JSONPath is the kubectl JSONPath syntax, i.e. "{.spec.project.name}";
+	// the braces may be omitted.
+	JSONPath = "jsonpath"
+	// JMESPath is the https://jmespath.org syntax, i.e. "value[0].id".
+	JMESPath = "jmespath"
+)
+
+// The destinations of the request mappings.
+const (
+	InPath   = "path"
+	InQuery  = "query"
+	InHeader = "header"
+	InBody   = "body"
+)
+
+// InStatus is the destination of the response mappings.
+const InStatus = "status"
+
+// Mapping copies the value selected by an expression to a field.
+type Mapping struct {
+	// From: the expression selecting the value
+	From string `json:"from"`
+	// Language: the language of From [jsonpath, jmespath], defaults to jsonpath
+	// +optional
+	Language string `json:"language,omitempty"`
+	// To: where the value goes, as <location>.<name> - i.e. "path.project",
+	// "query.api-version", "header.If-Match", "body.settings.visibility"
+	// or "status.id"; body and status names are dot separated
+	To string `json:"to"`
+}
+
+// Target returns the location and the name of the destination.
+func (m Mapping) Target() (in, name string) {
+	in, name, _ = strings.Cut(m.To, ".")
+	return in, name
+}
+
+// Expression is a compiled From.
+type Expression interface {
+	// Search returns the value selected in data, false if none.
+	Search(data interface{}) (interface{}, bool, error)
+}
+
+// Compile parses the From expression.
+func (m Mapping) Compile() (Expression, error) {
+	switch strings.ToLower(m.Language) {
+	case "", JSONPath:
+		expr := strings.TrimSpace(m.From)
+		if !strings.HasPrefix(expr, "{") {
+			expr = "{" + expr + "}"
+		}
+		j := jsonpath.New(m.To).AllowMissingKeys(true)
+		if err := j.Parse(expr); err != nil {
+			return nil, fmt.Errorf("mapping to %q: %w", m.To, err)
+		}
+		return jsonPathExpr{j}, nil
+	case JMESPath:
+		j, err := jmespath.Compile(m.From)
+		if err != nil {
+			return nil, fmt.Errorf("mapping to %q: %w", m.To, err)
+		}
+		return jmesPathExpr{j}, nil
+	default:
+		return nil, fmt.Errorf("mapping to %q: unknown language: %q", m.To, m.Language)
+	}
+}
+
+// Validate checks the expressions and that the
+// destinations are among the given locations.
+func Validate(mappings []Mapping, locations ...string) error {
+	for _, m := range mappings {
+		if len(m.From) == 0 {
+			return fmt.Errorf("mapping to %q: missing from", m.To)
+		}
+		in, name := m.Target()
+		if len(name) == 0 {
+			return fmt.Errorf("mapping to %q: expected <location>.<name>", m.To)
+		}
+		valid := false
+		for _, el := range locations {
+			valid = valid || in == el
+		}
+		if !valid {
+			return fmt.Errorf("mapping to %q: location must be one of %v", m.To, locations)
+		}
+		if _, err := m.Compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetField sets the dot separated field of obj, creating
+// the missing maps.
+func SetField(obj map[string]interface{}, path string, value interface{}) error {
+	fields := strings.Split(path, ".")
+	cur := obj
+	for i, el := range fields[:len(fields)-1] {
+		next, ok := cur[el]
+		if !ok || next == nil {
+			m := map[string]interface{}{}
+			cur[el], cur = m, m
+			continue
+		}
+		m, ok := next.(map[string]interface{})
+		if !ok {
+			return fmt.Errorf("field %q is not an object", strings.Join(fields[:i+1], "."))
+		}
+		cur = m
+	}
+	cur[fields[len(fields)-1]] = value
+	return nil
+}
+
+type jsonPathExpr struct {
+	j *jsonpath.JSONPath
+}
+
+func (e jsonPathExpr) Search(data interface{}) (interface{}, bool, error) {
+	results, err := e.j.FindResults(data)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(results) == 0 || len(results[0]) == 0 {
+		return nil, false, nil
+	}
+	if len(results[0]) == 1 {
+		return results[0][0].Interface(), true, nil
+	}
+	// A wildcard or a slice.
+	res := make([]interface{}, 0, len(results[0]))
+	for _, el := range results[0] {
+		res = append(res, el.Interface())
+	}
+	return res, true, nil
+}
+
+type jmesPathExpr struct {
+	j *jmespath.JMESPath
+}
+
+func (e jmesPathExpr) Search(data interface{}) (interface{}, bool, error) {
+	res, err := e.j.Search(data)
+	if err != nil {
+		return nil, false, err
+	}
+	return res, res != nil, nil
+}
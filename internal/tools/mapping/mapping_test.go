@@ -0,0 +1,77 @@
+package mapping
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSearch(t *testing.T) {
+	data := map[string]interface{}{
+		"spec": map[string]interface{}{
+			"project": map[string]interface{}{"name": "pipelineProj"},
+		},
+		"value": []interface{}{
+			map[string]interface{}{"id": "a"},
+			map[string]interface{}{"id": "b"},
+		},
+	}
+
+	table := []struct {
+		mapping Mapping
+		want    interface{}
+		found   bool
+	}{
+		{mapping: Mapping{From: "{.spec.project.name}"}, want: "pipelineProj", found: true},
+		{mapping: Mapping{From: "$.spec.project.name"}, want: "pipelineProj", found: true},
+		{mapping: Mapping{From: ".value[*].id"}, want: []interface{}{"a", "b"}, found: true},
+		{mapping: Mapping{From: "{.spec.missing}"}},
+		{mapping: Mapping{From: "spec.project.name", Language: JMESPath}, want: "pipelineProj", found: true},
+		{mapping: Mapping{From: "value[?id=='b'] | [0].id", Language: JMESPath}, want: "b", found: true},
+		{mapping: Mapping{From: "spec.missing", Language: JMESPath}},
+	}
+
+	for _, tc := range table {
+		expr, err := tc.mapping.Compile()
+		if !assert.NoError(t, err, tc.mapping.From) {
+			continue
+		}
+		got, found, err := expr.Search(data)
+		assert.NoError(t, err, tc.mapping.From)
+		assert.Equal(t, tc.found, found, tc.mapping.From)
+		assert.Equal(t, tc.want, got, tc.mapping.From)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, Validate([]Mapping{
+		{From: "{.spec.project.name}", To: "path.project"},
+		{From: "spec.etag", Language: JMESPath, To: "header.If-Match"},
+	}, InPath, InHeader))
+
+	for _, el := range []Mapping{
+		{To: "path.project"},
+		{From: "{.spec.project", To: "path.project"},
+		{From: "spec.[", Language: JMESPath, To: "path.project"},
+		{From: "spec.name", Language: "xpath", To: "path.project"},
+		{From: "{.spec.name}", To: "status.name"},
+		{From: "{.spec.name}", To: "path"},
+	} {
+		assert.Error(t, Validate([]Mapping{el}, InPath), el)
+	}
+}
+
+func TestSetField(t *testing.T) {
+	obj := map[string]interface{}{"name": "sample"}
+	assert.NoError(t, SetField(obj, "settings.visibility", "private"))
+	assert.NoError(t, SetField(obj, "settings.features.wiki", true))
+	assert.Equal(t, map[string]interface{}{
+		"name": "sample",
+		"settings": map[string]interface{}{
+			"visibility": "private",
+			"features":   map[string]interface{}{"wiki": true},
+		},
+	}, obj)
+
+	assert.Error(t, SetField(obj, "name.first", "x"))
+}
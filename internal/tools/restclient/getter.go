@@ -2,13 +2,16 @@ package getter
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"strings"
 
 	"github.com/gobuffalo/flect"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/restclient"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/text"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/mapping"
 	unstructuredtools "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/unstructured"
 	"github.com/lucasepe/httplib"
 
@@ -24,12 +27,41 @@ import (
 type VerbsDescription struct {
 	// Name of the action to perform when this api is called
 	Action string `json:"action"`
-	// Method: the http method to use [GET, POST, PUT, DELETE, PATCH]
+	// Method: the http method to use [GET, POST, PUT, DELETE, PATCH, HEAD]
 	Method string `json:"method"`
 	// Path: the path to the api
 	Path string `json:"path"`
 	// AltFieldMapping: the alternative mapping of the fields to use in the request
 	AltFieldMapping map[string]string `json:"altFieldMapping,omitempty"`
+	// Pagination: how to read all the pages of the list - findby and list only
+	// +optional
+	Pagination *restclient.Pagination `json:"pagination,omitempty"`
+	// Polling: how to follow the long-running operations answered with
+	// 202 Accepted - create, update and delete only
+	// +optional
+	Polling *restclient.Polling `json:"polling,omitempty"`
+	// RequestFieldMapping: the CR fields set in the path, query, headers
+	// or body of the request; the expressions select from an object
+	// with the spec and status of the CR
+	// +optional
+	RequestFieldMapping []mapping.Mapping `json:"requestFieldMapping,omitempty"`
+	// ResponseFieldMapping: the response fields stored in the status of the CR
+	// +optional
+	ResponseFieldMapping []mapping.Mapping `json:"responseFieldMapping,omitempty"`
+}
+
+// validate checks the field mappings.
+func (v *VerbsDescription) validate() error {
+	err := mapping.Validate(v.RequestFieldMapping,
+		mapping.InPath, mapping.InQuery, mapping.InHeader, mapping.InBody)
+	if err != nil {
+		return fmt.Errorf("verb %q: requestFieldMapping: %w", v.Action, err)
+	}
+	err = mapping.Validate(v.ResponseFieldMapping, mapping.InStatus)
+	if err != nil {
+		return fmt.Errorf("verb %q: responseFieldMapping: %w", v.Action, err)
+	}
+	return nil
 }
 
 type Resource struct {
@@ -37,6 +69,10 @@ type Resource struct {
 	Kind string `json:"kind"`
 	// Identifiers: the list of fields to use as identifiers
 	Identifiers []string `json:"identifiers"`
+	// StatusFields: the response fields copied into the status keeping
+	// their JSON types, dot separated (i.e. "owner.login")
+	// +optional
+	StatusFields []string `json:"statusFields,omitempty"`
 	// VerbsDescription: the list of verbs to use on this resource
 	VerbsDescription []VerbsDescription `json:"verbsDescription"`
 	// CompareList: the list of fields to compare when checking if the resource is the same
@@ -81,6 +117,9 @@ type Info struct {
 
 	// OwnerReferences: the list of owner references to use when creating the resource
 	OwnerReferences []ReferenceInfo `json:"ownerReferences,omitempty"`
+
+	// TLS: the TLS configuration of the calls, if any
+	TLS *restclient.TLSConfig `json:"tls,omitempty"`
 }
 
 type Getter interface {
@@ -91,7 +130,10 @@ func Static(chart string) Getter {
 	return staticGetter{chartName: chart}
 }
 
-func Dynamic(cfg *rest.Config) (Getter, error) {
+// Dynamic returns a Getter reading the definitions and the authentication
+// objects from the cluster. When refs is not nil, the Secrets holding the
+// credentials are recorded in it as read by the composition.
+func Dynamic(cfg *rest.Config, refs *controller.References) (Getter, error) {
 	dyn, err := dynamic.NewForConfig(cfg)
 	if err != nil {
 		return nil, err
@@ -99,6 +141,7 @@ func Dynamic(cfg *rest.Config) (Getter, error) {
 
 	return &dynamicGetter{
 		dynamicClient: dyn,
+		references:    refs,
 	}, nil
 }
 
@@ -124,6 +167,7 @@ var _ Getter = (*dynamicGetter)(nil)
 
 type dynamicGetter struct {
 	dynamicClient dynamic.Interface
+	references    *controller.References
 }
 
 func (g *dynamicGetter) Get(un *unstructured.Unstructured) (*Info, error) {
@@ -132,6 +176,17 @@ func (g *dynamicGetter) Get(un *unstructured.Unstructured) (*Info, error) {
 		return nil, err
 	}
 
+	// The Secrets read, recorded even on failure: fixing them requeues the composition.
+	var reads []controller.ObjectRef
+	defer func() {
+		g.references.Set(controller.ObjectRef{
+			APIVersion: un.GetAPIVersion(),
+			Kind:       un.GetKind(),
+			Name:       un.GetName(),
+			Namespace:  un.GetNamespace(),
+		}, reads)
+	}()
+
 	// sel, err := selectorForGroup(gvr)
 	// if err != nil {
 	// 	return nil, err
@@ -224,18 +279,41 @@ func (g *dynamicGetter) Get(un *unstructured.Unstructured) (*Info, error) {
 			if err != nil {
 				return nil, err
 			}
+			for _, field := range resource.StatusFields {
+				if len(field) == 0 || strings.Contains("."+field+".", "..") {
+					return nil, fmt.Errorf("invalid definition for '%v' in namespace: %s: invalid status field %q", gvr, un.GetNamespace(), field)
+				}
+			}
+			for i := range resource.VerbsDescription {
+				if err := resource.VerbsDescription[i].validate(); err != nil {
+					return nil, fmt.Errorf("invalid definition for '%v' in namespace: %s: %w", gvr, un.GetNamespace(), err)
+				}
+			}
 
-			auth, err := g.getAuth(un)
+			auth, authObj, err := g.getAuth(un, &reads)
 			if err != nil {
 				return nil, err
 			}
 
+			// The one of the authentication object takes precedence.
+			tlsConfig, err := g.tlsConfig(authObj, &reads)
+			if err != nil {
+				return nil, err
+			}
+			if tlsConfig == nil {
+				tlsConfig, err = g.tlsConfig(&item, &reads)
+				if err != nil {
+					return nil, err
+				}
+			}
+
 			if resource.Kind == gvk.Kind {
 				return &Info{
 					URL:             swaggerPath,
 					Resource:        resource,
 					Auth:            auth,
 					OwnerReferences: ownerReferences,
+					TLS:             tlsConfig,
 				}, nil
 			}
 			// }
@@ -244,12 +322,13 @@ func (g *dynamicGetter) Get(un *unstructured.Unstructured) (*Info, error) {
 	return nil, nil
 }
 
-// getAuth returns the authentication method for the given resource.
+// getAuth returns the authentication method for the given resource and
+// the authentication object, adding the Secrets it reads to reads.
 // It returns an error if the authentication object is not valid.
-func (g *dynamicGetter) getAuth(un *unstructured.Unstructured) (httplib.AuthMethod, error) {
+func (g *dynamicGetter) getAuth(un *unstructured.Unstructured, reads *[]controller.ObjectRef) (httplib.AuthMethod, *unstructured.Unstructured, error) {
 	gvr, err := unstructuredtools.GVR(un)
 	if err != nil {
-		return nil, err
+		return nil, nil, err
 	}
 
 	var authRef string
@@ -257,21 +336,21 @@ func (g *dynamicGetter) getAuth(un *unstructured.Unstructured) (httplib.AuthMeth
 
 	authenticationRefsMap, ok, err := unstructured.NestedStringMap(un.Object, "spec", "authenticationRefs")
 	if err != nil {
-		return nil, fmt.Errorf("error getting spec.authenticationRefs for '%v' in namespace: %s", gvr, un.GetNamespace())
+		return nil, nil, fmt.Errorf("error getting spec.authenticationRefs for '%v' in namespace: %s", gvr, un.GetNamespace())
 	}
 	if !ok {
-		return nil, fmt.Errorf("missing spec.authenticationRefs in definition for '%v' in namespace: %s", gvr, un.GetNamespace())
+		return nil, nil, fmt.Errorf("missing spec.authenticationRefs in definition for '%v' in namespace: %s", gvr, un.GetNamespace())
 	}
 
 	for key, _ := range authenticationRefsMap {
 		authRef, ok, err = unstructured.NestedString(un.Object, "spec", "authenticationRefs", key)
 		if err != nil {
-			return nil, fmt.Errorf("error getting spec.authenticationRefs.%s for '%v' in namespace: %s", key, gvr, un.GetNamespace())
+			return nil, nil, fmt.Errorf("error getting spec.authenticationRefs.%s for '%v' in namespace: %s", key, gvr, un.GetNamespace())
 		}
 		if ok {
 			authType, err = restclient.ToType(strings.Split(key, "AuthRef")[0])
 			if err != nil {
-				return nil, err
+				return nil, nil, err
 			}
 			break
 		}
@@ -301,10 +380,158 @@ func (g *dynamicGetter) getAuth(un *unstructured.Unstructured) (httplib.AuthMeth
 		Namespace(un.GetNamespace()).
 		Get(context.Background(), authRef, metav1.GetOptions{})
 	if err != nil {
+		return nil, nil, err
+	}
+
+	secret, err := g.resolveSecretRef(auth, authType)
+	if secret != nil {
+		*reads = append(*reads, *secret)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := parseAuthentication(auth, authType)
+	if err != nil {
+		return nil, nil, err
+	}
+	return res, auth, nil
+}
+
+// secretFields are the fields of the authentication objects
+// that can be read from a Secret by spec.secretRef.
+var secretFields = map[restclient.AuthType]string{
+	restclient.AuthTypeBasic:  "password",
+	restclient.AuthTypeBearer: "token",
+	restclient.AuthTypeOAuth2: "clientSecret",
+	restclient.AuthTypeAPIKey: "key",
+}
+
+// resolveSecretRef sets the secret field of the authentication object to
+// the Secret key referenced by its spec.secretRef, if any, and returns the
+// Secret reference. The Secret namespace defaults to the object one.
+func (g *dynamicGetter) resolveSecretRef(auth *unstructured.Unstructured, authType restclient.AuthType) (*controller.ObjectRef, error) {
+	secretRef, ok, err := unstructured.NestedStringMap(auth.Object, "spec", "secretRef")
+	if err != nil {
+		return nil, fmt.Errorf("error getting spec.secretRef of %s '%s' in namespace: %s", auth.GetKind(), auth.GetName(), auth.GetNamespace())
+	}
+	if !ok {
+		return nil, nil
+	}
+
+	field, ok := secretFields[authType]
+	if !ok {
+		return nil, fmt.Errorf("spec.secretRef not supported by auth type: %s", authType)
+	}
+
+	name, namespace, key := secretRef["name"], secretRef["namespace"], secretRef["key"]
+	if len(name) == 0 || len(key) == 0 {
+		return nil, fmt.Errorf("missing name or key in spec.secretRef of %s '%s' in namespace: %s", auth.GetKind(), auth.GetName(), auth.GetNamespace())
+	}
+	if len(namespace) == 0 {
+		namespace = auth.GetNamespace()
+	}
+	ref := &controller.ObjectRef{APIVersion: "v1", Kind: "Secret", Name: name, Namespace: namespace}
+
+	val, err := secretValue(context.Background(), g.dynamicClient, namespace, name, key)
+	if err != nil {
+		// Still recorded, fixing the Secret requeues the composition.
+		return ref, err
+	}
+
+	if err := unstructured.SetNestedField(auth.Object, val, "spec", field); err != nil {
 		return nil, err
 	}
+	return ref, nil
+}
+
+// tlsConfig returns the TLS configuration in the spec.tls field of
+// the object, if any, adding the Secrets it reads to reads:
+//
+//	tls:
+//	  caRef: {name: ..., namespace: ..., key: ...}
+//	  certRef: {...}
+//	  keyRef: {...}
+//	  serverName: api.internal
+//	  insecureSkipVerify: false
+//
+// The Secrets namespace defaults to the object one.
+func (g *dynamicGetter) tlsConfig(obj *unstructured.Unstructured, reads *[]controller.ObjectRef) (*restclient.TLSConfig, error) {
+	spec, ok, err := unstructured.NestedMap(obj.Object, "spec", "tls")
+	if err != nil {
+		return nil, fmt.Errorf("error getting spec.tls of %s '%s' in namespace: %s", obj.GetKind(), obj.GetName(), obj.GetNamespace())
+	}
+	if !ok {
+		return nil, nil
+	}
 
-	return parseAuthentication(auth, authType)
+	res := &restclient.TLSConfig{}
+	res.ServerName, _, err = unstructured.NestedString(spec, "serverName")
+	if err != nil {
+		return nil, fmt.Errorf("spec.tls.serverName: %w", err)
+	}
+	res.InsecureSkipVerify, _, err = unstructured.NestedBool(spec, "insecureSkipVerify")
+	if err != nil {
+		return nil, fmt.Errorf("spec.tls.insecureSkipVerify: %w", err)
+	}
+
+	for _, el := range []struct {
+		field string
+		dst   *[]byte
+	}{
+		{"caRef", &res.CA},
+		{"certRef", &res.Cert},
+		{"keyRef", &res.Key},
+	} {
+		ref, ok, err := unstructured.NestedStringMap(spec, el.field)
+		if err != nil {
+			return nil, fmt.Errorf("spec.tls.%s: %w", el.field, err)
+		}
+		if !ok {
+			continue
+		}
+
+		name, namespace, key := ref["name"], ref["namespace"], ref["key"]
+		if len(name) == 0 || len(key) == 0 {
+			return nil, fmt.Errorf("missing name or key in spec.tls.%s of %s '%s' in namespace: %s", el.field, obj.GetKind(), obj.GetName(), obj.GetNamespace())
+		}
+		if len(namespace) == 0 {
+			namespace = obj.GetNamespace()
+		}
+		*reads = append(*reads, controller.ObjectRef{APIVersion: "v1", Kind: "Secret", Name: name, Namespace: namespace})
+
+		val, err := secretValue(context.Background(), g.dynamicClient, namespace, name, key)
+		if err != nil {
+			return nil, err
+		}
+		*el.dst = []byte(val)
+	}
+
+	return res, nil
+}
+
+// secretValue returns the decoded value of the key of the Secret.
+func secretValue(ctx context.Context, cli dynamic.Interface, namespace, name, key string) (string, error) {
+	gvr := schema.GroupVersionResource{Version: "v1", Resource: "secrets"}
+
+	sec, err := cli.Resource(gvr).Namespace(namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return "", fmt.Errorf("getting secret '%s' in namespace: %s: %w", name, namespace, err)
+	}
+
+	enc, ok, err := unstructured.NestedString(sec.Object, "data", key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("missing key '%s' in secret '%s' in namespace: %s", key, name, namespace)
+	}
+
+	dat, err := base64.StdEncoding.DecodeString(enc)
+	if err != nil {
+		return "", fmt.Errorf("decoding key '%s' of secret '%s' in namespace: %s: %w", key, name, namespace, err)
+	}
+	return string(dat), nil
 }
 
 // parseAuthentication parses the authentication object and returns the appropriate AuthMethod for the given AuthType.
@@ -344,6 +571,50 @@ func parseAuthentication(un *unstructured.Unstructured, authType restclient.Auth
 		return &httplib.TokenAuth{
 			Token: token,
 		}, nil
+	} else if authType == restclient.AuthTypeOAuth2 {
+		res := &restclient.OAuth2Auth{}
+		for _, el := range []struct {
+			field string
+			dst   *string
+		}{
+			{"tokenURL", &res.TokenURL},
+			{"clientID", &res.ClientID},
+			{"clientSecret", &res.ClientSecret},
+		} {
+			val, ok, err := unstructured.NestedString(un.Object, "spec", el.field)
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, fmt.Errorf("missing spec.%s in definition for '%v' in namespace: %s", el.field, gvr, un.GetNamespace())
+			}
+			*el.dst = val
+		}
+		res.Scopes, _, err = unstructured.NestedStringSlice(un.Object, "spec", "scopes")
+		if err != nil {
+			return nil, err
+		}
+		res.Audience, _, err = unstructured.NestedString(un.Object, "spec", "audience")
+		if err != nil {
+			return nil, err
+		}
+		return res, nil
+	} else if authType == restclient.AuthTypeAPIKey {
+		key, ok, err := unstructured.NestedString(un.Object, "spec", "key")
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, fmt.Errorf("missing spec.key in definition for '%v' in namespace: %s", gvr, un.GetNamespace())
+		}
+		scheme, _, err := unstructured.NestedString(un.Object, "spec", "scheme")
+		if err != nil {
+			return nil, err
+		}
+		return &restclient.APIKeyAuth{
+			Key:    key,
+			Scheme: scheme,
+		}, nil
 	}
 	return nil, fmt.Errorf("unknown auth type: %s", authType)
 }
@@ -0,0 +1,140 @@
+package getter
+
+import (
+	"testing"
+
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/client/restclient"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/mapping"
+	"github.com/lucasepe/httplib"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic/fake"
+)
+
+func authObject(kind string, spec map[string]interface{}) *unstructured.Unstructured {
+	un := &unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+	un.SetAPIVersion("test.group.com/v1alpha1")
+	un.SetKind(kind)
+	un.SetName("myauth")
+	un.SetNamespace("default")
+	return un
+}
+
+func TestResolveSecretRef(t *testing.T) {
+	sec := &unstructured.Unstructured{}
+	sec.SetAPIVersion("v1")
+	sec.SetKind("Secret")
+	sec.SetName("credentials")
+	sec.SetNamespace("shared")
+	// "s3cr3t"
+	sec.Object["data"] = map[string]interface{}{"password": "czNjcjN0"}
+
+	g := &dynamicGetter{
+		dynamicClient: fake.NewSimpleDynamicClient(runtime.NewScheme(), sec),
+	}
+
+	auth := authObject("BasicAuth", map[string]interface{}{
+		"username": "admin",
+		"secretRef": map[string]interface{}{
+			"name":      "credentials",
+			"namespace": "shared",
+			"key":       "password",
+		},
+	})
+	ref, err := g.resolveSecretRef(auth, restclient.AuthTypeBasic)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &controller.ObjectRef{APIVersion: "v1", Kind: "Secret", Name: "credentials", Namespace: "shared"}, ref)
+
+	res, err := parseAuthentication(auth, restclient.AuthTypeBasic)
+	assert.NoError(t, err)
+	assert.Equal(t, &httplib.BasicAuth{Username: "admin", Password: "s3cr3t"}, res)
+
+	// The Secret namespace defaults to the object one.
+	auth = authObject("BearerAuth", map[string]interface{}{
+		"secretRef": map[string]interface{}{"name": "credentials", "key": "password"},
+	})
+	ref, err = g.resolveSecretRef(auth, restclient.AuthTypeBearer)
+	assert.Error(t, err)
+	assert.Equal(t, "default", ref.Namespace)
+
+	auth = authObject("ApikeyAuth", map[string]interface{}{
+		"secretRef": map[string]interface{}{"name": "credentials", "namespace": "shared", "key": "missing"},
+	})
+	_, err = g.resolveSecretRef(auth, restclient.AuthTypeAPIKey)
+	assert.Error(t, err)
+
+	// Plain fields still work.
+	auth = authObject("BearerAuth", map[string]interface{}{"token": "plain"})
+	ref, err = g.resolveSecretRef(auth, restclient.AuthTypeBearer)
+	assert.NoError(t, err)
+	assert.Nil(t, ref)
+}
+
+func TestTLSConfig(t *testing.T) {
+	sec := &unstructured.Unstructured{}
+	sec.SetAPIVersion("v1")
+	sec.SetKind("Secret")
+	sec.SetName("api-tls")
+	sec.SetNamespace("default")
+	// "ca", "cert" and "key"
+	sec.Object["data"] = map[string]interface{}{"ca.crt": "Y2E=", "tls.crt": "Y2VydA==", "tls.key": "a2V5"}
+
+	g := &dynamicGetter{
+		dynamicClient: fake.NewSimpleDynamicClient(runtime.NewScheme(), sec),
+	}
+
+	var reads []controller.ObjectRef
+	res, err := g.tlsConfig(authObject("BearerAuth", map[string]interface{}{}), &reads)
+	assert.NoError(t, err)
+	assert.Nil(t, res)
+
+	res, err = g.tlsConfig(authObject("BearerAuth", map[string]interface{}{
+		"tls": map[string]interface{}{
+			"caRef":      map[string]interface{}{"name": "api-tls", "key": "ca.crt"},
+			"certRef":    map[string]interface{}{"name": "api-tls", "key": "tls.crt"},
+			"keyRef":     map[string]interface{}{"name": "api-tls", "namespace": "default", "key": "tls.key"},
+			"serverName": "api.internal",
+		},
+	}), &reads)
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, &restclient.TLSConfig{
+		CA:         []byte("ca"),
+		Cert:       []byte("cert"),
+		Key:        []byte("key"),
+		ServerName: "api.internal",
+	}, res)
+	assert.Len(t, reads, 3)
+
+	_, err = g.tlsConfig(authObject("BearerAuth", map[string]interface{}{
+		"tls": map[string]interface{}{
+			"caRef": map[string]interface{}{"name": "missing", "key": "ca.crt"},
+		},
+	}), &reads)
+	assert.Error(t, err)
+}
+
+func TestVerbsDescriptionValidate(t *testing.T) {
+	descr := VerbsDescription{
+		Action: "create",
+		RequestFieldMapping: []mapping.Mapping{
+			{From: "{.spec.project.name}", To: "path.project"},
+		},
+		ResponseFieldMapping: []mapping.Mapping{
+			{From: "id", Language: mapping.JMESPath, To: "status.id"},
+		},
+	}
+	assert.NoError(t, descr.validate())
+
+	descr.ResponseFieldMapping[0].To = "body.id"
+	assert.Error(t, descr.validate())
+
+	descr.ResponseFieldMapping = nil
+	descr.RequestFieldMapping[0].From = "{.spec.project"
+	assert.Error(t, descr.validate())
+}
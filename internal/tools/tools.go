@@ -12,7 +12,7 @@ import (
 )
 
 type UpdateOptions struct {
-	DiscoveryClient *discovery.DiscoveryClient
+	DiscoveryClient discovery.DiscoveryInterface
 	DynamicClient   dynamic.Interface
 }
 
@@ -22,13 +22,18 @@ func Update(ctx context.Context, el *unstructured.Unstructured, opts UpdateOptio
 		return err
 	}
 
-	_, err = opts.DynamicClient.Resource(gvr).
+	res, err := opts.DynamicClient.Resource(gvr).
 		Namespace(el.GetNamespace()).
 		Update(ctx, el, metav1.UpdateOptions{
 			FieldValidation: "Ignore",
 		})
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Later updates of el don't conflict.
+	el.SetResourceVersion(res.GetResourceVersion())
+	return nil
 }
 
 func UpdateStatus(ctx context.Context, el *unstructured.Unstructured, opts UpdateOptions) error {
@@ -37,14 +42,19 @@ func UpdateStatus(ctx context.Context, el *unstructured.Unstructured, opts Updat
 		return err
 	}
 
-	_, err = opts.DynamicClient.Resource(gvr).
+	res, err := opts.DynamicClient.Resource(gvr).
 		Namespace(el.GetNamespace()).
 		UpdateStatus(ctx, el, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
 
-	return err
+	// Later updates of el don't conflict.
+	el.SetResourceVersion(res.GetResourceVersion())
+	return nil
 }
 
-func GVKtoGVR(dc *discovery.DiscoveryClient, gvk schema.GroupVersionKind) (schema.GroupVersionResource, error) {
+func GVKtoGVR(dc discovery.DiscoveryInterface, gvk schema.GroupVersionKind) (schema.GroupVersionResource, error) {
 	groupResources, err := restmapper.GetAPIGroupResources(dc)
 	if err != nil {
 		return schema.GroupVersionResource{}, err
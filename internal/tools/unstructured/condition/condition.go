@@ -10,6 +10,11 @@ const (
 	ReasonUnavailable = "Unavailable"
 	ReasonCreating    = "Creating"
 	ReasonDeleting    = "Deleting"
+	ReasonTimedOut    = "TimedOut"
+
+	ReasonWaitingForDependencies  = "WaitingForDependencies"
+	ReasonDependencyCycle         = "DependencyCycle"
+	ReasonMaintenanceWindowClosed = "MaintenanceWindowClosed"
 )
 
 func Unavailable() metav1.Condition {
@@ -41,6 +46,54 @@ func FailWithReason(reason string) metav1.Condition {
 	}
 }
 
+// TimedOut returns a condition that indicates the last operation
+// on the external resource did not complete within its deadline.
+func TimedOut(msg string) metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReady,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonTimedOut,
+		Message:            msg,
+	}
+}
+
+// WaitingForDependencies returns a condition that indicates the resource
+// is not created or updated until its dependencies are ready.
+func WaitingForDependencies(msg string) metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReady,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonWaitingForDependencies,
+		Message:            msg,
+	}
+}
+
+// DependencyCycle returns a condition that indicates the resource
+// depends, directly or not, on itself and is never created or updated.
+func DependencyCycle(msg string) metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReady,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonDependencyCycle,
+		Message:            msg,
+	}
+}
+
+// MaintenanceWindowClosed returns a condition that indicates a change
+// of the resource is deferred to its next maintenance window.
+func MaintenanceWindowClosed(msg string) metav1.Condition {
+	return metav1.Condition{
+		Type:               TypeReady,
+		Status:             metav1.ConditionFalse,
+		LastTransitionTime: metav1.Now(),
+		Reason:             ReasonMaintenanceWindowClosed,
+		Message:            msg,
+	}
+}
+
 // Deleting returns a condition that indicates the resource is currently
 // being deleted.
 func Deleting() metav1.Condition {
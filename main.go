@@ -2,25 +2,37 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/backend"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/client"
 	helmComposition "github.com/krateoplatformops/composition-dynamic-controller/internal/composition/helmComposition"
 	restComposition "github.com/krateoplatformops/composition-dynamic-controller/internal/composition/restComposition"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/config"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/controller"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/eventrecorder"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/faults"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/inventory"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/sharding"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/shortid"
+	"github.com/krateoplatformops/composition-dynamic-controller/internal/signals"
 	"github.com/krateoplatformops/composition-dynamic-controller/internal/support"
-	"github.com/krateoplatformops/composition-dynamic-controller/internal/tools/helmchart/archive"
-	getter "github.com/krateoplatformops/composition-dynamic-controller/internal/tools/restclient"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/rs/zerolog"
+	"golang.org/x/sync/errgroup"
 	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
@@ -42,18 +54,79 @@ func main() {
 	workers := flag.Int("workers", support.EnvInt("COMPOSITION_CONTROLLER_WORKERS", 1), "number of workers")
 	resyncInterval := flag.Duration("resync-interval",
 		support.EnvDuration("COMPOSITION_CONTROLLER_RESYNC_INTERVAL", time.Minute*3), "resync interval")
+	liveReads := flag.Bool("live-reads",
+		support.EnvBool("COMPOSITION_CONTROLLER_LIVE_READS", false),
+		"read the objects from the API server instead of the informer cache")
 	resourceGroup := flag.String("group",
 		support.EnvString("COMPOSITION_CONTROLLER_GROUP", ""), "resource api group")
 	resourceVersion := flag.String("version",
 		support.EnvString("COMPOSITION_CONTROLLER_VERSION", ""), "resource api version")
 	resourceName := flag.String("resource",
 		support.EnvString("COMPOSITION_CONTROLLER_RESOURCE", ""), "resource plural name")
+	extraResources := flag.String("resources",
+		support.EnvString("COMPOSITION_CONTROLLER_RESOURCES", ""),
+		"comma separated list of additional resources to watch as 'group/version/resource'")
 	namespace := flag.String("namespace",
 		support.EnvString("COMPOSITION_CONTROLLER_NAMESPACE", "default"), "namespace")
 	chart := flag.String("chart",
 		support.EnvString("COMPOSITION_CONTROLLER_CHART", ""), "chart")
 	cliType := flag.String("client",
-		support.EnvString("COMPOSITION_CLIENT_TYPE", string(client.ClientHelm)), "client type [REST|HELM]]")
+		support.EnvString("COMPOSITION_CLIENT_TYPE", string(client.ClientHelm)), "default client type [REST|HELM]]")
+	backendRoutes := flag.String("backend-routes",
+		support.EnvString("COMPOSITION_CONTROLLER_BACKEND_ROUTES", ""),
+		"comma separated list of 'Kind.group=CLIENT' pairs overriding the default client type")
+	shards := flag.Int("shards",
+		support.EnvInt("COMPOSITION_CONTROLLER_SHARDS", 0),
+		"number of shards the objects are split into across replicas (0 disables sharding)")
+	shardIdentity := flag.String("shard-identity",
+		support.EnvString("POD_NAME", ""), "unique identity of this replica (defaults to the hostname)")
+	shardLeaseNamespace := flag.String("shard-lease-namespace",
+		support.EnvString("POD_NAMESPACE", ""), "namespace of the shard leases (defaults to the watched namespace)")
+
+	recordInventory := flag.Bool("inventory",
+		support.EnvBool("COMPOSITION_CONTROLLER_INVENTORY", true),
+		"record the last known state of the objects in ConfigMaps to find the orphaned external resources")
+	orphanPolicy := flag.String("orphan-policy",
+		support.EnvString("COMPOSITION_CONTROLLER_ORPHAN_POLICY", string(controller.OrphanPolicyReport)),
+		"what to do with the external resources of the objects deleted while the controller was down [report|delete]")
+	namespaceMaxConcurrent := flag.Int("namespace-max-concurrent",
+		support.EnvInt("COMPOSITION_CONTROLLER_NAMESPACE_MAX_CONCURRENT", 0),
+		"number of events of the same namespace processed at the same time (0 means no cap)")
+	namespaceLimits := flag.String("namespace-limits",
+		support.EnvString("COMPOSITION_CONTROLLER_NAMESPACE_LIMITS", ""),
+		"comma separated list of 'namespace=N' pairs overriding --namespace-max-concurrent")
+	maintenanceWindow := flag.String("maintenance-window",
+		support.EnvString("COMPOSITION_CONTROLLER_MAINTENANCE_WINDOW", ""),
+		"cron expression telling when the maintenance window opens, out of it updates and deletes are deferred (empty means always open)")
+	maintenanceDuration := flag.Duration("maintenance-duration",
+		support.EnvDuration("COMPOSITION_CONTROLLER_MAINTENANCE_DURATION", 0),
+		"how long the maintenance window stays open")
+	maintenanceTimezone := flag.String("maintenance-timezone",
+		support.EnvString("COMPOSITION_CONTROLLER_MAINTENANCE_TIMEZONE", ""),
+		"timezone the maintenance window is evaluated in (defaults to UTC)")
+	maintenanceGateCreate := flag.Bool("maintenance-gate-create",
+		support.EnvBool("COMPOSITION_CONTROLLER_MAINTENANCE_GATE_CREATE", false),
+		"defer the creations out of the maintenance window too")
+	metricsAddress := flag.String("metrics-address",
+		support.EnvString("COMPOSITION_CONTROLLER_METRICS_ADDRESS", ":8080"),
+		"address the prometheus metrics are served on (empty disables them)")
+
+	clientFaults := flag.String("faults",
+		support.EnvString("COMPOSITION_CONTROLLER_FAULTS", ""),
+		"faults injected in the external client operations, for testing only (e.g. 'error=0.1,latency=1s')")
+	httpFaults := flag.String("http-faults",
+		support.EnvString("COMPOSITION_CONTROLLER_HTTP_FAULTS", ""),
+		"faults injected in the REST backend http calls, for testing only")
+	once := flag.Bool("once",
+		support.EnvBool("COMPOSITION_CONTROLLER_ONCE", false),
+		"reconcile all the objects one time, print a JSON summary and exit (non-zero on failures)")
+
+	configPath := flag.String("config",
+		support.EnvString("COMPOSITION_CONTROLLER_CONFIG", ""),
+		"path to the configuration file (overrides the other flags)")
+	configPollInterval := flag.Duration("config-poll-interval",
+		support.EnvDuration("COMPOSITION_CONTROLLER_CONFIG_POLL_INTERVAL", time.Second*10),
+		"how often the configuration file is checked for changes (0 disables polling)")
 
 	flag.Usage = func() {
 		fmt.Fprintln(flag.CommandLine.Output(), "Flags:")
@@ -61,23 +134,106 @@ func main() {
 	}
 
 	flag.Parse()
-	clientType, err := client.ToClientType(*cliType)
+
+	routes, err := backend.ParseRoutes(*backendRoutes)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
-	// Initialize the logger
-	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+	gvrs, err := parseGVRs(*extraResources)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	limits, err := parseNamespaceLimits(*namespaceLimits)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(*resourceName) > 0 {
+		gvrs = append([]schema.GroupVersionResource{{
+			Group:    *resourceGroup,
+			Version:  *resourceVersion,
+			Resource: *resourceName,
+		}}, gvrs...)
+	}
 
-	// Default level for this log is info, unless debug flag is present
-	zerolog.SetGlobalLevel(zerolog.InfoLevel)
+	// Configuration from flags and env vars, the config file (if any) is loaded on top.
+	base := config.Default()
 	if *debug {
-		zerolog.SetGlobalLevel(zerolog.DebugLevel)
+		base.Log.Level = zerolog.DebugLevel.String()
 	}
+	base.Namespace = *namespace
+	base.Workers = *workers
+	base.ResyncInterval.Duration = *resyncInterval
+	base.LiveReads = *liveReads
+	base.Backends.Default = *cliType
+	base.Backends.Helm.Chart = *chart
+	for _, gvr := range gvrs {
+		base.Resources = append(base.Resources, config.Resource{
+			Group:    gvr.Group,
+			Version:  gvr.Version,
+			Resource: gvr.Resource,
+		})
+	}
+	base.Sharding.Shards = *shards
+	base.Sharding.Identity = *shardIdentity
+	base.Sharding.LeaseNamespace = *shardLeaseNamespace
+	base.Orphans.Inventory = *recordInventory
+	base.Orphans.Policy = *orphanPolicy
+	base.Namespaces.MaxConcurrent = *namespaceMaxConcurrent
+	base.Faults.Client = *clientFaults
+	base.Faults.HTTP = *httpFaults
+	base.Maintenance.Window = *maintenanceWindow
+	base.Maintenance.Duration.Duration = *maintenanceDuration
+	base.Maintenance.Timezone = *maintenanceTimezone
+	base.Maintenance.GateCreate = *maintenanceGateCreate
+	if len(limits) > 0 {
+		base.Namespaces.Limits = limits
+	}
+	if len(routes) > 0 {
+		base.Backends.Routes = map[string]string{}
+		for gk, name := range routes {
+			base.Backends.Routes[gk.String()] = name
+		}
+	}
+
+	conf := base
+	if len(*configPath) > 0 {
+		conf, err = config.Load(*configPath, base)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: loading configuration: %v\n", err)
+			os.Exit(1)
+		}
+	} else if err := conf.Validate(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	if !backend.Exists(conf.Backends.Default) {
+		fmt.Fprintf(os.Stderr, "Error: unknown client type %q (available: %s)\n",
+			conf.Backends.Default, strings.Join(backend.Names(), ", "))
+		os.Exit(1)
+	}
+	routes = map[schema.GroupKind]string{}
+	for gk, name := range conf.Backends.Routes {
+		routes[schema.ParseGroupKind(gk)] = name
+	}
+
+	// Initialize the logger
+	zerolog.TimeFieldFormat = zerolog.TimeFormatUnix
+
+	// Default level for this log is info, unless debug flag or log.level are present
+	zerolog.SetGlobalLevel(conf.LogLevel())
 
 	zerolog.TimeFieldFormat = time.RFC3339
 	// outLogger := zerolog.ConsoleWriter{Out: os.Stdout, TimeFormat: time.RFC3339, NoColor: true, }
-	log := zerolog.New(os.Stdout).With().
+	logOut := os.Stdout
+	if *once {
+		// Stdout is for the summary.
+		logOut = os.Stderr
+	}
+	log := zerolog.New(logOut).With().
 		Str("service", serviceName).
 		Timestamp().
 		Logger()
@@ -92,6 +248,8 @@ func main() {
 	if err != nil {
 		log.Fatal().Err(err).Msg("Building kubeconfig.")
 	}
+	// Our own writes are recognized by the field manager.
+	cfg.UserAgent = controller.FieldManager
 
 	dyn, err := dynamic.NewForConfig(cfg)
 	if err != nil {
@@ -103,69 +261,360 @@ func main() {
 		log.Fatal().Err(err).Msg("Creating event recorder.")
 	}
 
-	var handler controller.ExternalClient
-	switch clientType {
-	case client.ClientREST:
-		var swg getter.Getter
-		swg, err = getter.Dynamic(cfg)
-		if err != nil {
-			log.Fatal().Err(err).Msg("Creating chart url info getter.")
-		}
-		handler = restComposition.NewHandler(cfg, &log, swg)
-	case client.ClientHelm:
-		var pig archive.Getter
-		if len(*chart) > 0 {
-			pig = archive.Static(*chart)
-		} else {
-			pig, err = archive.Dynamic(cfg)
-			if err != nil {
-				log.Fatal().Err(err).Msg("Creating chart url info getter.")
-			}
-		}
-		handler = helmComposition.NewHandler(cfg, &log, pig)
+	// The Secrets read by the backends, to observe again
+	// their readers when they change (i.e. on rotation).
+	refs := controller.NewReferences()
+
+	handler, err := backend.NewRouter(backend.RouterOptions{
+		DynamicClient: dyn,
+		Routes:        routes,
+		Default:       conf.Backends.Default,
+		Options: backend.Options{
+			RESTConfig: cfg,
+			Logger:     &log,
+			Params:     backendParams(conf),
+			References: refs,
+		},
+	})
+	if err != nil {
+		log.Fatal().Err(err).Msg("Creating backend router.")
 	}
 
 	log.Info().
 		Str("build", Build).
-		Bool("debug", *debug).
-		Dur("resyncInterval", *resyncInterval).
-		Str("group", *resourceGroup).
-		Str("version", *resourceVersion).
-		Str("resource", *resourceName).
-		Str("clientType", clientType.String()).
+		Str("config", *configPath).
+		Str("logLevel", conf.LogLevel().String()).
+		Dur("resyncInterval", conf.ResyncInterval.Duration).
+		Str("namespace", conf.Namespace).
+		Interface("resources", conf.Resources).
+		Int("workers", conf.Workers).
+		Str("clientType", strings.ToUpper(conf.Backends.Default)).
+		Interface("backendRoutes", conf.Backends.Routes).
 		Msgf("Starting %s.", serviceName)
 
 	sid, err := shortid.New(1, shortid.DefaultABC, 2342)
 	if err != nil {
 		log.Fatal().Err(err).Msg("Creating shortid generator.")
 	}
-	ctrl := controller.New(sid, controller.Options{
-		Client:         dyn,
-		ResyncInterval: *resyncInterval,
-		GVR: schema.GroupVersionResource{
-			Group:    *resourceGroup,
-			Version:  *resourceVersion,
-			Resource: *resourceName,
-		},
-		Namespace:      *namespace,
-		Recorder:       rec,
-		Logger:         &log,
-		ExternalClient: handler,
-	})
-	// ctrl.SetExternalClient(handler)
 
-	ctx, cancel := signal.NotifyContext(context.Background(), []os.Signal{
+	stopSignals := []os.Signal{
 		os.Interrupt,
 		syscall.SIGINT,
 		syscall.SIGTERM,
 		syscall.SIGKILL,
-		syscall.SIGHUP,
 		syscall.SIGQUIT,
-	}...)
+	}
+	// SIGHUP reloads the configuration file, if any.
+	if len(*configPath) == 0 {
+		stopSignals = append(stopSignals, syscall.SIGHUP)
+	}
+	ctx, cancel := signal.NotifyContext(context.Background(), stopSignals...)
 	defer cancel()
 
-	err = ctrl.Run(ctx, *workers)
+	var inv controller.Inventory
+	if conf.Orphans.Inventory {
+		inv = inventory.New(inventory.Options{Client: dyn})
+	}
+
+	opts := controller.Options{
+		Client:         dyn,
+		ResyncInterval: conf.ResyncInterval.Duration,
+		LiveReads:      conf.LiveReads,
+		Namespace:      conf.Namespace,
+		Recorder:       rec,
+		Logger:         &log,
+		ExternalClient: handler,
+		Retry:          retryOptions(conf),
+		Timeouts:       timeoutOptions(conf),
+		Maintenance:    conf.Maintenance.Spec(),
+		Inventory:      inv,
+		References:     refs,
+		OrphanPolicy:   controller.OrphanPolicy(strings.ToLower(conf.Orphans.Policy)),
+		PriorityWeights: [3]int{
+			conf.PriorityWeights.High,
+			conf.PriorityWeights.Normal,
+			conf.PriorityWeights.Low,
+		},
+	}
+
+	if len(conf.Faults.Client) > 0 {
+		spec, _ := faults.ParseSpec(conf.Faults.Client)
+		log.Warn().Str("faults", conf.Faults.Client).Msg("Fault injection enabled.")
+		opts.Middlewares = append(opts.Middlewares, faults.Middleware(faults.New(spec)))
+	}
+
+	if *once {
+		code := runOnce(ctx, sid, conf, opts, &log)
+		cancel()
+		os.Exit(code)
+	}
+
+	// One controller per watched resource, all sharing the same backend router.
+	grp, ctx := errgroup.WithContext(ctx)
+
+	var sharder controller.Sharder
+	if conf.Sharding.Shards > 0 {
+		shs, err := newSharder(cfg, conf, &log)
+		if err != nil {
+			log.Fatal().Err(err).Msg("Creating sharder.")
+		}
+		grp.Go(func() error {
+			// Releases the held shards on shutdown.
+			shs.Run(ctx)
+			return nil
+		})
+		sharder = shs
+	}
+
+	if len(*metricsAddress) > 0 {
+		srv := &http.Server{
+			Addr:              *metricsAddress,
+			Handler:           promhttp.Handler(),
+			ReadHeaderTimeout: 10 * time.Second,
+		}
+		grp.Go(func() error {
+			<-ctx.Done()
+			return srv.Close()
+		})
+		grp.Go(func() error {
+			err := srv.ListenAndServe()
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		})
+	}
+
+	grp.Go(func() error {
+		refs.Watch(ctx, controller.WatchOptions{
+			Client:         dyn,
+			GVR:            schema.GroupVersionResource{Version: "v1", Resource: "secrets"},
+			Namespace:      conf.Namespace,
+			ResyncInterval: conf.ResyncInterval.Duration,
+			Logger:         &log,
+		})
+		return nil
+	})
+
+	// The namespace caps are shared by all the controllers.
+	nsLimiter := controller.NewNamespaceLimiter(conf.Namespaces.MaxConcurrent, conf.Namespaces.Limits)
+	// So are the objects waiting for their dependencies.
+	deps := controller.NewDependencies()
+
+	all := make([]*controller.Controller, 0, len(conf.Resources))
+	for _, gvr := range conf.GVRs() {
+		opts := opts
+		opts.GVR = gvr
+		opts.Sharder = sharder
+		opts.NamespaceLimiter = nsLimiter
+		opts.Dependencies = deps
+
+		ctrl := controller.New(sid, opts)
+		all = append(all, ctrl)
+
+		grp.Go(func() error {
+			return ctrl.Run(ctx, conf.Workers)
+		})
+	}
+
+	if len(*configPath) > 0 {
+		go config.Watch(ctx, config.WatchOptions{
+			Path:     *configPath,
+			Base:     base,
+			Current:  conf,
+			Interval: *configPollInterval,
+			Signals:  signals.SetupReloadHandler(),
+			Logger:   &log,
+			OnReload: func(old, cur *config.Config) {
+				if changed := old.RequiresRestart(cur); len(changed) > 0 {
+					log.Warn().Strs("settings", changed).
+						Msg("Some configuration changes require a restart to be applied.")
+				}
+
+				zerolog.SetGlobalLevel(cur.LogLevel())
+				nsLimiter.SetLimits(cur.Namespaces.MaxConcurrent, cur.Namespaces.Limits)
+				for _, ctrl := range all {
+					ctrl.SetRateLimit(cur.Retry.QPS, cur.Retry.Burst)
+					ctrl.SetMaxRetries(cur.Retry.MaxRetries)
+					ctrl.SetPollInterval(cur.Retry.PollInterval.Duration)
+					ctrl.SetTimeouts(timeoutOptions(cur))
+					if err := ctrl.SetMaintenance(cur.Maintenance.Spec()); err != nil {
+						log.Error().Err(err).Msg("Setting maintenance window.")
+					}
+				}
+			},
+		})
+	}
+
+	err = grp.Wait()
 	if err != nil {
 		log.Fatal().Err(err).Msg("Running controller.")
 	}
 }
+
+// onceSummary is the output of the --once mode.
+type onceSummary struct {
+	Failed    int                   `json:"failed"`
+	Deferred  int                   `json:"deferred"`
+	Resources []*controller.Summary `json:"resources"`
+}
+
+// runOnce reconciles the objects of all the watched resources one time,
+// prints the JSON summary on stdout and returns the exit code: non-zero
+// only for the failures, not for the deferred objects.
+func runOnce(ctx context.Context, sid *shortid.Shortid, conf *config.Config, opts controller.Options, log *zerolog.Logger) int {
+	res := onceSummary{Resources: []*controller.Summary{}}
+	for _, gvr := range conf.GVRs() {
+		opts.GVR = gvr
+		sum, err := controller.New(sid, opts).RunOnce(ctx)
+		if err != nil {
+			log.Err(err).Str("resource", gvr.String()).Msg("Listing objects.")
+			res.Failed++
+		}
+		res.Failed += sum.Failed
+		res.Deferred += sum.Deferred
+		res.Resources = append(res.Resources, sum)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(res); err != nil {
+		log.Err(err).Msg("Writing summary.")
+		return 1
+	}
+
+	if res.Failed > 0 {
+		return 1
+	}
+	return 0
+}
+
+// newSharder creates the sharder claiming the shards for this replica.
+func newSharder(cfg *rest.Config, conf *config.Config, log *zerolog.Logger) (*sharding.Sharder, error) {
+	cs, err := kubernetes.NewForConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	identity := conf.Sharding.Identity
+	if len(identity) == 0 {
+		identity, err = os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	namespace := conf.Sharding.LeaseNamespace
+	if len(namespace) == 0 {
+		namespace = conf.Namespace
+	}
+	if len(namespace) == 0 {
+		return nil, fmt.Errorf("the shard lease namespace must be specified when watching all namespaces")
+	}
+
+	return sharding.New(sharding.Options{
+		Client:        cs,
+		Namespace:     namespace,
+		Name:          conf.Sharding.LeaseName,
+		Identity:      identity,
+		Shards:        conf.Sharding.Shards,
+		LeaseDuration: conf.Sharding.LeaseDuration.Duration,
+		RenewDeadline: conf.Sharding.RenewDeadline.Duration,
+		RetryPeriod:   conf.Sharding.RetryPeriod.Duration,
+		Logger:        log,
+	})
+}
+
+// retryOptions returns the controller retry policy from the configuration.
+func retryOptions(conf *config.Config) controller.RetryOptions {
+	return controller.RetryOptions{
+		MaxRetries:   conf.Retry.MaxRetries,
+		BaseDelay:    conf.Retry.BaseDelay.Duration,
+		MaxDelay:     conf.Retry.MaxDelay.Duration,
+		QPS:          conf.Retry.QPS,
+		Burst:        conf.Retry.Burst,
+		PollInterval: conf.Retry.PollInterval.Duration,
+	}
+}
+
+// timeoutOptions returns the external client operations deadlines from the configuration.
+func timeoutOptions(conf *config.Config) controller.TimeoutOptions {
+	return controller.TimeoutOptions{
+		Observe: conf.Timeouts.Observe.Duration,
+		Create:  conf.Timeouts.Create.Duration,
+		Update:  conf.Timeouts.Update.Duration,
+		Delete:  conf.Timeouts.Delete.Duration,
+	}
+}
+
+// backendParams returns the parameters passed to the backend factories.
+func backendParams(conf *config.Config) map[string]string {
+	res := map[string]string{}
+	for k, v := range conf.Backends.Params {
+		res[k] = v
+	}
+
+	res[helmComposition.ParamChart] = conf.Backends.Helm.Chart
+	res[helmComposition.ParamRepositoryCache] = conf.Backends.Helm.RepositoryCache
+	res[helmComposition.ParamRepositoryConfig] = conf.Backends.Helm.RepositoryConfig
+
+	if d := conf.Backends.REST.Timeout.Duration; d > 0 {
+		res[restComposition.ParamHTTPTimeout] = d.String()
+	}
+	if n := conf.Backends.REST.MaxIdleConnsPerHost; n > 0 {
+		res[restComposition.ParamHTTPMaxIdleConnsPerHost] = strconv.Itoa(n)
+	}
+	if d := conf.Backends.REST.IdleConnTimeout.Duration; d > 0 {
+		res[restComposition.ParamHTTPIdleConnTimeout] = d.String()
+	}
+	if d := conf.Backends.REST.DocumentCacheTTL.Duration; d > 0 {
+		res[restComposition.ParamDocumentCacheTTL] = d.String()
+	}
+	if len(conf.Faults.HTTP) > 0 {
+		res[restComposition.ParamHTTPFaults] = conf.Faults.HTTP
+	}
+
+	return res
+}
+
+// parseGVRs parses a comma separated list of 'group/version/resource'.
+func parseGVRs(s string) ([]schema.GroupVersionResource, error) {
+	res := []schema.GroupVersionResource{}
+	for _, el := range strings.Split(s, ",") {
+		el = strings.TrimSpace(el)
+		if len(el) == 0 {
+			continue
+		}
+
+		parts := strings.Split(el, "/")
+		if len(parts) != 3 || len(parts[1]) == 0 || len(parts[2]) == 0 {
+			return nil, fmt.Errorf("invalid resource %q (expected 'group/version/resource')", el)
+		}
+
+		res = append(res, schema.GroupVersionResource{
+			Group:    parts[0],
+			Version:  parts[1],
+			Resource: parts[2],
+		})
+	}
+	return res, nil
+}
+
+// parseNamespaceLimits parses a comma separated list of 'namespace=N'.
+func parseNamespaceLimits(s string) (map[string]int, error) {
+	res := map[string]int{}
+	for _, el := range strings.Split(s, ",") {
+		el = strings.TrimSpace(el)
+		if len(el) == 0 {
+			continue
+		}
+
+		ns, val, ok := strings.Cut(el, "=")
+		n, err := strconv.Atoi(strings.TrimSpace(val))
+		if !ok || len(strings.TrimSpace(ns)) == 0 || err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid namespace limit %q (expected 'namespace=N')", el)
+		}
+		res[strings.TrimSpace(ns)] = n
+	}
+	return res, nil
+}